@@ -0,0 +1,125 @@
+// parseval сравнивает разборы с эталонными деревьями по PARSEVAL, как evalb:
+//
+//	parseval [-labels] [-sentences] [-unlabelled] gold.mrg test.mrg
+//
+// Оба файла в формате Penn Treebank, деревья сравниваются попарно по
+// порядку.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/olekukonko/tablewriter"
+
+	"github.com/quenbyako/parser/treebank"
+)
+
+func main() {
+	labels := flag.Bool("labels", false, "print per-label breakdown")
+	sentences := flag.Bool("sentences", false, "print scores of every sentence")
+	unlabelled := flag.Bool("unlabelled", false, "ignore constituent labels")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %v [flags] gold test\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	gold, err := readFile(flag.Arg(0))
+	if err != nil {
+		fatal(err)
+	}
+	test, err := readFile(flag.Arg(1))
+	if err != nil {
+		fatal(err)
+	}
+
+	report, err := treebank.Evaluate(gold, test, treebank.EvalOptions{Unlabelled: *unlabelled})
+	if err != nil {
+		fatal(err)
+	}
+
+	if *sentences {
+		printSentences(report)
+	}
+	for _, s := range report.Sentences {
+		if s.Err != nil {
+			fmt.Fprintln(os.Stderr, s.Err)
+		}
+	}
+
+	fmt.Printf("Number of sentences        = %6d\n", len(report.Sentences))
+	fmt.Printf("Number of skipped sentence = %6d\n", report.Skipped)
+	fmt.Printf("Bracketing Recall          = %6.2f\n", 100*report.Recall())
+	fmt.Printf("Bracketing Precision       = %6.2f\n", 100*report.Precision())
+	fmt.Printf("Bracketing FMeasure        = %6.2f\n", 100*report.F1())
+	fmt.Printf("Average crossing           = %6.2f\n", report.AverageCrossing())
+	fmt.Printf("No crossing                = %6.2f\n", 100*report.NoCrossingRate())
+
+	if *labels {
+		printLabels(report)
+	}
+}
+
+func readFile(path string) ([]*treebank.Tree, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return treebank.Read(path, f)
+}
+
+func printSentences(report *treebank.Report) {
+	w := tablewriter.NewWriter(os.Stdout)
+	w.SetHeader([]string{"ID", "Len", "Recall", "Prec", "Matched", "Gold", "Test", "Cross"})
+	for i, s := range report.Sentences {
+		if s.Err != nil {
+			w.Append([]string{strconv.Itoa(i + 1), "-", "-", "-", "-", "-", "-", "-"})
+			continue
+		}
+		w.Append([]string{
+			strconv.Itoa(i + 1),
+			strconv.Itoa(s.Length),
+			percent(s.Recall()),
+			percent(s.Precision()),
+			strconv.Itoa(s.Matched),
+			strconv.Itoa(s.Gold),
+			strconv.Itoa(s.Test),
+			strconv.Itoa(s.Crossing),
+		})
+	}
+	w.Render()
+}
+
+func printLabels(report *treebank.Report) {
+	w := tablewriter.NewWriter(os.Stdout)
+	w.SetHeader([]string{"Label", "Gold", "Test", "Matched", "Recall", "Prec", "F1"})
+	for _, label := range report.SortedLabels() {
+		s := report.Labels[label]
+		w.Append([]string{
+			label,
+			strconv.Itoa(s.Gold),
+			strconv.Itoa(s.Test),
+			strconv.Itoa(s.Matched),
+			percent(s.Recall()),
+			percent(s.Precision()),
+			percent(s.F1()),
+		})
+	}
+	w.Render()
+}
+
+func percent(v float64) string { return strconv.FormatFloat(100*v, 'f', 2, 64) }
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
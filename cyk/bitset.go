@@ -0,0 +1,56 @@
+package cyk
+
+import "math/bits"
+
+const wordSize = 64
+
+// bitset это множество небольших неотрицательных чисел (номеров символов или
+// позиций в предложении), упакованное в машинные слова.
+type bitset []uint64
+
+func newBitset(size int) bitset { return make(bitset, (size+wordSize-1)/wordSize) }
+
+func (b bitset) set(i int)      { b[i/wordSize] |= 1 << (i % wordSize) }
+func (b bitset) has(i int) bool { return b[i/wordSize]&(1<<(i%wordSize)) != 0 }
+
+func (b bitset) intersects(o bitset) bool {
+	for i := range b {
+		if b[i]&o[i] != 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// orRange добавляет в b все элементы o из полуинтервала [from, to).
+func (b bitset) orRange(o bitset, from, to int) {
+	for w := from / wordSize; w*wordSize < to; w++ {
+		b[w] |= o[w] & rangeMask(w, from, to)
+	}
+}
+
+// each вызывает f для каждого элемента из полуинтервала [from, to) по
+// возрастанию.
+func (b bitset) each(from, to int, f func(int)) {
+	for w := from / wordSize; w*wordSize < to; w++ {
+		word := b[w] & rangeMask(w, from, to)
+		for word != 0 {
+			f(w*wordSize + bits.TrailingZeros64(word))
+			word &= word - 1
+		}
+	}
+}
+
+// rangeMask возвращает маску тех бит слова w, которые попадают в [from, to).
+func rangeMask(w, from, to int) uint64 {
+	mask := ^uint64(0)
+	if lo := from - w*wordSize; lo > 0 {
+		mask &= ^uint64(0) << lo
+	}
+	if hi := to - w*wordSize; hi < wordSize {
+		mask &= ^uint64(0) >> (wordSize - hi)
+	}
+
+	return mask
+}
@@ -0,0 +1,216 @@
+package cyk
+
+import (
+	"math/bits"
+
+	"github.com/quenbyako/parser/grammar"
+	"github.com/quenbyako/parser/slices"
+)
+
+// BitTable это таблица CYK, в которой каждая ячейка — битовое множество
+// нетерминалов, а бинарные правила применяются как произведения булевых
+// матриц. Обратных ссылок на потомков в ней нет, зато на грамматиках с
+// сотнями нетерминалов она работает на порядки быстрее Table.
+//
+// Внутри используются позиции между терминалами: отрезок от терминала Y до
+// терминала X включительно хранится в ячейке (Y, X+1). Для каждого символа A
+// хранится булева матрица rows[A], где rows[A][i] это множество всех j, таких
+// что A выводит отрезок (i, j).
+type BitTable struct {
+	g     *grammar.Compiled
+	terms []Terminal
+	// количество позиций, всегда степень двойки: для Valiant матрицы делятся
+	// пополам до самого конца
+	size int
+
+	rows [][]bitset // символ -> i -> множество j
+	cols [][]bitset // символ -> j -> множество i
+
+	// частичные произведения для Valiant: пара -> i -> множество j
+	partial [][]bitset
+}
+
+var _ Chart = (*BitTable)(nil)
+
+// NewBitTable готовит таблицу для скомпилированной грамматики g.
+func NewBitTable(g *grammar.Compiled) *BitTable {
+	return &BitTable{
+		g:    g,
+		rows: make([][]bitset, g.Len()),
+		cols: make([][]bitset, g.Len()),
+	}
+}
+
+// Fill заполняет таблицу для всего предложения по диагоналям: сначала все
+// отрезки длины 1, потом 2 и так далее. Каждая пара селекторов проверяется
+// для ячейки одним пересечением строки левой матрицы со столбцом правой.
+func (t *BitTable) Fill(terms []Terminal) {
+	t.reset(terms)
+
+	for i := range terms {
+		t.fillTerminal(i)
+	}
+	for length := 2; length <= len(terms); length++ {
+		for i := 0; i+length <= len(terms); i++ {
+			t.fillSpan(i, i+length)
+		}
+	}
+}
+
+// FillValiant заполняет таблицу сведением к умножению булевых матриц
+// (Valiant, 1975) в упрощенной формулировке Охотина. Само умножение здесь
+// побитовое, то есть O(n³/64), но вся остальная работа уже не зависит от
+// длины предложения кубически, так что его можно заменить на любое быстрое
+// умножение.
+//
+// A. Okhotin — Parsing by matrix multiplication generalized to Boolean
+// grammars (2014)
+func (t *BitTable) FillValiant(terms []Terminal) {
+	t.reset(terms)
+	if len(terms) == 0 {
+		return
+	}
+
+	t.partial = make([][]bitset, len(t.g.Pairs()))
+	for p := range t.partial {
+		t.partial[p] = t.newMatrix()
+	}
+
+	t.compute(0, t.size)
+}
+
+func (t *BitTable) Len() int { return len(t.terms) }
+
+func (t *BitTable) Has(cell XY, i grammar.Ident) bool {
+	sym, ok := t.g.Lookup(i)
+	return ok && t.HasSymbol(cell, sym)
+}
+
+// HasSymbol сообщает, выводит ли символ sym отрезок cell. Как и Table.Has,
+// для ячеек вне таблицы и чужих символов возвращает false.
+func (t *BitTable) HasSymbol(cell XY, sym grammar.Symbol) bool {
+	if !t.inside(cell) || int(sym) >= len(t.rows) {
+		return false
+	}
+
+	return t.rows[sym][cell.Y].has(cell.X + 1)
+}
+
+// Idents возвращает все символы, которые выводят отрезок cell. Терминалы,
+// которых нет в грамматике, в таблицу не попадают вообще.
+func (t *BitTable) Idents(cell XY) []grammar.Ident {
+	res := make([]grammar.Ident, 0)
+	if !t.inside(cell) {
+		return res
+	}
+	for sym, matrix := range t.rows {
+		if matrix[cell.Y].has(cell.X + 1) {
+			res = append(res, t.g.Ident(grammar.Symbol(sym)))
+		}
+	}
+
+	return slices.SortEq(res)
+}
+
+func (t *BitTable) inside(cell XY) bool {
+	return cell.Y >= 0 && cell.Y <= cell.X && cell.X < len(t.terms)
+}
+
+func (t *BitTable) reset(terms []Terminal) {
+	t.terms = terms
+	t.size = 1 << bits.Len(uint(len(terms)))
+	t.partial = nil
+	for sym := range t.rows {
+		t.rows[sym] = t.newMatrix()
+		t.cols[sym] = t.newMatrix()
+	}
+}
+
+func (t *BitTable) newMatrix() []bitset {
+	res := make([]bitset, t.size)
+	for i := range res {
+		res[i] = newBitset(t.size)
+	}
+
+	return res
+}
+
+func (t *BitTable) setCell(i, j int, syms []grammar.Symbol) {
+	for _, sym := range syms {
+		if t.rows[sym][i].has(j) {
+			continue
+		}
+		t.rows[sym][i].set(j)
+		t.cols[sym][j].set(i)
+		t.setCell(i, j, t.g.Closure(sym))
+	}
+}
+
+func (t *BitTable) fillTerminal(i int) {
+	if sym, ok := t.g.Lookup(t.terms[i].Type); ok {
+		t.setCell(i, i+1, []grammar.Symbol{sym})
+	}
+}
+
+func (t *BitTable) fillSpan(i, j int) {
+	for p, pair := range t.g.Pairs() {
+		if t.rows[pair.Left][i].intersects(t.cols[pair.Right][j]) {
+			t.setCell(i, j, t.g.Parents(p))
+		}
+	}
+}
+
+// compute заполняет все ячейки (i, j), где l <= i < j < m.
+func (t *BitTable) compute(l, m int) {
+	if m-l >= 4 {
+		t.compute(l, (l+m)/2)
+		t.compute((l+m)/2, m)
+	}
+	t.complete(l, (l+m)/2, (l+m)/2, m)
+}
+
+// complete заполняет блок ячеек (i, j), где l <= i < m и l2 <= j < m2. К этому
+// моменту уже посчитаны оба диагональных блока рядом с ним, а в partial лежат
+// все пары для точек разбиения k, где m <= k < l2.
+func (t *BitTable) complete(l, m, l2, m2 int) {
+	switch {
+	case m-l == 1 && m == l2:
+		if l < len(t.terms) {
+			t.fillTerminal(l)
+		}
+	case m-l == 1:
+		if l2 <= len(t.terms) {
+			t.fillPartial(l, l2)
+		}
+	default:
+		mid, mid2 := (l+m)/2, (l2+m2)/2
+
+		t.complete(mid, m, l2, mid2)
+		t.multiply(l, mid, mid, m, l2, mid2)
+		t.complete(l, mid, l2, mid2)
+		t.multiply(mid, m, l2, mid2, mid2, m2)
+		t.complete(mid, m, mid2, m2)
+		t.multiply(l, mid, mid, m, mid2, m2)
+		t.multiply(l, mid, l2, mid2, mid2, m2)
+		t.complete(l, mid, mid2, m2)
+	}
+}
+
+// multiply добавляет к partial[r0:r1, d0:d1] произведение rows[r0:r1, c0:c1]
+// на rows[c0:c1, d0:d1] для каждой пары селекторов.
+func (t *BitTable) multiply(r0, r1, c0, c1, d0, d1 int) {
+	for p, pair := range t.g.Pairs() {
+		left, right := t.rows[pair.Left], t.rows[pair.Right]
+		for i := r0; i < r1; i++ {
+			left[i].each(c0, c1, func(k int) { t.partial[p][i].orRange(right[k], d0, d1) })
+		}
+	}
+}
+
+func (t *BitTable) fillPartial(i, j int) {
+	for p := range t.g.Pairs() {
+		if t.partial[p][i].has(j) {
+			t.setCell(i, j, t.g.Parents(p))
+		}
+	}
+}
@@ -0,0 +1,408 @@
+package cyk
+
+import (
+	"container/heap"
+	"fmt"
+	"math"
+	"sort"
+	"text/scanner"
+
+	"github.com/quenbyako/parser/grammar"
+)
+
+// Costs задает цены правок для Correct. Все цены неотрицательные, нулевые
+// функции означают цену 1 за любую вставку, удаление и замену на другой
+// терминал.
+type Costs struct {
+	// Insert это цена вставки терминала want, которого нет во входе.
+	Insert func(want grammar.Ident) float64
+	// Delete это цена удаления лишнего входного терминала got.
+	Delete func(got Terminal) float64
+	// Substitute это цена замены входного got на терминал грамматики want.
+	// По умолчанию 0, если got.Type совпадает с want, и 1 иначе.
+	Substitute func(got Terminal, want grammar.Ident) float64
+}
+
+func (c Costs) insert(want grammar.Ident) float64 {
+	if c.Insert == nil {
+		return 1
+	}
+
+	return c.Insert(want)
+}
+
+func (c Costs) delete(got Terminal) float64 {
+	if c.Delete == nil {
+		return 1
+	}
+
+	return c.Delete(got)
+}
+
+func (c Costs) substitute(got Terminal, want grammar.Ident) float64 {
+	if c.Substitute != nil {
+		return c.Substitute(got, want)
+	}
+	if got.Type.Eq(want) {
+		return 0
+	}
+
+	return 1
+}
+
+// MismatchCost возвращает Costs.Substitute, которая штрафует за каждое
+// отличие по отдельности: id за замену на терминал с другим именем и attr
+// за каждый атрибут want, которому входной терминал не удовлетворяет
+// (например не тот падеж). terminals это Terminals грамматики, complex
+// возвращает атрибуты входного терминала.
+func MismatchCost(terminals map[grammar.Ident]grammar.ComplexIdent, complex func(Terminal) grammar.ComplexIdent, id, attr float64) func(got Terminal, want grammar.Ident) float64 {
+	return func(got Terminal, want grammar.Ident) float64 {
+		if got.Type.Eq(want) {
+			return 0
+		}
+		w, ok := terminals[want]
+		if !ok {
+			return id
+		}
+		g := complex(got)
+		if g.ID != w.ID {
+			return id
+		}
+
+		var res float64
+		for k, v := range w.Properties {
+			if !(grammar.ComplexIdent{ID: w.ID, Properties: map[string]grammar.Value{k: v}}).Select(g) {
+				res += attr
+			}
+		}
+		for _, c := range w.Conditions {
+			if !(grammar.ComplexIdent{ID: w.ID, Conditions: []grammar.Condition{c}}).Select(g) {
+				res += attr
+			}
+		}
+
+		return res
+	}
+}
+
+// EditKind это вид правки входа.
+type EditKind int
+
+const (
+	EditInsert EditKind = iota
+	EditDelete
+	EditSubstitute
+)
+
+func (k EditKind) String() string {
+	switch k {
+	case EditInsert:
+		return "insert"
+	case EditDelete:
+		return "delete"
+	case EditSubstitute:
+		return "substitute"
+	default:
+		return fmt.Sprintf("edit(%d)", int(k))
+	}
+}
+
+// Correction это одна правка входа. Pos это номер входного терминала: для
+// вставки — того, перед которым вставляется want (len(terms) для вставки в
+// конец).
+type Correction struct {
+	Kind EditKind
+	Pos  int
+	Got  Terminal      // для удаления и замены
+	Want grammar.Ident // для вставки и замены
+	Cost float64
+}
+
+func (c Correction) String() string {
+	switch c.Kind {
+	case EditInsert:
+		return fmt.Sprintf("%v: insert %v", c.Pos, c.Want)
+	case EditDelete:
+		return fmt.Sprintf("%v: delete %v", c.Pos, c.Got.Type)
+	default:
+		return fmt.Sprintf("%v: substitute %v with %v", c.Pos, c.Got.Type, c.Want)
+	}
+}
+
+// Repair это самый дешевый способ сделать вход грамматичным.
+type Repair struct {
+	Cost        float64
+	Corrections []Correction
+	// Tree это дерево разбора исправленного входа. Удаленные терминалы в
+	// него не входят, у вставленных Value пустой, а Position — позиция
+	// терминала, перед которым они вставлены. У пустых поддеревьев (из
+	// одних вставок) Span.X == Span.Y-1.
+	Tree *Tree
+}
+
+// Correct находит самую дешевую последовательность вставок, удалений и
+// замен терминалов, после которой terms выводится из корня грамматики, и
+// дерево разбора исправленного входа. ok будет false, только если
+// грамматика не выводит вообще ни одной строки.
+//
+// В отличие от обычной таблицы здесь у каждого символа на каждом отрезке,
+// включая пустые, хранится минимальная цена вывода. Отрезки считаются от
+// коротких к длинным, а внутри отрезка (где символы зависят друг от друга
+// через унарные правила и пустые соседние отрезки) — алгоритмом Кнута,
+// обобщением Дейкстры, так что цены должны быть неотрицательными.
+//
+// A. V. Aho, T. G. Peterson — A minimum distance error-correcting parser for
+// context-free languages (1972)
+func Correct(g Grammar, terms []Terminal, costs Costs) (_ Repair, ok bool) {
+	c := newCorrector(g.Compile(), terms, costs)
+	c.fill()
+
+	n := len(terms)
+	best, root := math.Inf(1), grammar.Symbol(0)
+	for _, r := range c.g.Roots() {
+		if cost := c.cost[c.span(0, n)][r]; cost < best {
+			best, root = cost, r
+		}
+	}
+	if math.IsInf(best, 1) {
+		return Repair{}, false
+	}
+
+	res := Repair{Cost: best}
+	res.Tree = c.tree(0, n, root, &res.Corrections)
+	sort.SliceStable(res.Corrections, func(i, j int) bool { return res.Corrections[i].Pos < res.Corrections[j].Pos })
+
+	return res, true
+}
+
+// correctStep это обратная ссылка: как символ получен на отрезке.
+type correctStep struct {
+	kind  correctKind
+	split int
+	child [2]grammar.Symbol
+}
+
+type correctKind uint8
+
+const (
+	stepInsert correctKind = iota
+	stepSubstitute
+	stepUnit
+	stepBinary
+	stepDeleteFirst
+	stepDeleteLast
+)
+
+type corrector struct {
+	g     *grammar.Compiled
+	terms []Terminal
+	costs Costs
+
+	// пары по правому символу
+	byRight [][]grammar.Pair
+
+	// cost[span][symbol], span это номер отрезка [i, j), 0 <= i <= j <= n
+	cost  [][]float64
+	steps [][]correctStep
+}
+
+func newCorrector(g *grammar.Compiled, terms []Terminal, costs Costs) *corrector {
+	c := &corrector{g: g, terms: terms, costs: costs, byRight: make([][]grammar.Pair, g.Len())}
+	for _, pair := range g.Pairs() {
+		c.byRight[pair.Right] = append(c.byRight[pair.Right], pair)
+	}
+
+	n := len(terms)
+	spans := (n + 1) * (n + 2) / 2
+	c.cost = make([][]float64, spans)
+	c.steps = make([][]correctStep, spans)
+	for i := range c.cost {
+		c.cost[i] = make([]float64, g.Len())
+		c.steps[i] = make([]correctStep, g.Len())
+		for s := range c.cost[i] {
+			c.cost[i][s] = math.Inf(1)
+		}
+	}
+
+	return c
+}
+
+// span возвращает номер отрезка [i, j): отрезки лежат по концу j, как
+// колонки в Table.
+func (c *corrector) span(i, j int) int { return j*(j+1)/2 + i }
+
+func (c *corrector) fill() {
+	n := len(c.terms)
+	for length := 0; length <= n; length++ {
+		for i := 0; i+length <= n; i++ {
+			c.fillSpan(i, i+length)
+		}
+	}
+}
+
+func (c *corrector) fillSpan(i, j int) {
+	cost, steps := c.cost[c.span(i, j)], c.steps[c.span(i, j)]
+	relax := func(s grammar.Symbol, value float64, step correctStep) bool {
+		if value < cost[s] {
+			cost[s], steps[s] = value, step
+			return true
+		}
+		return false
+	}
+
+	// все, что собирается из более коротких отрезков
+	for s := 0; s < c.g.Len(); s++ {
+		sym := grammar.Symbol(s)
+		if !c.g.IsTerminal(sym) {
+			continue
+		}
+		switch j - i {
+		case 0:
+			relax(sym, c.costs.insert(c.g.Ident(sym)), correctStep{kind: stepInsert})
+		case 1:
+			relax(sym, c.costs.substitute(c.terms[i], c.g.Ident(sym)), correctStep{kind: stepSubstitute})
+		}
+	}
+	if j > i {
+		first, last := c.cost[c.span(i+1, j)], c.cost[c.span(i, j-1)]
+		deleteFirst, deleteLast := c.costs.delete(c.terms[i]), c.costs.delete(c.terms[j-1])
+		for s := range cost {
+			relax(grammar.Symbol(s), first[s]+deleteFirst, correctStep{kind: stepDeleteFirst})
+			relax(grammar.Symbol(s), last[s]+deleteLast, correctStep{kind: stepDeleteLast})
+		}
+	}
+	for k := i + 1; k < j; k++ {
+		left, right := c.cost[c.span(i, k)], c.cost[c.span(k, j)]
+		for p, pair := range c.g.Pairs() {
+			value := left[pair.Left] + right[pair.Right]
+			if math.IsInf(value, 1) {
+				continue
+			}
+			for _, parent := range c.g.Parents(p) {
+				relax(parent, value, correctStep{kind: stepBinary, split: k, child: [2]grammar.Symbol{pair.Left, pair.Right}})
+			}
+		}
+	}
+
+	// внутри отрезка: унарные правила и бинарные, у которых один из
+	// потомков пустой. Символ, который достали из очереди, уже не
+	// подешевеет.
+	queue := make(correctQueue, 0, len(cost))
+	for s, value := range cost {
+		if !math.IsInf(value, 1) {
+			queue = append(queue, correctItem{grammar.Symbol(s), value})
+		}
+	}
+	heap.Init(&queue)
+	done := make([]bool, len(cost))
+	emptyLeft, emptyRight := c.cost[c.span(i, i)], c.cost[c.span(j, j)]
+	push := func(s grammar.Symbol, value float64, step correctStep) {
+		if !done[s] && relax(s, value, step) {
+			heap.Push(&queue, correctItem{s, value})
+		}
+	}
+
+	for queue.Len() > 0 {
+		item := heap.Pop(&queue).(correctItem)
+		if done[item.s] || item.cost > cost[item.s] {
+			continue
+		}
+		done[item.s] = true
+
+		for _, parent := range c.g.Closure(item.s) {
+			push(parent, item.cost, correctStep{kind: stepUnit, child: [2]grammar.Symbol{item.s}})
+		}
+
+		// item слева, справа пустой отрезок [j, j)
+		for _, pair := range c.g.PairsOf(item.s) {
+			if i == j && !done[pair.Right] {
+				continue
+			}
+			for _, parent := range c.g.Combine(pair.Left, pair.Right) {
+				push(parent, item.cost+emptyRight[pair.Right], correctStep{kind: stepBinary, split: j, child: [2]grammar.Symbol{pair.Left, pair.Right}})
+			}
+		}
+		// item справа, слева пустой отрезок [i, i)
+		for _, pair := range c.byRight[item.s] {
+			if i == j && !done[pair.Left] {
+				continue
+			}
+			for _, parent := range c.g.Combine(pair.Left, pair.Right) {
+				push(parent, emptyLeft[pair.Left]+item.cost, correctStep{kind: stepBinary, split: i, child: [2]grammar.Symbol{pair.Left, pair.Right}})
+			}
+		}
+	}
+}
+
+// tree восстанавливает дерево символа s на отрезке [i, j) и дописывает
+// правки в corrections.
+func (c *corrector) tree(i, j int, s grammar.Symbol, corrections *[]Correction) *Tree {
+	step := c.steps[c.span(i, j)][s]
+	ident := c.g.Ident(s)
+
+	switch step.kind {
+	case stepDeleteFirst:
+		*corrections = append(*corrections, Correction{Kind: EditDelete, Pos: i, Got: c.terms[i], Cost: c.costs.delete(c.terms[i])})
+		return c.tree(i+1, j, s, corrections)
+	case stepDeleteLast:
+		res := c.tree(i, j-1, s, corrections)
+		*corrections = append(*corrections, Correction{Kind: EditDelete, Pos: j - 1, Got: c.terms[j-1], Cost: c.costs.delete(c.terms[j-1])})
+		return res
+	}
+
+	res := &Tree{I: ident, Span: XY{X: j - 1, Y: i}}
+	switch step.kind {
+	case stepInsert:
+		*corrections = append(*corrections, Correction{Kind: EditInsert, Pos: i, Want: ident, Cost: c.costs.insert(ident)})
+		res.Terminal = &Terminal{Position: c.position(i), Type: ident}
+	case stepSubstitute:
+		got := c.terms[i]
+		if !got.Type.Eq(ident) {
+			*corrections = append(*corrections, Correction{Kind: EditSubstitute, Pos: i, Got: got, Want: ident, Cost: c.costs.substitute(got, ident)})
+		}
+		res.Terminal = &Terminal{Position: got.Position, Type: ident, Value: got.Value}
+	case stepUnit:
+		res.Children = []*Tree{c.tree(i, j, step.child[0], corrections)}
+	case stepBinary:
+		res.Children = []*Tree{
+			c.tree(i, step.split, step.child[0], corrections),
+			c.tree(step.split, j, step.child[1], corrections),
+		}
+	}
+
+	return res
+}
+
+// position возвращает позицию входного терминала i или, для конца входа,
+// позицию сразу за последним.
+func (c *corrector) position(i int) scanner.Position {
+	if i < len(c.terms) {
+		return c.terms[i].Position
+	}
+	if len(c.terms) == 0 {
+		return scanner.Position{}
+	}
+
+	last := c.terms[len(c.terms)-1]
+	return advance(last.Position, last.Value)
+}
+
+type correctItem struct {
+	s    grammar.Symbol
+	cost float64
+}
+
+type correctQueue []correctItem
+
+func (q correctQueue) Len() int           { return len(q) }
+func (q correctQueue) Less(i, j int) bool { return q[i].cost < q[j].cost }
+func (q correctQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q *correctQueue) Push(x any)        { *q = append(*q, x.(correctItem)) }
+
+func (q *correctQueue) Pop() any {
+	old := *q
+	res := old[len(old)-1]
+	*q = old[:len(old)-1]
+
+	return res
+}
@@ -0,0 +1,95 @@
+package cyk_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"text/scanner"
+
+	"github.com/stretchr/testify/require"
+
+	. "github.com/quenbyako/parser/cyk"
+	"github.com/quenbyako/parser/grammar"
+)
+
+func TestCorrect(t *testing.T) {
+	g, err := grammar.Parse("", strings.NewReader(`
+		S  : NP verb ;
+		NP : det noun<case=nom> | pron ;
+	`), "det", "noun", "verb", "pron")
+	require.NoError(t, err)
+	cnf := g.AsCNF("S")
+
+	// слово это имя терминала и, через двоеточие, падеж
+	parse := func(word string) grammar.ComplexIdent {
+		name, value, ok := strings.Cut(word, ":")
+		if !ok {
+			return grammar.ComplexIdent{ID: name}
+		}
+		return grammar.ComplexIdent{ID: name, Properties: map[string]grammar.Value{"case": grammar.StringValue(value)}}
+	}
+	costs := Costs{
+		Insert:     func(want grammar.Ident) float64 { return 1 },
+		Delete:     func(got Terminal) float64 { return 1.5 },
+		Substitute: MismatchCost(cnf.Terminals, func(got Terminal) grammar.ComplexIdent { return parse(got.Value) }, 3, 0.5),
+	}
+
+	for _, tt := range []struct {
+		name        string
+		input       string
+		cost        float64
+		corrections []string
+	}{
+		{name: "grammatical", input: "det noun:nom verb"},
+		{name: "wrong case", input: "det noun:acc verb", cost: 0.5, corrections: []string{`1: substitute noun:acc with noun<case="nom">`}},
+		{name: "missing verb", input: "pron", cost: 1, corrections: []string{"1: insert verb"}},
+		{name: "extra word", input: "det det noun:nom verb", cost: 1.5, corrections: []string{"0: delete det"}},
+		// замена на другой терминал дороже, чем удаление и вставка
+		{name: "wrong word", input: "verb verb", cost: 2.5, corrections: []string{"0: delete verb", "1: insert pron"}},
+		{name: "empty input", input: "", cost: 2, corrections: []string{"0: insert pron", "0: insert verb"}},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var terms []Terminal
+			for i, word := range strings.Fields(tt.input) {
+				c := parse(word)
+				hash, _ := c.Hash()
+				terms = append(terms, Terminal{Position: scanner.Position{Offset: i}, Type: grammar.Ident{ID: c.ID, AttrHash: hash}, Value: word})
+			}
+
+			repair, ok := Correct(cnf, terms, costs)
+			require.True(t, ok)
+			require.InDelta(t, tt.cost, repair.Cost, 1e-9)
+
+			var corrections []string
+			var total float64
+			for _, c := range repair.Corrections {
+				total += c.Cost
+				switch c.Kind {
+				case EditInsert:
+					corrections = append(corrections, fmt.Sprintf("%v: insert %v", c.Pos, cnf.Terminals[c.Want]))
+				case EditDelete:
+					corrections = append(corrections, fmt.Sprintf("%v: delete %v", c.Pos, c.Got.Value))
+				case EditSubstitute:
+					corrections = append(corrections, fmt.Sprintf("%v: substitute %v with %v", c.Pos, c.Got.Value, cnf.Terminals[c.Want]))
+				}
+			}
+			require.Equal(t, tt.corrections, corrections)
+			require.InDelta(t, repair.Cost, total, 1e-9)
+
+			// исправленный вход разбирается обычной таблицей
+			var fixed []Terminal
+			var leaves func(tree *Tree)
+			leaves = func(tree *Tree) {
+				if tree.Terminal != nil {
+					fixed = append(fixed, *tree.Terminal)
+				}
+				for _, child := range tree.Children {
+					leaves(child)
+				}
+			}
+			leaves(repair.Tree)
+			require.True(t, NewParser(cnf, BackendTable).Accepts(NewParser(cnf, BackendTable).Parse(fixed)))
+		})
+	}
+}
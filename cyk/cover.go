@@ -0,0 +1,112 @@
+package cyk
+
+import (
+	"math"
+
+	"github.com/quenbyako/parser/grammar"
+)
+
+// Cover покрывает предложение, которое не выводится целиком, минимальным
+// количеством идущих подряд фрагментов: самых длинных составляющих, которые
+// нашлись в таблице. Так из неграмматичного текста все равно можно
+// достать куски разбора.
+//
+// Фрагментом может быть только нетерминал из preferred; если в ячейке их
+// несколько, берется тот, что раньше в preferred. Слово, которое не входит
+// ни в один такой нетерминал, становится фрагментом само по себе (самой
+// внешней нодой своей диагональной ячейки), а при равном количестве
+// фрагментов выбирается покрытие, где таких слов меньше. Если preferred
+// пустой, фрагментом может быть любая нода. Слова, у которых диагональная
+// ячейка пустая (например после Filter), пропускаются.
+//
+// Нетерминалы сравниваются точно, так что в таблице для grammar.CNF
+// составляющая под сгенерированной цепочкой не найдется; для нее есть
+// CoverAll.
+//
+// Считается динамическим программированием по концам фрагментов за
+// O(n²) ячеек.
+func (t *Table) Cover(preferred []grammar.Ident) []ForestNode {
+	type step struct {
+		fragments, fallbacks int
+		from                 int // начало последнего фрагмента
+		node                 NonTerminalCoord
+	}
+
+	n := len(t.terms)
+	best := make([]step, n+1)
+	for x := 0; x < n; x++ {
+		best[x+1] = step{fragments: math.MaxInt}
+		for y := 0; y <= x; y++ {
+			cell := XY{X: x, Y: y}
+			index, ok := t.fragment(cell, preferred)
+			fallbacks := 0
+			if !ok {
+				if x != y {
+					continue
+				}
+				// одиночное слово, даже если оно ничего не вывело
+				index = len(t.Cell(cell)) - 1
+				fallbacks = 1
+			}
+
+			candidate := step{
+				fragments: best[y].fragments + 1,
+				fallbacks: best[y].fallbacks + fallbacks,
+				from:      y,
+				node:      NonTerminalCoord{XY: cell, Index: index},
+			}
+			if candidate.fragments < best[x+1].fragments ||
+				candidate.fragments == best[x+1].fragments && candidate.fallbacks < best[x+1].fallbacks {
+				best[x+1] = candidate
+			}
+		}
+	}
+
+	f := t.Forest(preferred...)
+	var res []ForestNode
+	for end := n; end > 0; end = best[end].from {
+		if best[end].node.Index >= 0 {
+			res = append(res, ForestNode{f: f, coord: best[end].node})
+		}
+	}
+	for i, j := 0, len(res)-1; i < j; i, j = i+1, j-1 {
+		res[i], res[j] = res[j], res[i]
+	}
+
+	return res
+}
+
+// fragment возвращает индекс ноды ячейки, которая подходит как фрагмент
+// для Cover.
+func (t *Table) fragment(cell XY, preferred []grammar.Ident) (int, bool) {
+	nodes := t.Cell(cell)
+	if len(preferred) == 0 {
+		// замыкание дописывает родителей после потомков, так что последняя
+		// нода самая внешняя
+		return len(nodes) - 1, len(nodes) > 0
+	}
+
+	for _, i := range preferred {
+		for index, node := range nodes {
+			if node.I.Eq(i) {
+				return index, true
+			}
+		}
+	}
+
+	return 0, false
+}
+
+// CoverAll разбирает terms грамматикой g и покрывает их фрагментами, как
+// Table.Cover. Для grammar.CNF фрагментами считаются и все цепочки, которые
+// начинаются с preferred, как в FindAll.
+func CoverAll(g Grammar, terms []Terminal, preferred []grammar.Ident) []ForestNode {
+	t := NewTable(len(terms))
+	t.Closure = g.Closure
+	for _, term := range terms {
+		t.AddTerminals(term, []grammar.Ident{term.Type}, g.Select)
+	}
+
+	variants, _ := chainVariants(g, preferred)
+	return t.Cover(variants)
+}
@@ -0,0 +1,94 @@
+package cyk_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	. "github.com/quenbyako/parser/cyk"
+	"github.com/quenbyako/parser/grammar"
+)
+
+func TestTable_Cover(t *testing.T) {
+	g, err := grammar.Parse("", strings.NewReader(`
+		S  : NP VP ;
+		VP : v NP | VP PP ;
+		NP : NP PP | n ;
+		PP : p NP ;
+	`), "n", "v", "p")
+	require.NoError(t, err)
+	cnf := g.AsCNF("S")
+
+	id := func(name string) grammar.Ident { return grammar.Ident{ID: name} }
+
+	for _, tt := range []struct {
+		name      string
+		input     string
+		preferred []grammar.Ident
+		expected  []string
+	}{{
+		name:      "complete sentence",
+		input:     "n v n",
+		preferred: []grammar.Ident{id("S"), id("NP"), id("VP")},
+		expected:  []string{"S" + XY{X: 2, Y: 0}.String()},
+	}, {
+		name:      "dangling preposition",
+		input:     "n v n p",
+		preferred: []grammar.Ident{id("S"), id("NP"), id("VP"), id("PP")},
+		expected:  []string{"S" + XY{X: 2, Y: 0}.String(), "p" + XY{X: 3, Y: 3}.String()},
+	}, {
+		name:      "only phrases",
+		input:     "n v n p n v",
+		preferred: []grammar.Ident{id("NP"), id("VP")},
+		expected: []string{
+			"NP" + XY{X: 0, Y: 0}.String(),
+			"VP" + XY{X: 4, Y: 1}.String(),
+			"v" + XY{X: 5, Y: 5}.String(),
+		},
+	}, {
+		name:     "anything",
+		input:    "v v n p n",
+		expected: []string{"v" + XY{X: 0, Y: 0}.String(), "VP" + XY{X: 4, Y: 1}.String()},
+	}} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			table := &Table{Closure: cnf.Closure}
+			for _, word := range strings.Fields(tt.input) {
+				term := terminal(g, word)
+				table.AddTerminals(Terminal{Type: term, Value: word}, []grammar.Ident{term}, cnf.Select)
+			}
+
+			var got []string
+			for _, node := range table.Cover(tt.preferred) {
+				got = append(got, node.String())
+			}
+			require.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+func TestCoverAll(t *testing.T) {
+	g, err := grammar.Parse("", strings.NewReader(`
+		NP : NP PP | n | A ;
+		A  : adj N2 ;
+		N2 : n ;
+		PP : p NP ;
+	`), "adj", "n", "p")
+	require.NoError(t, err)
+	cnf := g.AsCNF("NP")
+
+	var terms []Terminal
+	for _, word := range strings.Fields("adj n p") {
+		terms = append(terms, Terminal{Type: terminal(g, word), Value: word})
+	}
+
+	// NP над "adj n" стоит в ячейке под цепочкой NP -> A
+	np := grammar.Ident{ID: "NP"}
+	got := CoverAll(cnf, terms, []grammar.Ident{np})
+	require.Len(t, got, 2)
+	require.NotEqual(t, np, got[0].Ident())
+	require.Contains(t, cnf.Chains.Variants(np), got[0].Ident())
+	require.Equal(t, XY{X: 1, Y: 0}, got[0].Span())
+	require.Equal(t, "p"+XY{X: 2, Y: 2}.String(), got[1].String())
+}
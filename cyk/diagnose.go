@@ -0,0 +1,236 @@
+package cyk
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"text/scanner"
+
+	"github.com/quenbyako/parser/grammar"
+)
+
+// SyntaxError описывает, где вход перестал быть похожим на предложение
+// языка и что там ожидалось.
+type SyntaxError struct {
+	// Index это номер первого терминала, после которого вход уже не может
+	// быть началом ни одного предложения. Если весь вход это начало
+	// предложения, но не целое предложение, Index равен количеству
+	// терминалов, а Got пустой.
+	Index    int
+	Position scanner.Position
+	Got      *Terminal
+	// Expected это все терминалы и константы, которые могли бы стоять на
+	// месте Index, в порядке имен.
+	Expected []Expectation
+}
+
+// Expectation это один ожидаемый терминал или константа.
+type Expectation struct {
+	I grammar.Ident
+	// Name это символ так, как он пишется в грамматике: `noun<case="nom">`
+	// или `"("`.
+	Name string
+}
+
+func (e *SyntaxError) Error() string {
+	got := "end of input"
+	if e.Got != nil {
+		got = strconv.Quote(e.Got.Value)
+	}
+
+	names := make([]string, len(e.Expected))
+	for i, exp := range e.Expected {
+		names[i] = exp.Name
+	}
+	switch len(names) {
+	case 0:
+		return fmt.Sprintf("%v: unexpected %v", e.Position, got)
+	case 1:
+		return fmt.Sprintf("%v: unexpected %v, expected %v", e.Position, got, names[0])
+	default:
+		return fmt.Sprintf("%v: unexpected %v, expected %v or %v", e.Position, got, strings.Join(names[:len(names)-1], ", "), names[len(names)-1])
+	}
+}
+
+// Snippet возвращает строку src, на которой произошла ошибка, и каретку
+// под ее местом:
+//
+//	3 | det noun noun
+//	  |          ^
+//
+// Если Position не попадает в src, возвращает пустую строку.
+func (e *SyntaxError) Snippet(src string) string {
+	lines := strings.Split(src, "\n")
+	if e.Position.Line < 1 || e.Position.Line > len(lines) {
+		return ""
+	}
+	line := strings.TrimRight(lines[e.Position.Line-1], "\r")
+
+	// табы копируются, что бы каретка встала ровно под символом
+	var caret strings.Builder
+	for i, r := range []rune(line) {
+		if i >= e.Position.Column-1 {
+			break
+		}
+		if r == '\t' {
+			caret.WriteRune('\t')
+		} else {
+			caret.WriteRune(' ')
+		}
+	}
+
+	number := strconv.Itoa(e.Position.Line)
+	margin := strings.Repeat(" ", len(number))
+	return fmt.Sprintf("%v | %v\n%v | %v^", number, line, margin, caret.String())
+}
+
+// Diagnose разбирает terms и, если они не выводятся из корня грамматики,
+// возвращает ошибку с самым длинным началом входа, которое еще можно
+// дополнить до предложения, и всеми терминалами, которые могли бы идти
+// дальше. Ожидаемые символы считаются по грамматике: вход обрезается до
+// этого начала, и к нему по очереди пробуется дописать каждый терминал и
+// каждую константу. Для правильного входа возвращает nil, иначе
+// *SyntaxError.
+func Diagnose(g Grammar, terms []Terminal) error {
+	p := &prefixes{g: g, c: g.Compile(), t: NewTable(len(terms) + 1)}
+	p.t.Closure = g.Closure
+
+	index := 0
+	for ; index < len(terms); index++ {
+		p.t.AddTerminals(terms[index], []grammar.Ident{terms[index].Type}, g.Select)
+		if !p.viable() {
+			p.t.Truncate(index)
+			break
+		}
+	}
+	if index == len(terms) && p.accepts() {
+		return nil
+	}
+
+	res := &SyntaxError{Index: index}
+	if index < len(terms) {
+		res.Got = &terms[index]
+		res.Position = terms[index].Position
+	} else if len(terms) > 0 {
+		last := terms[len(terms)-1]
+		res.Position = advance(last.Position, last.Value)
+	}
+
+	for s := 0; s < p.c.Len(); s++ {
+		sym := grammar.Symbol(s)
+		if !p.c.IsTerminal(sym) {
+			continue
+		}
+
+		ident := p.c.Ident(sym)
+		p.t.AddTerminals(Terminal{Position: res.Position, Type: ident}, []grammar.Ident{ident}, g.Select)
+		if p.viable() {
+			res.Expected = append(res.Expected, Expectation{I: ident, Name: p.name(sym)})
+		}
+		p.t.Truncate(index)
+	}
+	sort.Slice(res.Expected, func(i, j int) bool { return res.Expected[i].Name < res.Expected[j].Name })
+
+	return res
+}
+
+// prefixes проверяет, что вход в таблице можно дополнить до предложения.
+type prefixes struct {
+	g Grammar
+	c *grammar.Compiled
+	t *Table
+}
+
+func (p *prefixes) accepts() bool {
+	if p.t.Len() == 0 {
+		return false
+	}
+
+	top := XY{X: p.t.Len() - 1, Y: 0}
+	for _, root := range p.g.Roots() {
+		if p.t.Has(top, root) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// viable сообщает, что весь вход в таблице это начало какого-нибудь
+// предложения. Для каждого i считаются символы A, для которых
+// A ⇒* w[i:n] β: либо A собран на этом отрезке целиком, либо он левый
+// потомок правила, либо правило собирает его из целого B на [i, k) и
+// такого же начала на [k, n).
+func (p *prefixes) viable() bool {
+	n := p.t.Len()
+	if n == 0 {
+		return true
+	}
+
+	open := make([][]bool, n)
+	for i := n - 1; i >= 0; i-- {
+		open[i] = make([]bool, p.c.Len())
+		var queue []grammar.Symbol
+		add := func(s grammar.Symbol) {
+			if !open[i][s] {
+				open[i][s] = true
+				queue = append(queue, s)
+			}
+		}
+
+		for _, node := range p.t.Cell(XY{X: n - 1, Y: i}) {
+			if s, ok := p.c.Lookup(node.I); ok {
+				add(s)
+			}
+		}
+		for k := i + 1; k < n; k++ {
+			for _, node := range p.t.Cell(XY{X: k - 1, Y: i}) {
+				left, ok := p.c.Lookup(node.I)
+				if !ok {
+					continue
+				}
+				for _, pair := range p.c.PairsOf(left) {
+					if open[k][pair.Right] {
+						for _, parent := range p.c.Combine(pair.Left, pair.Right) {
+							add(parent)
+						}
+					}
+				}
+			}
+		}
+
+		for len(queue) > 0 {
+			s := queue[len(queue)-1]
+			queue = queue[:len(queue)-1]
+			for _, parent := range p.c.Closure(s) {
+				add(parent)
+			}
+			// правый сосед может оказаться любым
+			for _, pair := range p.c.PairsOf(s) {
+				for _, parent := range p.c.Combine(pair.Left, pair.Right) {
+					add(parent)
+				}
+			}
+		}
+	}
+
+	for _, root := range p.c.Roots() {
+		if open[0][root] {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *prefixes) name(s grammar.Symbol) string {
+	if v, ok := p.c.Constant(s); ok {
+		return strconv.Quote(v)
+	}
+	if c, ok := p.c.Complex(s); ok {
+		return c.String()
+	}
+
+	return p.c.Ident(s).String()
+}
@@ -0,0 +1,89 @@
+package cyk_test
+
+import (
+	"strings"
+	"testing"
+	"text/scanner"
+
+	"github.com/stretchr/testify/require"
+
+	. "github.com/quenbyako/parser/cyk"
+	"github.com/quenbyako/parser/grammar"
+)
+
+func TestDiagnose(t *testing.T) {
+	g, err := grammar.Parse("", strings.NewReader(`
+		expr   : expr "+" term | term ;
+		term   : term "*" factor | factor ;
+		factor : "(" expr ")" | num ;
+	`), "num")
+	require.NoError(t, err)
+	cnf := g.AsCNF("expr")
+
+	ident := func(word string) grammar.Ident {
+		for hash, v := range g.Constants {
+			if v == word {
+				return grammar.Ident{ID: "CONST", AttrHash: hash}
+			}
+		}
+		return terminal(g, word)
+	}
+
+	for _, tt := range []struct {
+		name    string
+		src     string
+		err     string
+		snippet string
+	}{{
+		name: "valid",
+		src:  "num + num",
+	}, {
+		name:    "unexpected operator",
+		src:     "num +\n\t* num",
+		err:     `src:2:2: unexpected "*", expected "(" or num`,
+		snippet: "2 | \t* num\n  | \t^",
+	}, {
+		name:    "unclosed bracket",
+		src:     "( num",
+		err:     `src:1:6: unexpected end of input, expected ")", "*" or "+"`,
+		snippet: "1 | ( num\n  |      ^",
+	}, {
+		name:    "first token",
+		src:     ") num",
+		err:     `src:1:1: unexpected ")", expected "(" or num`,
+		snippet: "1 | ) num\n  | ^",
+	}} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var terms []Terminal
+			for line, text := range strings.Split(tt.src, "\n") {
+				for column := 0; column < len(text); column++ {
+					if text[column] == ' ' || text[column] == '\t' {
+						continue
+					}
+					end := strings.IndexAny(text[column:], " \t")
+					if end < 0 {
+						end = len(text) - column
+					}
+					word := text[column : column+end]
+					terms = append(terms, Terminal{
+						Position: scanner.Position{Filename: "src", Line: line + 1, Column: column + 1},
+						Type:     ident(word),
+						Value:    word,
+					})
+					column += end
+				}
+			}
+
+			err := Diagnose(cnf, terms)
+			if tt.err == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.EqualError(t, err, tt.err)
+			var syntax *SyntaxError
+			require.ErrorAs(t, err, &syntax)
+			require.Equal(t, tt.snippet, syntax.Snippet(tt.src))
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package cyk
+
+import (
+	"github.com/quenbyako/parser/grammar"
+)
+
+// Recognizer это инкрементальный распознаватель Эрли поверх бинаризованной
+// грамматики. В отличие от Table он не строит разбор, зато после каждого
+// терминала знает, какие терминалы могут идти следующими, и отказывается
+// принимать те, после которых вход уже нельзя дополнить до предложения.
+//
+// Множества Эрли после добавления не меняются, так что Truncate стоит
+// O(1), а копия распознавателя (Fork) делит с оригиналом всю историю.
+type Recognizer struct {
+	e    *earley
+	sets []*earleySet
+}
+
+// earley это то, что распознаватель знает о грамматике.
+type earley struct {
+	c *grammar.Compiled
+	// starts[a] это символы, с которых может начинаться правило a: левые
+	// символы его бинарных правил и потомки унарных.
+	starts [][]grammar.Symbol
+}
+
+// earleySet это множество Эрли для позиции j: какие символы здесь
+// предсказаны, какие правила ждут здесь свой правый символ и какие символы
+// закончились здесь.
+type earleySet struct {
+	predicted bitset
+	// waiting[s] это правила A → B s, у которых B уже собран на [origin, j).
+	waiting map[grammar.Symbol][]earleyItem
+	done    map[earleyItem]struct{}
+}
+
+// earleyItem это нетерминал symbol, который начался в origin.
+type earleyItem struct {
+	symbol grammar.Symbol
+	origin int
+}
+
+// NewRecognizer возвращает распознаватель пустого входа, который ждет
+// начало предложения грамматики g.
+func NewRecognizer(g Grammar) *Recognizer {
+	c := g.Compile()
+	e := &earley{c: c, starts: make([][]grammar.Symbol, c.Len())}
+	for s := 0; s < c.Len(); s++ {
+		sym := grammar.Symbol(s)
+		for _, parent := range c.Closure(sym) {
+			e.starts[parent] = append(e.starts[parent], sym)
+		}
+	}
+	for p, pair := range c.Pairs() {
+		for _, parent := range c.Parents(p) {
+			e.starts[parent] = append(e.starts[parent], pair.Left)
+		}
+	}
+
+	first := e.newSet()
+	for _, root := range c.Roots() {
+		e.predict(first, root)
+	}
+
+	return &Recognizer{e: e, sets: []*earleySet{first}}
+}
+
+func (e *earley) newSet() *earleySet {
+	return &earleySet{
+		predicted: newBitset(e.c.Len()),
+		waiting:   make(map[grammar.Symbol][]earleyItem),
+		done:      make(map[earleyItem]struct{}),
+	}
+}
+
+func (e *earley) predict(set *earleySet, s grammar.Symbol) {
+	if set.predicted.has(int(s)) {
+		return
+	}
+	set.predicted.set(int(s))
+	for _, child := range e.starts[s] {
+		e.predict(set, child)
+	}
+}
+
+// Len возвращает количество принятых терминалов.
+func (r *Recognizer) Len() int { return len(r.sets) - 1 }
+
+// Feed принимает следующий терминал. Если после него вход уже не может
+// быть началом предложения, возвращает false и ничего не меняет.
+//
+// i это терминал самой грамматики (как его возвращает Allowed), а не
+// входной терминал с атрибутами: селекторы здесь не сопоставляются, так
+// что для разбора обычного входа нужен g.Select, как в Diagnose.
+func (r *Recognizer) Feed(i grammar.Ident) bool {
+	s, ok := r.e.c.Lookup(i)
+	if !ok {
+		return false
+	}
+
+	return r.feed(s)
+}
+
+func (r *Recognizer) feed(s grammar.Symbol) bool {
+	if !r.e.c.IsTerminal(s) || !r.last().predicted.has(int(s)) {
+		return false
+	}
+
+	set := r.e.newSet()
+	r.sets = append(r.sets, set)
+	r.complete(set, earleyItem{symbol: s, origin: len(r.sets) - 2})
+
+	return true
+}
+
+// complete отмечает, что item закончился в последнем множестве set, и
+// продвигает все правила, которые его ждали.
+func (r *Recognizer) complete(set *earleySet, item earleyItem) {
+	if _, ok := set.done[item]; ok {
+		return
+	}
+	set.done[item] = struct{}{}
+
+	c, from := r.e.c, r.sets[item.origin]
+	for _, parent := range c.Closure(item.symbol) {
+		if from.predicted.has(int(parent)) {
+			r.complete(set, earleyItem{symbol: parent, origin: item.origin})
+		}
+	}
+	for _, pair := range c.PairsOf(item.symbol) {
+		for _, parent := range c.Combine(pair.Left, pair.Right) {
+			if from.predicted.has(int(parent)) {
+				set.waiting[pair.Right] = append(set.waiting[pair.Right], earleyItem{symbol: parent, origin: item.origin})
+				r.e.predict(set, pair.Right)
+			}
+		}
+	}
+	for _, parent := range from.waiting[item.symbol] {
+		r.complete(set, parent)
+	}
+}
+
+func (r *Recognizer) last() *earleySet { return r.sets[len(r.sets)-1] }
+
+// Truncate оставляет только первые n терминалов.
+func (r *Recognizer) Truncate(n int) {
+	if n < 0 || n > r.Len() {
+		panic("index out of range")
+	}
+	// емкость тоже обрезается: хвост массива может принадлежать копиям из
+	// Fork, и новые множества не должны писаться поверх них
+	r.sets = r.sets[: n+1 : n+1]
+}
+
+// Fork возвращает копию распознавателя, которую можно кормить независимо
+// от оригинала.
+func (r *Recognizer) Fork() *Recognizer {
+	return &Recognizer{e: r.e, sets: r.sets[:len(r.sets):len(r.sets)]}
+}
+
+// Accepts сообщает, что принятые терминалы это целое предложение.
+func (r *Recognizer) Accepts() bool {
+	if r.Len() == 0 {
+		return false
+	}
+
+	for _, root := range r.e.c.Roots() {
+		if _, ok := r.last().done[earleyItem{symbol: root}]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Allowed возвращает терминалы и константы, которые может принять Feed, в
+// порядке номеров символов.
+func (r *Recognizer) Allowed() []grammar.Ident {
+	c := r.e.c
+	var res []grammar.Ident
+	r.last().predicted.each(0, c.Len(), func(s int) {
+		if c.IsTerminal(grammar.Symbol(s)) {
+			res = append(res, c.Ident(grammar.Symbol(s)))
+		}
+	})
+
+	return res
+}
@@ -0,0 +1,71 @@
+package cyk_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	. "github.com/quenbyako/parser/cyk"
+	"github.com/quenbyako/parser/grammar"
+	"github.com/quenbyako/parser/slices"
+)
+
+func TestRecognizer(t *testing.T) {
+	g, err := grammar.Parse("", strings.NewReader(`
+		expr   : expr "+" term | term ;
+		term   : term "*" factor | factor ;
+		factor : "(" expr ")" | num ;
+	`), "num")
+	require.NoError(t, err)
+
+	ident := func(word string) grammar.Ident {
+		for hash, v := range g.Constants {
+			if v == word {
+				return grammar.Ident{ID: "CONST", AttrHash: hash}
+			}
+		}
+		return terminal(g, word)
+	}
+	allowed := func(r *Recognizer) []grammar.Ident {
+		return slices.SortFunc(r.Allowed(), func(a, b grammar.Ident) bool { return a.Cmp(b) < 0 })
+	}
+	idents := func(words ...string) []grammar.Ident {
+		return slices.SortFunc(slices.Remap(words, func(_ int, w string) grammar.Ident { return ident(w) }), func(a, b grammar.Ident) bool { return a.Cmp(b) < 0 })
+	}
+
+	for _, g := range []Grammar{g.AsCNF("expr"), g.AsBNF().As2NF("expr")} {
+		r := NewRecognizer(g)
+		require.Equal(t, idents("(", "num"), allowed(r))
+		require.False(t, r.Accepts())
+
+		require.True(t, r.Feed(ident("(")))
+		require.True(t, r.Feed(ident("num")))
+		require.Equal(t, idents(")", "*", "+"), allowed(r))
+		require.False(t, r.Feed(ident("num")))
+		require.Equal(t, 2, r.Len())
+
+		fork := r.Fork()
+		require.True(t, fork.Feed(ident(")")))
+		require.True(t, fork.Accepts())
+		require.False(t, r.Accepts())
+
+		require.True(t, r.Feed(ident("+")))
+		require.Equal(t, idents("(", "num"), allowed(r))
+
+		// обрезка и новые терминалы оригинала не портят копию
+		kept := r.Fork()
+		r.Truncate(0)
+		require.Equal(t, idents("(", "num"), allowed(r))
+		require.True(t, r.Feed(ident("num")))
+		require.True(t, r.Feed(ident("*")))
+		require.True(t, r.Feed(ident("num")))
+		require.True(t, r.Accepts())
+
+		require.Equal(t, 3, kept.Len())
+		require.Equal(t, idents("(", "num"), allowed(kept))
+		require.True(t, kept.Feed(ident("num")))
+		require.True(t, kept.Feed(ident(")")))
+		require.True(t, kept.Accepts())
+	}
+}
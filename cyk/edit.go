@@ -0,0 +1,183 @@
+package cyk
+
+import (
+	"fmt"
+
+	"github.com/quenbyako/parser/grammar"
+)
+
+// Truncate оставляет в таблице только первые n терминалов. Ничего
+// пересчитывать не нужно: ячейки первых n колонок от остальных не зависят.
+func (t *Table) Truncate(n int) {
+	t.checkLinear()
+	if n < 0 || n > len(t.terms) {
+		panic(fmt.Sprintf("can't truncate table of %d terminals to %d", len(t.terms), n))
+	}
+
+	t.terms = t.terms[:n]
+	t.nonterms = t.nonterms[:n]
+	t.cells = t.cells[:cellsCount(n)]
+}
+
+// ReplaceTerminal заменяет i-й терминал. Пересчитываются только отрезки,
+// которые его содержат, все остальные ячейки остаются как есть.
+func (t *Table) ReplaceTerminal(i int, term Terminal, nonterms []grammar.Ident, selector selectorFunc) {
+	t.checkIndex(i, len(t.terms)-1)
+
+	t.terms[i] = term
+	t.nonterms[i] = nonterms
+	t.setTerminal(i, nonterms)
+	t.recalculateCrossing(i, i, selector)
+}
+
+// InsertTerminal вставляет терминал перед i-м (при i == Len() это то же
+// самое, что AddTerminals). Отрезки справа от i только сдвигаются вместе со
+// своими координатами, пересчитываются только те, что содержат новый
+// терминал. Если задан Filter, сдвигать ячейки нельзя (фильтр зависит от
+// координат), так что все колонки от i собираются заново.
+func (t *Table) InsertTerminal(i int, term Terminal, nonterms []grammar.Ident, selector selectorFunc) {
+	t.checkIndex(i, len(t.terms))
+
+	t.terms = append(t.terms, Terminal{})
+	copy(t.terms[i+1:], t.terms[i:])
+	t.terms[i] = term
+	t.nonterms = append(t.nonterms, nil)
+	copy(t.nonterms[i+1:], t.nonterms[i:])
+	t.nonterms[i] = nonterms
+	t.growColumn()
+	if t.Filter != nil {
+		t.refill(i, selector)
+		return
+	}
+
+	// идем с конца, что бы не затереть ячейку, которую еще не сдвинули
+	for x := len(t.terms) - 1; x > i; x-- {
+		for y := x; y > i; y-- {
+			t.cells[spanIndex(XY{X: x, Y: y})] = shiftCell(t.cells[spanIndex(XY{X: x - 1, Y: y - 1})], 1)
+		}
+	}
+	// в оставшихся ячейках лежат слайсы, которые уже переехали, их нельзя
+	// переиспользовать
+	t.forgetCrossing(i, i)
+
+	t.setTerminal(i, nonterms)
+	t.recalculateCrossing(i, i, selector)
+}
+
+// RemoveTerminal удаляет i-й терминал. Отрезки справа сдвигаются, а
+// пересчитываются только те, что теперь соединяют соседей удаленного
+// терминала. Если задан Filter, все колонки от i собираются заново, как в
+// InsertTerminal.
+func (t *Table) RemoveTerminal(i int, selector selectorFunc) {
+	t.checkIndex(i, len(t.terms)-1)
+
+	n := len(t.terms) - 1
+	copy(t.terms[i:], t.terms[i+1:])
+	t.terms = t.terms[:n]
+	copy(t.nonterms[i:], t.nonterms[i+1:])
+	t.nonterms = t.nonterms[:n]
+	if t.Filter != nil {
+		for y := 0; y <= n; y++ {
+			t.cells[spanIndex(XY{X: n, Y: y})] = nil
+		}
+		t.cells = t.cells[:cellsCount(n)]
+		t.refill(i, selector)
+		return
+	}
+
+	for x := i; x < n; x++ {
+		for y := i; y <= x; y++ {
+			t.cells[spanIndex(XY{X: x, Y: y})] = shiftCell(t.cells[spanIndex(XY{X: x + 1, Y: y + 1})], -1)
+		}
+	}
+	// последняя колонка уходит за пределы таблицы, но ее слайсы уже
+	// переехали, так что growColumn не должен их переиспользовать
+	for y := 0; y <= n; y++ {
+		t.cells[spanIndex(XY{X: n, Y: y})] = nil
+	}
+	t.cells = t.cells[:cellsCount(n)]
+	t.forgetCrossing(i, i-1)
+
+	t.recalculateCrossing(i, i-1, selector)
+}
+
+func (t *Table) checkIndex(i, max int) {
+	t.checkLinear()
+	if i < 0 || i > max {
+		panic(fmt.Sprintf("terminal index %d out of bounds [0:%d]", i, max))
+	}
+}
+
+func (t *Table) checkLinear() {
+	if t.lattice != nil {
+		panic("can't edit table filled from a lattice")
+	}
+}
+
+func (t *Table) setTerminal(i int, nonterms []grammar.Ident) {
+	cell := termxy(i)
+	nodes := t.cells[spanIndex(cell)][:0]
+	for _, id := range nonterms {
+		if t.Filter != nil && !t.Filter(cell, id) {
+			continue
+		}
+		nodes = pack(nodes, id, Derivation{Left: noCoord, Bottom: noCoord})
+	}
+	t.cells[spanIndex(cell)] = t.closeCell(cell, nodes)
+	t.prune(cell)
+}
+
+// recalculateCrossing пересчитывает все недиагональные ячейки, у которых
+// X >= lo и Y <= hi, то есть все отрезки, которые задевает правка.
+// Колонки идут слева направо, а внутри колонки снизу вверх, так что к
+// моменту расчета ячейки все ее соседи уже готовы.
+func (t *Table) recalculateCrossing(lo, hi int, selector selectorFunc) {
+	for x := lo; x < len(t.terms); x++ {
+		y := hi
+		if y > x-1 {
+			y = x - 1
+		}
+		for ; y >= 0; y-- {
+			t.FillCell(XY{X: x, Y: y}, selector)
+		}
+	}
+}
+
+// refill собирает заново все ячейки колонок от lo, включая терминальные.
+func (t *Table) refill(lo int, selector selectorFunc) {
+	t.forgetCrossing(lo, len(t.terms)-1)
+	for x := lo; x < len(t.terms); x++ {
+		t.setTerminal(x, t.nonterms[x])
+	}
+	t.recalculateCrossing(lo, len(t.terms)-1, selector)
+}
+
+func (t *Table) forgetCrossing(lo, hi int) {
+	for x := lo; x < len(t.terms); x++ {
+		for y := 0; y <= hi && y <= x; y++ {
+			t.cells[spanIndex(XY{X: x, Y: y})] = nil
+		}
+	}
+}
+
+// shiftCell сдвигает координаты потомков всех нод ячейки на delta по обеим
+// осям. Ячейка при этом меняется на месте.
+func shiftCell(nodes []NonTerminal, delta int) []NonTerminal {
+	for i := range nodes {
+		for j, d := range nodes[i].Derivations {
+			nodes[i].Derivations[j] = Derivation{Left: d.Left.shift(delta), Bottom: d.Bottom.shift(delta)}
+		}
+	}
+
+	return nodes
+}
+
+func (c NonTerminalCoord) shift(delta int) NonTerminalCoord {
+	if c == noCoord {
+		return c
+	}
+
+	c.X += delta
+	c.Y += delta
+	return c
+}
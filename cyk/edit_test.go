@@ -0,0 +1,98 @@
+package cyk_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	. "github.com/quenbyako/parser/cyk"
+	"github.com/quenbyako/parser/grammar"
+)
+
+func TestTable_Edit(t *testing.T) {
+	g, err := grammar.Parse("", strings.NewReader(exprGrammar), "num")
+	require.NoError(t, err)
+	cnf := g.AsCNF("expr")
+
+	build := func(input string) *Table {
+		table := &Table{Closure: cnf.Closure}
+		for _, term := range sentence(g, input) {
+			table.AddTerminals(term, []grammar.Ident{term.Type}, cnf.Select)
+		}
+		return table
+	}
+	edit := func(table *Table, f func(*Table, Terminal, []grammar.Ident)) {
+		term := sentence(g, "*")[0]
+		f(table, term, []grammar.Ident{term.Type})
+	}
+
+	for _, tt := range []struct {
+		name     string
+		input    string
+		edit     func(*Table, Terminal, []grammar.Ident)
+		expected string
+	}{{
+		name:     "truncate",
+		input:    "( num + num ) * num",
+		edit:     func(t *Table, _ Terminal, _ []grammar.Ident) { t.Truncate(4) },
+		expected: "( num + num",
+	}, {
+		name:  "replace",
+		input: "( num + num ) * num",
+		edit: func(t *Table, term Terminal, nonterms []grammar.Ident) {
+			t.ReplaceTerminal(2, term, nonterms, cnf.Select)
+		},
+		expected: "( num * num ) * num",
+	}, {
+		name:  "insert",
+		input: "( num + num ) num",
+		edit: func(t *Table, term Terminal, nonterms []grammar.Ident) {
+			t.InsertTerminal(5, term, nonterms, cnf.Select)
+		},
+		expected: "( num + num ) * num",
+	}, {
+		name:  "insert first",
+		input: "num * num",
+		edit: func(t *Table, term Terminal, nonterms []grammar.Ident) {
+			t.InsertTerminal(0, term, nonterms, cnf.Select)
+		},
+		expected: "* num * num",
+	}, {
+		name:  "insert last",
+		input: "num * num",
+		edit: func(t *Table, term Terminal, nonterms []grammar.Ident) {
+			t.InsertTerminal(3, term, nonterms, cnf.Select)
+		},
+		expected: "num * num *",
+	}, {
+		name:  "remove",
+		input: "( num + + num ) * num",
+		edit: func(t *Table, _ Terminal, _ []grammar.Ident) {
+			t.RemoveTerminal(3, cnf.Select)
+		},
+		expected: "( num + num ) * num",
+	}, {
+		name:  "remove and insert",
+		input: "num + num * num",
+		edit: func(t *Table, term Terminal, nonterms []grammar.Ident) {
+			t.RemoveTerminal(1, cnf.Select)
+			t.InsertTerminal(1, term, nonterms, cnf.Select)
+		},
+		expected: "num * num * num",
+	}} {
+		t.Run(tt.name, func(t *testing.T) {
+			got := build(tt.input)
+			edit(got, tt.edit)
+			expected := build(tt.expected)
+
+			require.Equal(t, expected.Len(), got.Len())
+			for y := 0; y < expected.Len(); y++ {
+				for x := y; x < expected.Len(); x++ {
+					cell := XY{X: x, Y: y}
+					require.Equal(t, append([]NonTerminal{}, expected.Cell(cell)...), append([]NonTerminal{}, got.Cell(cell)...), "at %v", cell)
+				}
+			}
+		})
+	}
+}
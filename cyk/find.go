@@ -0,0 +1,167 @@
+package cyk
+
+import (
+	"text/scanner"
+	"unicode/utf8"
+
+	"github.com/quenbyako/parser/grammar"
+)
+
+// Match это одно вхождение искомого нетерминала в текст.
+type Match struct {
+	ForestNode
+	// Target это искомый нетерминал. В таблице для CNF на его месте может
+	// стоять сгенерированная цепочка (см. grammar.ChainList.Variants), тогда
+	// Ident у ноды будет другим.
+	Target grammar.Ident
+	// Start это позиция первого терминала отрезка, End — позиция сразу за
+	// последним, так что Start.Offset:End.Offset это текст вхождения.
+	Start, End scanner.Position
+}
+
+// Find возвращает все отрезки таблицы, которые выводят один из targets,
+// без разбора всего предложения целиком. Если overlapping true,
+// возвращаются вообще все вхождения, упорядоченные по началу, а при равном
+// начале — от длинных к коротким. Иначе вхождения не пересекаются и
+// выбираются как в regexp: слева направо, на каждой позиции самое длинное,
+// а при равной длине — то, что раньше в targets.
+func (t *Table) Find(targets []grammar.Ident, overlapping bool) []Match {
+	var res []Match
+columns:
+	for y := 0; y < len(t.terms); y++ {
+		for x := len(t.terms) - 1; x >= y; x-- {
+			cell := XY{X: x, Y: y}
+			for _, target := range targets {
+				for index, node := range t.Cell(cell) {
+					if !node.I.Eq(target) {
+						continue
+					}
+
+					res = append(res, t.match(target, NonTerminalCoord{XY: cell, Index: index}))
+					if !overlapping {
+						// самое длинное на этой позиции найдено первым,
+						// следующее вхождение ищем сразу за ним
+						y = x
+						continue columns
+					}
+				}
+			}
+		}
+	}
+
+	return res
+}
+
+func (t *Table) match(target grammar.Ident, c NonTerminalCoord) Match {
+	first, last := t.edgeTerminal(c, false), t.edgeTerminal(c, true)
+	return Match{
+		ForestNode: ForestNode{f: t.Forest(target), coord: c},
+		Target:     target,
+		Start:      first.Position,
+		End:        advance(last.Position, last.Value),
+	}
+}
+
+// edgeTerminal возвращает первый (или, если right, последний) терминал
+// ноды c, предпочитая первые выводы. В решетке слов на одной позиции могут
+// начинаться разные дуги, так что терминал берется из самого разбора. Если
+// все выводы ноды уходят в цикл по унарным правилам (так бывает в режиме
+// Витерби с весами больше 1), берется терминал позиции таблицы.
+func (t *Table) edgeTerminal(c NonTerminalCoord, right bool) Terminal {
+	if term, ok := t.findEdge(c, right, make(map[NonTerminalCoord]struct{})); ok {
+		return term
+	}
+	if right {
+		return t.terms[c.X]
+	}
+
+	return t.terms[c.Y]
+}
+
+// findEdge ищет крайний лист в глубину. Ноды, где уже были, пропускаются,
+// так что унарные циклы не зацикливают поиск.
+func (t *Table) findEdge(c NonTerminalCoord, right bool, visited map[NonTerminalCoord]struct{}) (Terminal, bool) {
+	if _, ok := visited[c]; ok {
+		return Terminal{}, false
+	}
+	visited[c] = struct{}{}
+
+	for _, d := range t.node(c).Derivations {
+		next := d.Left
+		switch {
+		case d.IsLeaf():
+			return t.leaf(c.XY, d), true
+		case right && !d.IsUnit():
+			next = d.Bottom
+		}
+		if term, ok := t.findEdge(next, right, visited); ok {
+			return term, true
+		}
+	}
+
+	return Terminal{}, false
+}
+
+// advance возвращает позицию сразу за текстом value, который начинается в
+// pos.
+func advance(pos scanner.Position, value string) scanner.Position {
+	pos.Offset += len(value)
+	for len(value) > 0 {
+		r, size := utf8.DecodeRuneInString(value)
+		value = value[size:]
+		if r == '\n' {
+			pos.Line++
+			pos.Column = 1
+			continue
+		}
+		pos.Column++
+	}
+
+	return pos
+}
+
+// FindAll разбирает terms грамматикой g и возвращает непересекающиеся
+// вхождения targets, как Table.Find. Для grammar.CNF искомыми считаются и
+// все цепочки, которые начинаются с targets.
+func FindAll(g Grammar, terms []Terminal, targets []grammar.Ident) []Match {
+	t := NewTable(len(terms))
+	t.Closure = g.Closure
+	for _, term := range terms {
+		t.AddTerminals(term, []grammar.Ident{term.Type}, g.Select)
+	}
+
+	variants, origin := chainVariants(g, targets)
+	res := t.Find(variants, false)
+	for i := range res {
+		res[i].Target = origin[res[i].Target]
+	}
+
+	return res
+}
+
+// chainVariants возвращает targets вместе со всеми цепочками grammar.CNF,
+// которые с них начинаются, и для каждого варианта — исходный target.
+// Варианты одного нетерминала идут подряд, так что порядок targets
+// сохраняется.
+func chainVariants(g Grammar, targets []grammar.Ident) ([]grammar.Ident, map[grammar.Ident]grammar.Ident) {
+	origin := make(map[grammar.Ident]grammar.Ident)
+	cnf, ok := g.(*grammar.CNF)
+	if !ok {
+		for _, target := range targets {
+			origin[target] = target
+		}
+		return targets, origin
+	}
+
+	var variants []grammar.Ident
+	for _, target := range targets {
+		for _, v := range cnf.Chains.Variants(target) {
+			if _, ok := origin[v]; !ok {
+				origin[v] = target
+				variants = append(variants, v)
+			}
+		}
+	}
+
+	return variants, origin
+}
@@ -0,0 +1,107 @@
+package cyk_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"text/scanner"
+
+	"github.com/stretchr/testify/require"
+
+	. "github.com/quenbyako/parser/cyk"
+	"github.com/quenbyako/parser/grammar"
+)
+
+func TestFindAll(t *testing.T) {
+	g, err := grammar.Parse("", strings.NewReader(`
+		date   : num month | month num ;
+		money  : num cur | cur num ;
+		amount : money ;
+	`), "num", "month", "cur", "word")
+	require.NoError(t, err)
+	cnf := g.AsCNF("date")
+
+	// слова "word" в правилах нет, так что в g.Terminals его тоже нет
+	ident := func(kind string) grammar.Ident {
+		hash, _ := grammar.ComplexIdent{ID: kind}.Hash()
+		return grammar.Ident{ID: kind, AttrHash: hash}
+	}
+
+	const text = "paid 5 usd\non 3 may 4 usd"
+	var terms []Terminal
+	for offset, line := 0, 1; offset < len(text); {
+		end := strings.IndexAny(text[offset:], " \n")
+		if end < 0 {
+			end = len(text) - offset
+		}
+		word := text[offset : offset+end]
+
+		kind := "word"
+		switch {
+		case word == "usd":
+			kind = "cur"
+		case word == "may":
+			kind = "month"
+		case strings.Trim(word, "0123456789") == "":
+			kind = "num"
+		}
+		column := offset + 1 - (strings.LastIndex(text[:offset], "\n") + 1)
+		terms = append(terms, Terminal{
+			Position: scanner.Position{Offset: offset, Line: line, Column: column},
+			Type:     ident(kind),
+			Value:    word,
+		})
+
+		offset += end
+		if offset < len(text) && text[offset] == '\n' {
+			line++
+		}
+		offset++
+	}
+
+	format := func(matches []Match) (res []string) {
+		for _, m := range matches {
+			res = append(res, fmt.Sprintf("%v %q %v:%v-%v:%v", m.Target, text[m.Start.Offset:m.End.Offset], m.Start.Line, m.Start.Column, m.End.Line, m.End.Column))
+		}
+		return res
+	}
+
+	targets := []grammar.Ident{{ID: "date"}, {ID: "amount"}}
+	require.Equal(t, []string{
+		`amount "5 usd" 1:6-1:11`,
+		`date "3 may" 2:4-2:9`,
+		`amount "4 usd" 2:10-2:15`,
+	}, format(FindAll(cnf, terms, targets)))
+
+	table := &Table{Closure: cnf.Closure}
+	for _, term := range terms {
+		table.AddTerminals(term, []grammar.Ident{term.Type}, cnf.Select)
+	}
+	require.Equal(t, []string{
+		`money "5 usd" 1:6-1:11`,
+		`date "3 may" 2:4-2:9`,
+		`date "may 4" 2:6-2:11`,
+		`money "4 usd" 2:10-2:15`,
+	}, format(table.Find([]grammar.Ident{{ID: "date"}, {ID: "money"}}, true)))
+}
+
+// с весами больше 1 каждый проход замыкания улучшает A и B друг через
+// друга, и в конце лучшие выводы A и B ссылаются друг на друга
+func TestTable_FindUnitCycle(t *testing.T) {
+	g, err := grammar.Parse("", strings.NewReader(`
+		S : A ;
+		A : B | a ;
+		B : A | b ;
+	`), "a", "b")
+	require.NoError(t, err)
+	nf := g.AsBNF().As2NF("S")
+
+	table := &Table{Closure: nf.Closure, Weight: func(grammar.Ident, ...grammar.Ident) float64 { return 2 }}
+	term := Terminal{Position: scanner.Position{Offset: 0, Line: 1, Column: 1}, Type: terminal(g, "a"), Value: "a"}
+	table.AddTerminals(term, []grammar.Ident{term.Type}, nf.Select)
+
+	matches := table.Find([]grammar.Ident{{ID: "S"}}, false)
+	require.Len(t, matches, 1)
+	require.Equal(t, 1, matches[0].Start.Column)
+	require.Equal(t, 2, matches[0].End.Column)
+}
@@ -0,0 +1,173 @@
+package cyk
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/quenbyako/parser/grammar"
+)
+
+// Forest это упакованный лес разбора (SPPF) поверх заполненной Table. Каждая
+// нода леса это нетерминал на отрезке, а ее альтернативы — все способы
+// собрать его из потомков. Общие поддеревья хранятся один раз, так что даже
+// экспоненциальное количество деревьев разбора занимает O(n³) памяти.
+//
+// Лес смотрит прямо в ячейки таблицы и становится невалидным после любой ее
+// правки или Reset.
+type Forest struct {
+	t     *Table
+	roots []grammar.Ident
+}
+
+// Forest возвращает лес разбора, который хранится в таблице. roots это
+// нетерминалы, которые могут стоять в корне разбора (см. Grammar.Roots): по
+// ним считаются и перебираются деревья всего предложения.
+func (t *Table) Forest(roots ...grammar.Ident) Forest { return Forest{t: t, roots: roots} }
+
+// Roots возвращает ноды корневых нетерминалов, которые выводят все
+// предложение, в том порядке, в котором корни переданы в Table.Forest.
+func (f Forest) Roots() []ForestNode {
+	res := make([]ForestNode, 0, len(f.roots))
+	for _, i := range f.roots {
+		if n, ok := f.Root(i); ok {
+			res = append(res, n)
+		}
+	}
+
+	return res
+}
+
+// Best возвращает самый вероятный из корней. Имеет смысл только для
+// таблицы, заполненной в режиме Витерби: тогда у корня ровно одно дерево,
+// и оно самое вероятное.
+func (f Forest) Best() (_ ForestNode, ok bool) {
+	var best ForestNode
+	for _, root := range f.Roots() {
+		if !ok || root.Score() > best.Score() {
+			best, ok = root, true
+		}
+	}
+
+	return best, ok
+}
+
+// Root возвращает ноду нетерминала i, который выводит все предложение.
+func (f Forest) Root(i grammar.Ident) (ForestNode, bool) {
+	if f.t.Len() == 0 {
+		return ForestNode{}, false
+	}
+
+	return f.Node(XY{X: f.t.Len() - 1, Y: 0}, i)
+}
+
+// Node возвращает ноду нетерминала i на отрезке cell.
+func (f Forest) Node(cell XY, i grammar.Ident) (ForestNode, bool) {
+	for index, n := range f.t.Cell(cell) {
+		if n.I.Eq(i) {
+			return ForestNode{f: f, coord: NonTerminalCoord{XY: cell, Index: index}}, true
+		}
+	}
+
+	return ForestNode{}, false
+}
+
+// Each обходит в глубину все ноды, достижимые из root, каждую ровно один
+// раз, даже если унарные правила образуют цикл. Потомки посещаются раньше
+// родителя. Если fn возвращает false, обход прекращается.
+func (f Forest) Each(root ForestNode, fn func(ForestNode) bool) {
+	seen := make(map[NonTerminalCoord]struct{})
+
+	var walk func(n ForestNode) bool
+	walk = func(n ForestNode) bool {
+		if _, ok := seen[n.coord]; ok {
+			return true
+		}
+		seen[n.coord] = struct{}{}
+
+		for _, alt := range n.Alternatives() {
+			for _, child := range alt.Children {
+				if !walk(child) {
+					return false
+				}
+			}
+		}
+
+		return fn(n)
+	}
+
+	walk(root)
+}
+
+// ForestNode это упакованная нода леса: нетерминал вместе с отрезком,
+// который он выводит.
+type ForestNode struct {
+	f     Forest
+	coord NonTerminalCoord
+}
+
+func (n ForestNode) node() NonTerminal { return n.f.t.cells[spanIndex(n.coord.XY)][n.coord.Index] }
+
+func (n ForestNode) Ident() grammar.Ident { return n.node().I }
+
+// Span возвращает отрезок предложения, который выводит нода: от терминала Y
+// до терминала X включительно.
+func (n ForestNode) Span() XY { return n.coord.XY }
+
+// Coord возвращает положение ноды в таблице.
+func (n ForestNode) Coord() NonTerminalCoord { return n.coord }
+
+// Score возвращает логарифм вероятности лучшего вывода ноды (см.
+// NonTerminal.Score).
+func (n ForestNode) Score() float64 { return n.node().Score }
+
+// IsAmbiguous сообщает, что у ноды больше одной альтернативы.
+func (n ForestNode) IsAmbiguous() bool { return n.node().IsAmbiguous() }
+
+// Terminal возвращает терминал, вместе с которым нода попала в таблицу. Для
+// нод, у которых нет вывода-листа, ok будет false.
+func (n ForestNode) Terminal() (_ Terminal, ok bool) {
+	for _, d := range n.node().Derivations {
+		if d.IsLeaf() {
+			return n.f.t.leaf(n.coord.XY, d), true
+		}
+	}
+
+	return Terminal{}, false
+}
+
+// Alternatives возвращает все упакованные альтернативы ноды в том порядке,
+// в котором их нашла таблица.
+func (n ForestNode) Alternatives() []Alternative {
+	derivations := n.node().Derivations
+	res := make([]Alternative, len(derivations))
+	for i, d := range derivations {
+		switch {
+		case d.IsLeaf():
+		case d.IsUnit():
+			res[i].Children = []ForestNode{n.child(d.Left)}
+		default:
+			res[i].Children = []ForestNode{n.child(d.Left), n.child(d.Bottom)}
+		}
+	}
+
+	return res
+}
+
+// Count возвращает количество деревьев разбора с корнем в этой ноде.
+func (n ForestNode) Count() *big.Int {
+	res, _ := newCounter(n.f).count(n.coord)
+	return res
+}
+
+func (n ForestNode) child(c NonTerminalCoord) ForestNode { return ForestNode{f: n.f, coord: c} }
+
+func (n ForestNode) String() string { return fmt.Sprintf("%v%v", n.Ident(), n.coord.XY) }
+
+// Alternative это одна упакованная альтернатива ноды леса. У листа потомков
+// нет, у унарного вывода потомок один, у бинарного — два, левый и правый.
+type Alternative struct {
+	Children []ForestNode
+}
+
+// IsLeaf сообщает, что альтернатива это сам терминал.
+func (a Alternative) IsLeaf() bool { return len(a.Children) == 0 }
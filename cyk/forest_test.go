@@ -0,0 +1,55 @@
+package cyk_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	. "github.com/quenbyako/parser/cyk"
+	"github.com/quenbyako/parser/grammar"
+)
+
+func TestTable_Forest(t *testing.T) {
+	g, err := grammar.Parse("", strings.NewReader(`S : S S | a ;`), "a")
+	require.NoError(t, err)
+	nf := g.AsBNF().As2NF("S")
+
+	table := &Table{Closure: nf.Closure}
+	term := terminal(g, "a")
+	for i := 0; i < 4; i++ {
+		table.AddTerminals(Terminal{Type: term}, []grammar.Ident{term}, nf.Select)
+	}
+
+	for x := 0; x < table.Len(); x++ {
+		for y := 0; y <= x; y++ {
+			cell := table.Cell(XY{X: x, Y: y})
+			require.Equal(t, len(table.Idents(XY{X: x, Y: y})), len(cell), "cell %v is not packed", XY{X: x, Y: y})
+		}
+	}
+
+	root, ok := table.Forest().Root(grammar.Ident{ID: "S"})
+	require.True(t, ok)
+	require.True(t, root.IsAmbiguous())
+	// a(aaa), (aa)(aa), (aaa)a
+	require.Len(t, root.Alternatives(), 3)
+	for _, alt := range root.Alternatives() {
+		require.Len(t, alt.Children, 2)
+		left, right := alt.Children[0], alt.Children[1]
+		require.Equal(t, root.Span().Y, left.Span().Y)
+		require.Equal(t, left.Span().X+1, right.Span().Y)
+		require.Equal(t, root.Span().X, right.Span().X)
+	}
+
+	var nodes, leaves int
+	table.Forest().Each(root, func(n ForestNode) bool {
+		nodes++
+		if _, ok := n.Terminal(); ok {
+			leaves++
+		}
+		return true
+	})
+	// S на каждом из 10 отрезков и 4 терминала
+	require.Equal(t, 14, nodes)
+	require.Equal(t, 4, leaves)
+}
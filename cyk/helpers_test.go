@@ -0,0 +1,52 @@
+package cyk_test
+
+import (
+	"strings"
+
+	. "github.com/quenbyako/parser/cyk"
+	"github.com/quenbyako/parser/grammar"
+)
+
+func terminal(g *grammar.EBNF, id string) grammar.Ident {
+	for term := range g.Terminals {
+		if term.ID == id {
+			return term
+		}
+	}
+
+	panic("unknown terminal " + id)
+}
+
+func treeProbability(cnf *grammar.CNF, tree *Tree) float64 {
+	if len(tree.Children) == 0 {
+		return 1
+	}
+
+	res := 1.0
+	children := make([]grammar.Ident, len(tree.Children))
+	for i, child := range tree.Children {
+		children[i] = child.I
+		res *= treeProbability(cnf, child)
+	}
+
+	return res * cnf.Weight(tree.I, children...)
+}
+
+func sentence(g *grammar.EBNF, s string) []Terminal {
+	res := []Terminal{}
+	for _, word := range strings.Fields(s) {
+		res = append(res, Terminal{Type: symbol(g, word), Value: word})
+	}
+
+	return res
+}
+
+func symbol(g *grammar.EBNF, word string) grammar.Ident {
+	for hash, value := range g.Constants {
+		if value == word {
+			return grammar.Ident{ID: "CONST", AttrHash: hash}
+		}
+	}
+
+	return terminal(g, word)
+}
@@ -0,0 +1,200 @@
+package cyk
+
+import (
+	"math"
+
+	"github.com/quenbyako/parser/grammar"
+)
+
+// InsideOutside считает для леса внутренние и внешние вероятности нод, а
+// через них — ожидаемое количество применений каждого правила во всех
+// деревьях разбора. Вся арифметика в логарифмах, так что длинные
+// предложения не уходят в ноль.
+//
+// rule вызывается для каждого вывода каждой ноды, до которой можно дойти от
+// корней, с логарифмом ожидаемого количества; листья-терминалы правил не
+// дают. Возвращает логарифм вероятности всего предложения или -Inf, если оно
+// не выводится.
+//
+// Унарные выводы (2NF, Table.Closure) могут ссылаться на любую ноду своей
+// ячейки, в том числе по циклу: значения таких нод досчитываются
+// итерациями до неподвижной точки. Если веса цикла в сумме не меньше
+// единицы, ряд расходится: такие ноды получают +Inf, и если до него доходит
+// корень, InsideOutside возвращает +Inf, не вызывая rule.
+//
+// K. Lari, S. J. Young — The estimation of stochastic context-free grammars
+// using the Inside-Outside algorithm (1990)
+func (f Forest) InsideOutside(weight weightFunc, rule func(parent grammar.Ident, children []grammar.Ident, logCount float64)) float64 {
+	t := f.t
+	n := len(t.terms)
+	if n == 0 {
+		return math.Inf(-1)
+	}
+
+	inside := make([][]float64, len(t.cells))
+	outside := make([][]float64, len(t.cells))
+	for i, cell := range t.cells {
+		inside[i] = make([]float64, len(cell))
+		outside[i] = make([]float64, len(cell))
+		for j := range outside[i] {
+			inside[i][j], outside[i][j] = math.Inf(-1), math.Inf(-1)
+		}
+	}
+	at := func(values [][]float64, c NonTerminalCoord) *float64 { return &values[spanIndex(c.XY)][c.Index] }
+
+	logWeight := func(node NonTerminal, d Derivation) float64 {
+		if d.IsUnit() {
+			return math.Log(weight(node.I, t.cells[spanIndex(d.Left.XY)][d.Left.Index].I))
+		}
+
+		return math.Log(weight(node.I, t.cells[spanIndex(d.Left.XY)][d.Left.Index].I, t.cells[spanIndex(d.Bottom.XY)][d.Bottom.Index].I))
+	}
+	// вероятность вывода без учета самой ноды: вес правила и inside потомков
+	score := func(node NonTerminal, d Derivation) float64 {
+		switch {
+		case d.IsLeaf():
+			return t.leafScore(d)
+		case d.IsUnit():
+			return logWeight(node, d) + *at(inside, d.Left)
+		default:
+			return logWeight(node, d) + *at(inside, d.Left) + *at(inside, d.Bottom)
+		}
+	}
+
+	// снизу вверх: сначала короткие отрезки. Бинарные выводы и листья
+	// зависят только от более коротких ячеек, унарные — от нод своей
+	for length := 0; length < n; length++ {
+		for y := 0; y+length < n; y++ {
+			idx := spanIndex(XY{X: y + length, Y: y})
+			var units []unitEdge
+			for i, node := range t.cells[idx] {
+				sum := math.Inf(-1)
+				for _, d := range node.Derivations {
+					if d.IsUnit() {
+						units = append(units, unitEdge{to: i, from: d.Left.Index, w: logWeight(node, d)})
+						continue
+					}
+					sum = logAdd(sum, score(node, d))
+				}
+				inside[idx][i] = sum
+			}
+			inside[idx] = unitFixpoint(inside[idx], units)
+		}
+	}
+
+	logZ := math.Inf(-1)
+	for _, root := range f.Roots() {
+		logZ = logAdd(logZ, *at(inside, root.coord))
+		*at(outside, root.coord) = 0
+	}
+	if math.IsInf(logZ, 0) {
+		return logZ
+	}
+
+	// сверху вниз: в ячейку уже пришло все из более длинных отрезков,
+	// остается досчитать унарные выводы внутри нее, а потом раздать outside
+	// потомкам в более коротких ячейках
+	for length := n - 1; length >= 0; length-- {
+		for y := n - 1 - length; y >= 0; y-- {
+			idx := spanIndex(XY{X: y + length, Y: y})
+			var units []unitEdge
+			for i, node := range t.cells[idx] {
+				for _, d := range node.Derivations {
+					if d.IsUnit() {
+						units = append(units, unitEdge{to: d.Left.Index, from: i, w: logWeight(node, d)})
+					}
+				}
+			}
+			outside[idx] = unitFixpoint(outside[idx], units)
+
+			for i, node := range t.cells[idx] {
+				out := outside[idx][i]
+				if math.IsInf(out, -1) {
+					continue
+				}
+
+				for _, d := range node.Derivations {
+					switch {
+					case d.IsLeaf():
+						continue
+					case d.IsUnit():
+						w := logWeight(node, d)
+						rule(node.I, []grammar.Ident{t.cells[spanIndex(d.Left.XY)][d.Left.Index].I}, out+w+*at(inside, d.Left)-logZ)
+					default:
+						w := logWeight(node, d)
+						left, bottom := at(outside, d.Left), at(outside, d.Bottom)
+						*left = logAdd(*left, out+w+*at(inside, d.Bottom))
+						*bottom = logAdd(*bottom, out+w+*at(inside, d.Left))
+						rule(node.I, []grammar.Ident{
+							t.cells[spanIndex(d.Left.XY)][d.Left.Index].I,
+							t.cells[spanIndex(d.Bottom.XY)][d.Bottom.Index].I,
+						}, out+w+*at(inside, d.Left)+*at(inside, d.Bottom)-logZ)
+					}
+				}
+			}
+		}
+	}
+
+	return logZ
+}
+
+// maxUnitIterations ограничивает число итераций unitFixpoint: если значения
+// все еще меняются, ряд по унарному циклу считается расходящимся.
+const maxUnitIterations = 1000
+
+// unitEdge это унарный вклад в ноду ячейки: values[to] += w * values[from].
+type unitEdge struct {
+	to, from int
+	w        float64
+}
+
+// unitFixpoint досчитывает значения нод одной ячейки по унарным выводам:
+// каждое из них это base плюс вклады units. При циклах это бесконечный ряд,
+// так что вклады добавляются итерациями, пока значения не перестанут
+// меняться. Ноды, которые не сошлись за maxUnitIterations, получают +Inf.
+func unitFixpoint(base []float64, units []unitEdge) []float64 {
+	values := append([]float64(nil), base...)
+	if len(units) == 0 {
+		return values
+	}
+
+	diverged := make([]bool, len(values))
+	for iteration := 0; ; iteration++ {
+		next := append([]float64(nil), base...)
+		for _, u := range units {
+			next[u.to] = logAdd(next[u.to], u.w+values[u.from])
+		}
+
+		changed := false
+		for i := range next {
+			if diverged[i] {
+				next[i] = math.Inf(1)
+				continue
+			}
+			if next[i] == values[i] || math.Abs(next[i]-values[i]) <= 1e-12*math.Max(1, math.Abs(next[i])) {
+				continue
+			}
+			changed = true
+			if iteration >= maxUnitIterations {
+				diverged[i], next[i] = true, math.Inf(1)
+			}
+		}
+
+		values = next
+		if !changed {
+			return values
+		}
+	}
+}
+
+// logAdd возвращает log(exp(a) + exp(b)) без переполнения.
+func logAdd(a, b float64) float64 {
+	if a < b {
+		a, b = b, a
+	}
+	if math.IsInf(b, -1) || math.IsInf(a, 1) {
+		return a
+	}
+
+	return a + math.Log1p(math.Exp(b-a))
+}
@@ -0,0 +1,117 @@
+package cyk_test
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	. "github.com/quenbyako/parser/cyk"
+	"github.com/quenbyako/parser/grammar"
+)
+
+func TestForest_InsideOutside(t *testing.T) {
+	g, err := grammar.Parse("", strings.NewReader(`
+		S  : NP VP ;
+		VP : v NP [0.6] | VP PP [0.4] ;
+		NP : NP PP [0.2] | n [0.8] ;
+		PP : p NP ;
+	`), "n", "v", "p")
+	require.NoError(t, err)
+	cnf := g.AsCNF("S")
+
+	table := &Table{Closure: cnf.Closure}
+	for _, word := range strings.Fields("n v n p n p n") {
+		term := terminal(g, word)
+		table.AddTerminals(Terminal{Type: term, Value: word}, []grammar.Ident{term}, cnf.Select)
+	}
+	forest := table.Forest(cnf.Roots()...)
+
+	// полный перебор: вероятность предложения и ожидаемые количества правил
+	var z float64
+	expected := make(map[string]float64)
+	it := forest.Trees(0)
+	for tree, ok := it.Next(); ok; tree, ok = it.Next() {
+		p := treeProbability(cnf, tree)
+		z += p
+		eachRule(tree, func(rule string) { expected[rule] += p })
+	}
+	for rule := range expected {
+		expected[rule] /= z
+	}
+
+	got := make(map[string]float64)
+	logZ := forest.InsideOutside(cnf.Weight, func(parent grammar.Ident, children []grammar.Ident, logCount float64) {
+		got[grammar.CanonicalRule{Name: parent, Rule: children}.String()] += math.Exp(logCount)
+	})
+
+	require.InDelta(t, math.Log(z), logZ, 1e-9)
+	require.Len(t, got, len(expected))
+	for rule, count := range expected {
+		require.InDelta(t, count, got[rule], 1e-9, rule)
+	}
+}
+
+// в 2NF унарные правила остаются в таблице, и A : B, B : A дают цикл, в
+// котором A ссылается на ноду B, созданную после нее
+func TestForest_InsideOutsideUnitCycle(t *testing.T) {
+	g, err := grammar.Parse("", strings.NewReader(`
+		S : A ;
+		A : B [0.5] | a [0.5] ;
+		B : A [0.5] | b [0.5] ;
+	`), "a", "b")
+	require.NoError(t, err)
+	nf := g.AsBNF().As2NF("S")
+
+	weights := map[string]float64{"S A": 1, "A B": 0.5, "A a": 0.5, "B A": 0.5, "B b": 0.5}
+	weight := func(parent grammar.Ident, children ...grammar.Ident) float64 {
+		return weights[parent.ID+" "+children[0].ID]
+	}
+
+	for _, tt := range []struct {
+		word            string
+		z, unitA, unitB float64
+	}{
+		// A = 1/2 + 1/4 A, а цикл A → B → A в среднем проходится 1/3 раза
+		{"a", 2.0 / 3, 1.0 / 3, 1.0 / 3},
+		// A = 1/4 + 1/4 A, и в каждом дереве есть A : B на один раз больше
+		{"b", 1.0 / 3, 4.0 / 3, 1.0 / 3},
+	} {
+		table := &Table{Closure: nf.Closure}
+		term := terminal(g, tt.word)
+		table.AddTerminals(Terminal{Type: term, Value: tt.word}, []grammar.Ident{term}, nf.Select)
+
+		got := make(map[string]float64)
+		logZ := table.Forest(nf.Roots()...).InsideOutside(weight, func(parent grammar.Ident, children []grammar.Ident, logCount float64) {
+			got[parent.ID+" "+children[0].ID] += math.Exp(logCount)
+		})
+
+		require.InDelta(t, math.Log(tt.z), logZ, 1e-9, tt.word)
+		require.InDelta(t, 1, got["S A"], 1e-9, tt.word)
+		require.InDelta(t, tt.unitA, got["A B"], 1e-9, tt.word)
+		require.InDelta(t, tt.unitB, got["B A"], 1e-9, tt.word)
+	}
+
+	// без весов цикл расходится
+	table := &Table{Closure: nf.Closure}
+	term := terminal(g, "a")
+	table.AddTerminals(Terminal{Type: term, Value: "a"}, []grammar.Ident{term}, nf.Select)
+	logZ := table.Forest(nf.Roots()...).InsideOutside(func(grammar.Ident, ...grammar.Ident) float64 { return 1 }, func(grammar.Ident, []grammar.Ident, float64) {
+		t.Fatal("rule must not be called for a divergent forest")
+	})
+	require.True(t, math.IsInf(logZ, 1))
+}
+
+func eachRule(tree *Tree, fn func(rule string)) {
+	if len(tree.Children) == 0 {
+		return
+	}
+
+	children := make(grammar.IdentSet, len(tree.Children))
+	for i, child := range tree.Children {
+		children[i] = child.I
+		eachRule(child, fn)
+	}
+	fn(grammar.CanonicalRule{Name: tree.I, Rule: children}.String())
+}
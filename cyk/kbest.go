@@ -0,0 +1,237 @@
+package cyk
+
+import (
+	"container/heap"
+	"math"
+
+	"github.com/quenbyako/parser/grammar"
+)
+
+// ScoredTree это дерево разбора вместе с логарифмом его вероятности.
+type ScoredTree struct {
+	*Tree
+	Score float64
+}
+
+// KBest возвращает до k лучших деревьев разбора всего предложения по
+// убыванию вероятности, при равенстве — в порядке Roots и Alternatives.
+// Вероятности правил берутся из Table.Weight (без него все деревья
+// равновероятны). Что бы деревьев было больше одного, таблица должна
+// хранить все выводы (Table.KeepDerivations), иначе в ней только лучшее.
+//
+// Деревья перебираются лениво: у каждой ноды k лучших выводов считаются
+// только по мере того, как они нужны родителям, так что обход почти не
+// зависит от размера леса. Выводы через циклы из унарных правил не
+// перебираются.
+//
+// L. Huang, D. Chiang — Better k-best Parsing (2005), алгоритм 3
+func (f Forest) KBest(k int) []ScoredTree {
+	kb := &kbest{f: f, nodes: make(map[NonTerminalCoord]*kbestNode)}
+
+	var res []ScoredTree
+	for i := 0; i < k; i++ {
+		d, ok := kb.get(noCoord, i)
+		if !ok {
+			break
+		}
+
+		root := kb.nodes[noCoord].edges[d.edge].tails[0]
+		res = append(res, ScoredTree{Tree: kb.tree(root, d.ranks[0]), Score: d.score})
+	}
+
+	return res
+}
+
+type kbest struct {
+	f     Forest
+	nodes map[NonTerminalCoord]*kbestNode
+}
+
+// kbestNode это состояние перебора одной ноды леса. Корни собраны под
+// общей вершиной с координатой noCoord.
+type kbestNode struct {
+	edges []kbestEdge
+	// derivations это уже найденные лучшие выводы по порядку, candidates —
+	// кандидаты на следующий.
+	derivations []kbestDerivation
+	candidates  kbestHeap
+	seen        map[kbestDerivation]struct{}
+	started     bool
+	busy        bool
+}
+
+// kbestEdge это один вывод ноды: потомки и логарифм веса правила.
+type kbestEdge struct {
+	tails  []NonTerminalCoord
+	weight float64
+}
+
+// kbestDerivation это вывод по ребру edge, в котором i-й потомок взят со
+// своим ranks[i]-м лучшим выводом.
+type kbestDerivation struct {
+	edge  int
+	ranks [2]int
+	score float64
+}
+
+func (kb *kbest) node(c NonTerminalCoord) *kbestNode {
+	if n, ok := kb.nodes[c]; ok {
+		return n
+	}
+
+	n := &kbestNode{seen: make(map[kbestDerivation]struct{})}
+	kb.nodes[c] = n
+
+	if c == noCoord {
+		for _, root := range kb.f.Roots() {
+			n.edges = append(n.edges, kbestEdge{tails: []NonTerminalCoord{root.coord}})
+		}
+		return n
+	}
+
+	t := kb.f.t
+	node := t.node(c)
+	for _, d := range node.Derivations {
+		switch {
+		case d.IsLeaf():
+			n.edges = append(n.edges, kbestEdge{weight: t.leafScore(d)})
+		case d.IsUnit():
+			n.edges = append(n.edges, kbestEdge{
+				tails:  []NonTerminalCoord{d.Left},
+				weight: kb.weight(node, t.node(d.Left)),
+			})
+		default:
+			n.edges = append(n.edges, kbestEdge{
+				tails:  []NonTerminalCoord{d.Left, d.Bottom},
+				weight: kb.weight(node, t.node(d.Left), t.node(d.Bottom)),
+			})
+		}
+	}
+
+	return n
+}
+
+func (kb *kbest) weight(parent NonTerminal, children ...NonTerminal) float64 {
+	if kb.f.t.Weight == nil {
+		return 0
+	}
+
+	idents := make([]grammar.Ident, len(children))
+	for i, child := range children {
+		idents[i] = child.I
+	}
+
+	return math.Log(kb.f.t.Weight(parent.I, idents...))
+}
+
+// get возвращает k-й лучший вывод ноды c, считая его при необходимости.
+func (kb *kbest) get(c NonTerminalCoord, k int) (kbestDerivation, bool) {
+	n := kb.node(c)
+	if k < len(n.derivations) {
+		return n.derivations[k], true
+	}
+	if n.busy {
+		// нода уже на стеке, то есть вывод ушел в унарный цикл
+		return kbestDerivation{}, false
+	}
+	n.busy = true
+	defer func() { n.busy = false }()
+
+	if !n.started {
+		n.started = true
+		for e := range n.edges {
+			kb.push(n, kbestDerivation{edge: e})
+		}
+	}
+
+	for len(n.derivations) <= k {
+		if len(n.derivations) > 0 {
+			kb.next(n, n.derivations[len(n.derivations)-1])
+		}
+		if n.candidates.Len() == 0 {
+			return kbestDerivation{}, false
+		}
+		n.derivations = append(n.derivations, heap.Pop(&n.candidates).(kbestDerivation))
+	}
+
+	return n.derivations[k], true
+}
+
+// next добавляет в кандидаты соседей вывода d: те же выводы, где один из
+// потомков взят со следующим по качеству выводом.
+func (kb *kbest) next(n *kbestNode, d kbestDerivation) {
+	for i := range n.edges[d.edge].tails {
+		neighbour := kbestDerivation{edge: d.edge, ranks: d.ranks}
+		neighbour.ranks[i]++
+		kb.push(n, neighbour)
+	}
+}
+
+// push считает оценку вывода d и добавляет его в кандидаты, если все его
+// потомки существуют и такого кандидата еще не было.
+func (kb *kbest) push(n *kbestNode, d kbestDerivation) {
+	edge := n.edges[d.edge]
+	if _, ok := n.seen[d]; ok {
+		return
+	}
+
+	d.score = edge.weight
+	for i, tail := range edge.tails {
+		child, ok := kb.get(tail, d.ranks[i])
+		if !ok {
+			return
+		}
+		d.score += child.score
+	}
+
+	n.seen[kbestDerivation{edge: d.edge, ranks: d.ranks}] = struct{}{}
+	heap.Push(&n.candidates, d)
+}
+
+func (kb *kbest) tree(c NonTerminalCoord, k int) *Tree {
+	d := kb.nodes[c].derivations[k]
+	edge := kb.nodes[c].edges[d.edge]
+
+	res := &Tree{I: kb.f.t.node(c).I, Span: c.XY}
+	if len(edge.tails) == 0 {
+		term := kb.f.t.leaf(c.XY, kb.f.t.node(c).Derivations[d.edge])
+		res.Terminal = &term
+		return res
+	}
+	for i, tail := range edge.tails {
+		res.Children = append(res.Children, kb.tree(tail, d.ranks[i]))
+	}
+
+	return res
+}
+
+// kbestHeap это очередь кандидатов, сверху лучший.
+type kbestHeap []kbestDerivation
+
+func (h kbestHeap) Len() int { return len(h) }
+
+func (h kbestHeap) Less(i, j int) bool {
+	if h[i].score != h[j].score {
+		return h[i].score > h[j].score
+	}
+	if h[i].edge != h[j].edge {
+		return h[i].edge < h[j].edge
+	}
+	if h[i].ranks[0] != h[j].ranks[0] {
+		return h[i].ranks[0] < h[j].ranks[0]
+	}
+
+	return h[i].ranks[1] < h[j].ranks[1]
+}
+
+func (h kbestHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *kbestHeap) Push(x any) { *h = append(*h, x.(kbestDerivation)) }
+
+func (h *kbestHeap) Pop() any {
+	old := *h
+	res := old[len(old)-1]
+	*h = old[:len(old)-1]
+
+	return res
+}
@@ -0,0 +1,63 @@
+package cyk_test
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	. "github.com/quenbyako/parser/cyk"
+	"github.com/quenbyako/parser/grammar"
+	"github.com/quenbyako/parser/slices"
+)
+
+func TestForest_KBest(t *testing.T) {
+	g, err := grammar.Parse("", strings.NewReader(`
+		S  : NP VP ;
+		VP : v NP [0.6] | VP PP [0.4] ;
+		NP : NP PP [0.2] | n [0.8] ;
+		PP : p NP ;
+	`), "n", "v", "p")
+	require.NoError(t, err)
+	cnf := g.AsCNF("S")
+
+	table := &Table{Closure: cnf.Closure, Weight: cnf.Weight, KeepDerivations: true}
+	for _, word := range strings.Fields("n v n p n p n") {
+		term := terminal(g, word)
+		table.AddTerminals(Terminal{Type: term, Value: word}, []grammar.Ident{term}, cnf.Select)
+	}
+	forest := table.Forest(cnf.Roots()...)
+
+	var expected []float64
+	it := forest.Trees(0)
+	for tree, ok := it.Next(); ok; tree, ok = it.Next() {
+		expected = append(expected, math.Log(treeProbability(cnf, tree)))
+	}
+	expected = slices.SortFunc(expected, func(a, b float64) bool { return a > b })
+
+	best, ok := forest.Best()
+	require.True(t, ok)
+	require.InDelta(t, expected[0], best.Score(), 1e-9)
+
+	for _, k := range []int{1, 3, len(expected), len(expected) + 10} {
+		got := forest.KBest(k)
+		require.Len(t, got, minInt(k, len(expected)))
+
+		seen := make(map[string]struct{})
+		for i, tree := range got {
+			require.InDelta(t, expected[i], tree.Score, 1e-9)
+			require.InDelta(t, tree.Score, math.Log(treeProbability(cnf, tree.Tree)), 1e-9)
+			require.NotContains(t, seen, tree.String())
+			seen[tree.String()] = struct{}{}
+		}
+	}
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
@@ -0,0 +1,136 @@
+package cyk
+
+import (
+	"fmt"
+
+	"github.com/quenbyako/parser/grammar"
+)
+
+// Edge это дуга решетки слов: терминал, который покрывает все позиции
+// между узлами From и To. Узлы решетки нумеруются с нуля, узел i стоит
+// перед i-й позицией таблицы, так что дуга попадает в ячейку
+// XY{X: To-1, Y: From}.
+type Edge struct {
+	Terminal
+	From, To int
+
+	// Score это логарифм вероятности дуги, например оценка распознавателя
+	// речи. В режиме Витерби (Table.Weight) она становится Score листа и
+	// складывается с оценками правил, так что сегментация выбирается вместе
+	// с синтаксисом.
+	Score float64
+}
+
+// lattice это дуги таблицы, собранной из решетки. spans[cell] это номера
+// дуг, которые покрывают ровно отрезок cell.
+type lattice struct {
+	edges    []Edge
+	nonterms [][]grammar.Ident
+	spans    map[XY][]int
+}
+
+// FillLattice заполняет таблицу решеткой слов вместо одной цепочки
+// терминалов: у каждого узла может быть несколько исходящих дуг разной
+// длины, например слитное и раздельное написание составного слова. Все,
+// что было в таблице раньше, теряется. Позиций в таблице столько же,
+// сколько узлов в решетке без последнего, а предложением считается любой
+// путь от узла 0 до последнего узла.
+//
+// nonterms[i] это нетерминалы для edges[i]. Таблицу, собранную из решетки,
+// нельзя править (Truncate, ReplaceTerminal и т.д.).
+func (t *Table) FillLattice(edges []Edge, nonterms [][]grammar.Ident, selector selectorFunc) {
+	if len(edges) != len(nonterms) {
+		panic(fmt.Sprintf("got %d edges and %d nonterminal sets", len(edges), len(nonterms)))
+	}
+
+	n := 0
+	l := &lattice{edges: edges, nonterms: nonterms, spans: make(map[XY][]int)}
+	for i, e := range edges {
+		if e.From < 0 || e.To <= e.From {
+			panic(fmt.Sprintf("edge %v goes from node %d to %d", e.Type, e.From, e.To))
+		}
+		cell := XY{X: e.To - 1, Y: e.From}
+		l.spans[cell] = append(l.spans[cell], i)
+		if e.To > n {
+			n = e.To
+		}
+	}
+
+	t.Reset()
+	t.lattice = l
+	// позиция таблицы это отрезок между соседними узлами, сам по себе он
+	// терминалом не является, так что для отладки (String, Find) в нем
+	// лежит первая дуга, которая из него выходит
+	for i := 0; i < n; i++ {
+		t.terms = append(t.terms, Terminal{})
+	}
+	for i := len(edges) - 1; i >= 0; i-- {
+		t.terms[edges[i].From] = edges[i].Terminal
+	}
+	t.growColumn()
+
+	for x := 0; x < n; x++ {
+		cell := termxy(x)
+		t.cells[spanIndex(cell)] = t.closeCell(cell, t.addEdges(cell, t.cells[spanIndex(cell)][:0]))
+		t.prune(cell)
+		t.recalculateLine(x, selector)
+	}
+}
+
+// addEdges добавляет в ячейку листья для всех дуг решетки, которые ее
+// покрывают. У линейной таблицы ничего не делает.
+func (t *Table) addEdges(cell XY, nodes []NonTerminal) []NonTerminal {
+	if t.lattice == nil {
+		return nodes
+	}
+
+	for _, e := range t.lattice.spans[cell] {
+		for _, i := range t.lattice.nonterms[e] {
+			if t.Filter != nil && !t.Filter(cell, i) {
+				continue
+			}
+			nodes, _ = t.add(nodes, i, edgeLeaf(e), t.lattice.edges[e].Score)
+		}
+	}
+
+	return nodes
+}
+
+// edgeLeaf возвращает вывод-лист для дуги решетки с номером e: в отличие
+// от листа линейной таблицы, у него в Bottom лежит номер дуги.
+func edgeLeaf(e int) Derivation {
+	return Derivation{Left: noCoord, Bottom: NonTerminalCoord{XY: noCoord.XY, Index: e}}
+}
+
+// leaf возвращает терминал, вместе с которым в ячейку cell попал лист d.
+func (t *Table) leaf(cell XY, d Derivation) Terminal {
+	if d.Bottom.Index >= 0 {
+		return t.lattice.edges[d.Bottom.Index].Terminal
+	}
+
+	return t.terms[cell.X]
+}
+
+// leafScore возвращает оценку листа d: оценку дуги решетки или 0.
+func (t *Table) leafScore(d Derivation) float64 {
+	if d.Bottom.Index >= 0 {
+		return t.lattice.edges[d.Bottom.Index].Score
+	}
+
+	return 0
+}
+
+// ParseLattice заполняет таблицу решеткой слов (см. Table.FillLattice).
+// Тип терминала каждой дуги попадает в ее ячейку как есть. Битовые таблицы
+// решетки не поддерживают, так что здесь всегда используется Table.
+func (p *Parser) ParseLattice(edges []Edge) *Table {
+	t := NewTable(0)
+	t.Closure = p.g.Closure
+	nonterms := make([][]grammar.Ident, len(edges))
+	for i, e := range edges {
+		nonterms[i] = []grammar.Ident{e.Type}
+	}
+	t.FillLattice(edges, nonterms, p.g.Select)
+
+	return t
+}
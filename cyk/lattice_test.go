@@ -0,0 +1,83 @@
+package cyk_test
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"text/scanner"
+
+	"github.com/stretchr/testify/require"
+
+	. "github.com/quenbyako/parser/cyk"
+	"github.com/quenbyako/parser/grammar"
+	"github.com/quenbyako/parser/slices"
+)
+
+func TestTable_FillLattice(t *testing.T) {
+	g, err := grammar.Parse("", strings.NewReader(`
+		S  : NP VP ;
+		NP : det N ;
+		N  : noun | noun noun ;
+		VP : verb ;
+	`), "det", "noun", "verb")
+	require.NoError(t, err)
+	cnf := g.AsCNF("S")
+
+	// "the ice cream melts": "ice cream" это и одно слово, и два
+	edge := func(from, to, column int, word, typ string, p float64) Edge {
+		return Edge{
+			Terminal: Terminal{Position: scanner.Position{Line: 1, Column: column}, Type: terminal(g, typ), Value: word},
+			From:     from,
+			To:       to,
+			Score:    math.Log(p),
+		}
+	}
+	edges := []Edge{
+		edge(0, 1, 1, "the", "det", 1),
+		edge(1, 2, 5, "ice", "noun", 0.5),
+		edge(2, 3, 9, "cream", "noun", 0.5),
+		edge(1, 3, 5, "ice cream", "noun", 0.9),
+		edge(3, 4, 15, "melts", "verb", 1),
+	}
+	leaves := func(tree *Tree) []string {
+		var res []string
+		var walk func(*Tree)
+		walk = func(tree *Tree) {
+			if tree.Terminal != nil {
+				res = append(res, tree.Terminal.Value)
+			}
+			for _, child := range tree.Children {
+				walk(child)
+			}
+		}
+		walk(tree)
+		return res
+	}
+
+	p := NewParser(cnf, BackendTable)
+	table := p.ParseLattice(edges)
+	require.Equal(t, 4, table.Len())
+	require.True(t, p.Accepts(table))
+	require.Equal(t, int64(2), table.Forest(cnf.Roots()...).Count().Int64())
+	require.Panics(t, func() { table.Truncate(1) })
+	term := Terminal{Type: terminal(g, "verb")}
+	require.Panics(t, func() { table.AddTerminals(term, []grammar.Ident{term.Type}, cnf.Select) })
+	require.Panics(t, func() { table.FillParallel([]Terminal{term}, [][]grammar.Ident{{term.Type}}, cnf.Select, 2) })
+	require.Equal(t, 4, table.Len())
+
+	matches := table.Find([]grammar.Ident{{ID: "NP"}}, false)
+	require.Len(t, matches, 1)
+	require.Equal(t, 1, matches[0].Start.Column)
+	require.Equal(t, 14, matches[0].End.Column)
+
+	// сегментацию выбирают оценки дуг
+	viterbi := &Table{Closure: cnf.Closure, Weight: func(grammar.Ident, ...grammar.Ident) float64 { return 1 }, KeepDerivations: true}
+	viterbi.FillLattice(edges, slices.Remap(edges, func(_ int, e Edge) []grammar.Ident { return []grammar.Ident{e.Type} }), cnf.Select)
+
+	best := viterbi.Forest(cnf.Roots()...).KBest(3)
+	require.Len(t, best, 2)
+	require.Equal(t, []string{"the", "ice cream", "melts"}, leaves(best[0].Tree))
+	require.InDelta(t, math.Log(0.9), best[0].Score, 1e-9)
+	require.Equal(t, []string{"the", "ice", "cream", "melts"}, leaves(best[1].Tree))
+	require.InDelta(t, 2*math.Log(0.5), best[1].Score, 1e-9)
+}
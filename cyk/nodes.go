@@ -1,6 +1,7 @@
 package cyk
 
 import (
+	"math"
 	"text/scanner"
 
 	"github.com/quenbyako/parser/grammar"
@@ -15,19 +16,54 @@ type Terminal struct {
 
 // NonTerminal это тот терминал, который генерирует алгоритм cyk, то есть
 // буквально сырой терминал, который не сжат, не преобразован, и является
-// оригинальным нетерминалом, который согласно алгоритму был сгенерирован
+// оригинальным нетерминалом, который согласно алгоритму был сгенерирован.
+//
+// Ячейка упакована: каждый нетерминал в ней встречается ровно один раз, а
+// все способы собрать его на этом отрезке лежат в Derivations. Так таблица
+// целиком является упакованным лесом разбора (см. Forest).
 type NonTerminal struct {
 	I grammar.Ident
 
-	// ВАЖНО: если вы пытаетесь дернуть кординаты у нетерминала, который
-	// находится в диагональной ячейке (где координаты x==y) то координаты
-	// будут пустыми. остальные нетерминалы обязаны иметь координаты
+	Derivations []Derivation
+
+	// Score это логарифм вероятности лучшего вывода. Заполняется только в
+	// режиме Витерби (Table.Weight), тогда же в Derivations остается только
+	// этот лучший вывод, если не задан Table.KeepDerivations.
+	Score float64
+}
+
+// Derivation это один способ вывести нетерминал на отрезке ячейки.
+//
+// ВАЖНО: у нетерминалов, которые находятся в диагональной ячейке (где
+// координаты x==y) и добавлены вместе с терминалом, координат нет вообще.
+// Остальные нетерминалы обязаны иметь координаты. У таблицы из решетки
+// слов (Table.FillLattice) листья бывают в любой ячейке, а в Bottom у них
+// лежит номер дуги.
+//
+// У вывода, добавленного унарным замыканием (Table.Closure), есть только
+// левая координата, и указывает она на ноду в той же ячейке.
+type Derivation struct {
 	Left   NonTerminalCoord
 	Bottom NonTerminalCoord
 }
 
+// IsLeaf сообщает, что нетерминал пришел вместе с терминалом и потомков у
+// него нет.
+func (d Derivation) IsLeaf() bool { return d.Left == noCoord && d.Bottom.XY == noCoord.XY }
+
+// IsUnit сообщает, что нетерминал был выведен унарным замыканием из другой
+// ноды этой же ячейки.
+func (d Derivation) IsUnit() bool { return d.Left != noCoord && d.Bottom == noCoord }
+
+// IsAmbiguous сообщает, что нетерминал выводится на своем отрезке больше
+// чем одним способом.
+func (n NonTerminal) IsAmbiguous() bool { return len(n.Derivations) > 1 }
 
 type NonTerminalCoord struct {
 	XY
 	Index int
 }
+
+// просто что бы если была попытка через него найти нетерминал то улететь в
+// панику
+var noCoord = NonTerminalCoord{XY: termxy(math.MaxInt), Index: -1000}
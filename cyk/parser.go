@@ -0,0 +1,124 @@
+package cyk
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/quenbyako/parser/grammar"
+	"github.com/quenbyako/parser/slices"
+)
+
+// Grammar это бинаризованная грамматика, с которой умеет работать CYK. Ей
+// удовлетворяют grammar.CNF и grammar.BinaryNF.
+type Grammar interface {
+	// Select возвращает нетерминалы, которые собираются из пары соседних
+	// ячеек.
+	Select(left, bottom grammar.Ident) ([]grammar.Ident, bool)
+	// Closure возвращает нетерминалы, которые выводятся из символа без
+	// соседей за один шаг (стоп правила или унарное отношение). Таблицы сами
+	// применяют его до неподвижной точки.
+	Closure(grammar.Ident) []grammar.Ident
+	// Compile собирает неизменяемую грамматику с плотными номерами символов,
+	// на которой работают битовые таблицы.
+	Compile() *grammar.Compiled
+	// Roots возвращает нетерминалы, которые могут стоять в корне разбора.
+	Roots() []grammar.Ident
+}
+
+// Chart это заполненная таблица разбора, независимо от того, как она устроена
+// внутри.
+type Chart interface {
+	// Len возвращает количество терминалов в таблице.
+	Len() int
+	// Has сообщает, выводит ли i отрезок cell.
+	Has(cell XY, i grammar.Ident) bool
+	// Idents возвращает все символы, которые выводят отрезок cell.
+	Idents(cell XY) []grammar.Ident
+}
+
+// Backend определяет, какой таблицей Parser заполняет разбор.
+type Backend int
+
+const (
+	// BackendTable это Table: ячейки хранят ноды с координатами потомков,
+	// так что по ней можно восстановить дерево.
+	BackendTable Backend = iota
+	// BackendParallel это та же Table, но заполненная по диагоналям пулом
+	// из GOMAXPROCS горутин (см. Table.FillParallel).
+	BackendParallel
+	// BackendBitset это BitTable, заполненная по диагоналям.
+	BackendBitset
+	// BackendValiant это BitTable, заполненная сведением к умножению
+	// булевых матриц.
+	BackendValiant
+)
+
+func (b Backend) String() string {
+	switch b {
+	case BackendTable:
+		return "table"
+	case BackendParallel:
+		return "parallel"
+	case BackendBitset:
+		return "bitset"
+	case BackendValiant:
+		return "valiant"
+	default:
+		return fmt.Sprintf("backend(%d)", int(b))
+	}
+}
+
+// Parser разбирает предложения целиком одной и той же грамматикой.
+type Parser struct {
+	g        Grammar
+	compiled *grammar.Compiled
+	backend  Backend
+}
+
+func NewParser(g Grammar, backend Backend) *Parser {
+	p := &Parser{g: g, backend: backend}
+	if backend == BackendBitset || backend == BackendValiant {
+		p.compiled = g.Compile()
+	}
+
+	return p
+}
+
+// Parse заполняет таблицу для всего предложения. Тип каждого терминала
+// попадает в диагональную ячейку как есть, все остальное выводится
+// грамматикой.
+func (p *Parser) Parse(terms []Terminal) Chart {
+	switch p.backend {
+	case BackendBitset:
+		t := NewBitTable(p.compiled)
+		t.Fill(terms)
+		return t
+	case BackendValiant:
+		t := NewBitTable(p.compiled)
+		t.FillValiant(terms)
+		return t
+	case BackendParallel:
+		t := NewTable(len(terms))
+		t.Closure = p.g.Closure
+		nonterms := slices.Remap(terms, func(_ int, term Terminal) []grammar.Ident { return []grammar.Ident{term.Type} })
+		t.FillParallel(terms, nonterms, p.g.Select, runtime.GOMAXPROCS(0))
+		return t
+	default:
+		t := NewTable(len(terms))
+		t.Closure = p.g.Closure
+		for _, term := range terms {
+			t.AddTerminals(term, []grammar.Ident{term.Type}, p.g.Select)
+		}
+		return t
+	}
+}
+
+// Accepts сообщает, выводится ли все предложение из корня грамматики.
+func (p *Parser) Accepts(c Chart) bool {
+	if c.Len() == 0 {
+		return false
+	}
+
+	top := XY{X: c.Len() - 1, Y: 0}
+	return slices.ContainsFunc(p.g.Roots(), func(i grammar.Ident) bool { return c.Has(top, i) })
+}
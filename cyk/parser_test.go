@@ -0,0 +1,139 @@
+package cyk_test
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	. "github.com/quenbyako/parser/cyk"
+	"github.com/quenbyako/parser/grammar"
+)
+
+const exprGrammar = `
+	expr   : expr "+" term | term ;
+	term   : term "*" factor | factor ;
+	factor : "(" expr ")" | num | "-" factor ;
+`
+
+var backends = []Backend{BackendTable, BackendParallel, BackendBitset, BackendValiant}
+
+func TestParser_Backends(t *testing.T) {
+	for _, nf := range []struct {
+		name  string
+		build func(*grammar.EBNF) Grammar
+	}{
+		{name: "cnf", build: func(g *grammar.EBNF) Grammar { return g.AsCNF("expr") }},
+		{name: "2nf", build: func(g *grammar.EBNF) Grammar { return g.AsBNF().As2NF("expr") }},
+	} {
+		t.Run(nf.name, func(t *testing.T) {
+			g, err := grammar.Parse("", strings.NewReader(exprGrammar), "num")
+			require.NoError(t, err)
+			cnf := nf.build(g)
+
+			for _, tt := range []struct {
+				input    string
+				expected bool
+			}{
+				{input: "num", expected: true},
+				{input: "num + num * num", expected: true},
+				{input: "( num + - num ) * num", expected: true},
+				{input: "num + * num", expected: false},
+				{input: "( num", expected: false},
+			} {
+				for _, backend := range backends {
+					p := NewParser(cnf, backend)
+					require.Equal(t, tt.expected, p.Accepts(p.Parse(sentence(g, tt.input))), "%v: %v", backend, tt.input)
+				}
+			}
+
+			// ячейки вне таблицы пустые во всех бэкендах
+			for _, backend := range backends {
+				table := NewParser(cnf, backend).Parse(sentence(g, "num + num"))
+				for _, cell := range []XY{{X: 3, Y: 0}, {X: 0, Y: 1}, {X: 0, Y: -1}, {X: 100, Y: 100}} {
+					require.False(t, table.Has(cell, grammar.Ident{ID: "expr"}), "%v: %v", backend, cell)
+					require.Empty(t, table.Idents(cell), "%v: %v", backend, cell)
+				}
+			}
+			bits := NewBitTable(cnf.Compile())
+			bits.Fill(sentence(g, "num"))
+			require.False(t, bits.HasSymbol(XY{}, grammar.Symbol(cnf.Compile().Len())))
+
+			// все бэкенды обязаны заполнить каждую ячейку одинаково
+			r := rand.New(rand.NewSource(1))
+			words := []string{"num", "+", "*", "(", ")", "-"}
+			for i := 0; i < 50; i++ {
+				input := make([]string, 1+r.Intn(20))
+				for j := range input {
+					input[j] = words[r.Intn(len(words))]
+				}
+				terms := sentence(g, strings.Join(input, " "))
+
+				expected := NewParser(cnf, BackendTable).Parse(terms)
+				for _, backend := range backends[1:] {
+					got := NewParser(cnf, backend).Parse(terms)
+					for y := range terms {
+						for x := y; x < len(terms); x++ {
+							cell := XY{X: x, Y: y}
+							require.Equal(t, expected.Idents(cell), got.Idents(cell), "%v: %v at %v", backend, input, cell)
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkParser(b *testing.B) {
+	g, err := grammar.Parse("", strings.NewReader(exprGrammar), "num")
+	require.NoError(b, err)
+	cnf := g.AsCNF("expr")
+
+	input := strings.Repeat("( num + num * - num ) * ", 8) + "num"
+	terms := sentence(g, input)
+
+	for _, backend := range backends {
+		b.Run(fmt.Sprint(backend), func(b *testing.B) {
+			p := NewParser(cnf, backend)
+			for i := 0; i < b.N; i++ {
+				p.Parse(terms)
+			}
+		})
+	}
+}
+
+func BenchmarkTable_FillParallel(b *testing.B) {
+	g, err := grammar.Parse("", strings.NewReader(exprGrammar), "num")
+	require.NoError(b, err)
+	cnf := g.AsCNF("expr")
+
+	terms := sentence(g, strings.Repeat("( num + num * - num ) * ", 25)+"num")
+	nonterms := make([][]grammar.Ident, len(terms))
+	for i, term := range terms {
+		nonterms[i] = []grammar.Ident{term.Type}
+	}
+
+	b.Run("incremental", func(b *testing.B) {
+		t := NewTable(len(terms))
+		t.Closure = cnf.Closure
+		for i := 0; i < b.N; i++ {
+			t.Reset()
+			for j, term := range terms {
+				t.AddTerminals(term, nonterms[j], cnf.Select)
+			}
+		}
+	})
+
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			t := NewTable(len(terms))
+			t.Closure = cnf.Closure
+			for i := 0; i < b.N; i++ {
+				t.Reset()
+				t.FillParallel(terms, nonterms, cnf.Select, workers)
+			}
+		})
+	}
+}
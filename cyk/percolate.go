@@ -0,0 +1,70 @@
+package cyk
+
+import "github.com/quenbyako/parser/grammar"
+
+// Percolate заполняет Features у нод дерева снизу вверх. Лист получает
+// атрибуты входного терминала: их возвращает features, а если она nil —
+// флаги и равенства из селектора грамматики (HeadRules.Terminal). Лист
+// правила вида `np : noun ;` фильтрует их так же, как любой нетерминал.
+// Нетерминал берет у вершины своего правила атрибуты, объявленные через
+// `@percolate`, так что их видят и нетерминалы выше, и вызывающий код:
+//
+//	grammar.ComplexIdent{ID: "np", Properties: tree.Features}
+//
+// Ноды, которые появились при бинаризации правил, берут у своей вершины все
+// атрибуты и передают их выше. Нода цепочки пропускает атрибуты через все
+// правила цепочки, начиная с последнего.
+//
+// Селекторы нетерминалов в правилах (`s : np<case=nom> vp ;`) проверяет
+// уже сам разбор, а здесь атрибуты только собираются для вызывающего кода.
+func (t *Tree) Percolate(h *grammar.HeadRules, features func(Terminal) map[string]grammar.Value) {
+	p := percolator{h: h, features: features}
+	p.node(t)
+}
+
+type percolator struct {
+	h        *grammar.HeadRules
+	features func(Terminal) map[string]grammar.Value
+}
+
+func (p percolator) node(t *Tree) {
+	var res map[string]grammar.Value
+	switch {
+	case len(t.Children) > 0:
+		children := make([]grammar.Ident, len(t.Children))
+		for i, child := range t.Children {
+			p.node(child)
+			children[i] = child.I
+		}
+		if head := p.h.Head(t.I, children); head >= 0 {
+			res = t.Children[head].Features
+		}
+
+	case t.Terminal == nil:
+		return
+
+	default:
+		if p.features != nil {
+			res = p.features(*t.Terminal)
+		} else {
+			res = p.h.Terminal(t.Terminal.Type)
+		}
+		// лист самого терминала, а не правила вида np : noun. Селектор
+		// терминала в грамматике может быть уже, чем у входа (например
+		// noun<case=nom> из np<case=nom>), так что сравниваются только имена
+		if t.I.ID == t.Terminal.Type.ID {
+			t.Features = res
+			return
+		}
+	}
+
+	chain, ok := p.h.Chain(t.I)
+	if !ok {
+		chain = grammar.Chain{t.I}
+	}
+	// в цепочке у каждого правила один потомок, он и есть вершина
+	for i := len(chain) - 1; i >= 0; i-- {
+		res = p.h.Features(chain[i], res)
+	}
+	t.Features = res
+}
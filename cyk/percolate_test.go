@@ -0,0 +1,215 @@
+package cyk_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	. "github.com/quenbyako/parser/cyk"
+	"github.com/quenbyako/parser/grammar"
+	"github.com/quenbyako/parser/slices"
+)
+
+func TestTree_Percolate(t *testing.T) {
+	g, err := grammar.Parse("", strings.NewReader(`
+		@percolate S<num> ;
+		@percolate np<case num> ;
+		@percolate vp<num tense> ;
+		@percolate iv<num> ;
+
+		S  : np vp^ ;
+		np : [det] adj noun^ | pron^ ;
+		vp : verb^ np | iv ;
+		iv : verb ;
+	`), "det", "adj", "noun", "pron", "verb")
+	require.NoError(t, err)
+
+	lexicon := map[string]map[string]grammar.Value{
+		"dogs": {"case": grammar.StringValue("nom"), "num": grammar.StringValue("pl"), "anim": {}},
+		"see":  {"num": grammar.StringValue("pl"), "tense": grammar.StringValue("present")},
+		"bark": {"num": grammar.StringValue("pl"), "tense": grammar.StringValue("present")},
+		"him":  {"case": grammar.StringValue("acc"), "num": grammar.StringValue("sg")},
+	}
+	tags := map[string]string{"the": "det", "big": "adj", "dogs": "noun", "see": "verb", "bark": "verb", "him": "pron"}
+	features := func(term Terminal) map[string]grammar.Value { return lexicon[term.Value] }
+
+	type normalForm interface {
+		Grammar
+		HeadRules() *grammar.HeadRules
+	}
+
+	for _, tt := range []struct {
+		name     string
+		sentence string
+		want     []string
+	}{
+		{"transitive", "the big dogs see him", []string{
+			`S<num="pl">`,
+			`np<case="nom" num="pl">`,
+			`vp<num="pl" tense="present">`,
+			`np<case="acc" num="sg">`,
+		}},
+		// vp : iv ; это цепочка, так что tense до vp не доходит: iv его не
+		// пропускает
+		{"chain", "big dogs bark", []string{
+			`S<num="pl">`,
+			`np<case="nom" num="pl">`,
+			`vp<num="pl">`,
+		}},
+	} {
+		for _, nf := range []normalForm{g.AsBNF().AsCNF("S"), g.AsBNF().As2NF("S")} {
+			var terms []Terminal
+			for _, word := range strings.Fields(tt.sentence) {
+				terms = append(terms, Terminal{Type: terminal(g, tags[word]), Value: word})
+			}
+
+			table := NewParser(nf, BackendTable).Parse(terms).(*Table)
+			tree, ok := table.Forest(nf.Roots()...).Trees(0).Next()
+			require.True(t, ok, tt.name)
+
+			heads := nf.HeadRules()
+			tree.Percolate(heads, features)
+
+			// в CNF iv спрятан в цепочке, а в 2NF остается в дереве, так что
+			// сравниваем только S, np и vp
+			var got []string
+			var walk func(n *Tree)
+			walk = func(n *Tree) {
+				if label := heads.Label(n.I); !label.Generated && map[string]bool{"S": true, "np": true, "vp": true}[label.ID] {
+					got = append(got, grammar.ComplexIdent{ID: label.ID, Properties: n.Features}.String())
+				}
+				for _, child := range n.Children {
+					walk(child)
+				}
+			}
+			walk(tree)
+			require.Equal(t, tt.want, got, "%v: %v", tt.name, tree)
+
+			// атрибуты нетерминала можно проверить селектором
+			np := grammar.ComplexIdent{ID: "np", Properties: map[string]grammar.Value{"case": grammar.StringValue("nom")}}
+			require.True(t, np.Select(grammar.ComplexIdent{ID: "np", Properties: tree.Children[0].Features}), tt.name)
+		}
+	}
+
+	// без атрибутов входа листья берут то, что гарантирует селектор
+	g, err = grammar.Parse("", strings.NewReader(`
+		@percolate S<anim> ;
+		S : noun<anim case=nom>^ verb ;
+	`), "noun", "verb")
+	require.NoError(t, err)
+	cnf := g.AsCNF("S")
+	table := NewParser(cnf, BackendTable).Parse([]Terminal{{Type: terminal(g, "noun")}, {Type: terminal(g, "verb")}}).(*Table)
+	tree, ok := table.Forest(cnf.Roots()...).Trees(0).Next()
+	require.True(t, ok)
+	tree.Percolate(cnf.HeadRules(), nil)
+	require.Equal(t, map[string]grammar.Value{"anim": {}}, tree.Features)
+	require.Equal(t, map[string]grammar.Value{"anim": {}, "case": grammar.StringValue("nom")}, tree.Children[0].Features)
+
+	// вершина берется из того правила, по которому построена нода
+	g, err = grammar.Parse("", strings.NewReader(`
+		@percolate S<num> ;
+		@percolate np<num> ;
+		@percolate vp<num> ;
+		S  : np^ vp | vp^ np ;
+		np : noun ;
+		vp : verb ;
+	`), "noun", "verb")
+	require.NoError(t, err)
+	lexicon = map[string]map[string]grammar.Value{
+		"dogs": {"num": grammar.StringValue("pl")},
+		"runs": {"num": grammar.StringValue("sg")},
+	}
+	for _, nf := range []normalForm{g.AsBNF().AsCNF("S"), g.AsBNF().As2NF("S")} {
+		terms := []Terminal{{Type: terminal(g, "verb"), Value: "runs"}, {Type: terminal(g, "noun"), Value: "dogs"}}
+		table := NewParser(nf, BackendTable).Parse(terms).(*Table)
+		tree, ok := table.Forest(nf.Roots()...).Trees(0).Next()
+		require.True(t, ok)
+		tree.Percolate(nf.HeadRules(), features)
+		require.Equal(t, map[string]grammar.Value{"num": grammar.StringValue("sg")}, tree.Features)
+	}
+}
+
+// селекторы по протекшим атрибутам проверяются при разборе
+func TestTable_Agreement(t *testing.T) {
+	g, err := grammar.Parse("", strings.NewReader(`
+		@percolate S<num> ;
+		@percolate np<case num> ;
+		@percolate vp<num> ;
+		S  : np<case=nom num=sg> vp<num=sg>^ | np<case=nom num=pl> vp<num=pl>^ ;
+		vp : verb^ np<case=acc> | verb^ ;
+		np : [det] noun^ | pron^ ;
+	`), "det", "noun", "pron", "verb")
+	require.NoError(t, err)
+
+	word := func(id string, attrs ...string) grammar.ComplexIdent {
+		res := grammar.ComplexIdent{ID: id, Properties: map[string]grammar.Value{}}
+		for i := 0; i < len(attrs); i += 2 {
+			res.Properties[attrs[i]] = grammar.StringValue(attrs[i+1])
+		}
+		return res
+	}
+	lexicon := map[string]grammar.ComplexIdent{
+		"the":    word("det"),
+		"dog":    word("noun", "case", "nom", "num", "sg"),
+		"dogs":   word("noun", "case", "nom", "num", "pl"),
+		"he":     word("pron", "case", "nom", "num", "sg"),
+		"him":    word("pron", "case", "acc", "num", "sg"),
+		"barks":  word("verb", "num", "sg"),
+		"bark":   word("verb", "num", "pl"),
+		"sees":   word("verb", "num", "sg"),
+		"follow": word("verb", "num", "pl"),
+	}
+	features := func(term Terminal) map[string]grammar.Value { return lexicon[term.Value].Properties }
+
+	cnf, bin := g.AsCNF("S"), g.AsBNF().As2NF("S")
+	for _, nf := range []struct {
+		Grammar
+		terminals map[grammar.Ident]grammar.ComplexIdent
+		heads     *grammar.HeadRules
+	}{
+		{cnf, cnf.Terminals, cnf.HeadRules()},
+		{bin, bin.Terminals, bin.HeadRules()},
+	} {
+		for _, tt := range []struct {
+			sentence string
+			num      string // пустой, если предложение не разбирается
+		}{
+			{"he barks", "sg"},
+			{"dogs bark", "pl"},
+			{"dogs barks", ""},
+			{"him barks", ""},
+			{"he sees him", "sg"},
+			{"he sees he", ""},
+			{"the dogs follow him", "pl"},
+			{"the dog follow him", ""},
+		} {
+			words := strings.Fields(tt.sentence)
+			table := NewTable(len(words))
+			table.Closure = nf.Closure
+			for _, w := range words {
+				// входное слово подходит под все селекторы грамматики, в том
+				// числе под те, что появились из np<case=nom>
+				var matching []grammar.Ident
+				for i, selector := range nf.terminals {
+					if selector.Select(lexicon[w]) {
+						matching = append(matching, i)
+					}
+				}
+				table.AddTerminals(Terminal{Type: terminal(g, lexicon[w].ID), Value: w}, slices.SortEq(matching), nf.Select)
+			}
+
+			roots := table.Forest(nf.Roots()...).Roots()
+			if tt.num == "" {
+				require.Empty(t, roots, tt.sentence)
+				continue
+			}
+			require.NotEmpty(t, roots, tt.sentence)
+
+			tree, ok := roots[0].Trees(0).Next()
+			require.True(t, ok, tt.sentence)
+			tree.Percolate(nf.heads, features)
+			require.Equal(t, map[string]grammar.Value{"num": grammar.StringValue(tt.num)}, tree.Features, tt.sentence)
+		}
+	}
+}
@@ -9,9 +9,7 @@ import (
 
 // https://www.geeksforgeeks.org/cyk-algorithm-for-context-free-grammar/
 func main() {
-	t := &cyk.Table{
-		Data: make(map[cyk.XY][]cyk.NonTerminal),
-	}
+	t := cyk.NewTable(5)
 
 	b, bIdents := cyk.Terminal{Type: grammar.Ident{ID: "b"}}, []grammar.Ident{{ID: "B"}}
 	a, aIdents := cyk.Terminal{Type: grammar.Ident{ID: "a"}}, []grammar.Ident{{ID: "A"}, {ID: "C"}}
@@ -0,0 +1,150 @@
+package cyk
+
+import (
+	"math"
+	"sort"
+
+	"github.com/quenbyako/parser/grammar"
+)
+
+// prune отсекает ноды ячейки по Table.Beam и Table.Threshold. Вместе с
+// нодой пропадают унарные выводы, которые на нее ссылались, а ноды, которые
+// после этого нельзя вывести ни из чего, кроме друг друга, отсекаются
+// тоже. Индексы в унарных выводах пересчитываются.
+func (t *Table) prune(cell XY) {
+	if t.Beam <= 0 && t.Threshold <= 0 {
+		return
+	}
+	nodes := t.cells[spanIndex(cell)]
+	if len(nodes) == 0 {
+		return
+	}
+
+	merit := make([]float64, len(nodes))
+	order := make([]int, len(nodes))
+	for i, node := range nodes {
+		merit[i] = t.figureOfMerit(cell, node)
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return merit[order[a]] > merit[order[b]] })
+
+	keep := make([]bool, len(nodes))
+	limit := merit[order[0]] + math.Log(t.Threshold)
+	for rank, i := range order {
+		if t.Beam > 0 && rank >= t.Beam || t.Threshold > 0 && merit[i] < limit {
+			break
+		}
+		keep[i] = true
+	}
+
+	// нода остается, только если у нее есть вывод не из этой ячейки или
+	// унарный вывод из уже оставшейся
+	grounded := make([]bool, len(nodes))
+	for changed := true; changed; {
+		changed = false
+		for i, node := range nodes {
+			if !keep[i] || grounded[i] {
+				continue
+			}
+			for _, d := range node.Derivations {
+				if !d.IsUnit() || grounded[d.Left.Index] {
+					grounded[i], changed = true, true
+					break
+				}
+			}
+		}
+	}
+
+	remap := make([]int, len(nodes))
+	kept := 0
+	for i := range nodes {
+		remap[i] = -1
+		if grounded[i] {
+			remap[i] = kept
+			kept++
+		}
+	}
+	if kept == len(nodes) {
+		return
+	}
+
+	// ноды меняются местами, а не копируются, что бы у отсеченных остались
+	// свои слайсы выводов для переиспользования
+	var lost bool
+	for i := range nodes {
+		if remap[i] < 0 {
+			continue
+		}
+		nodes[remap[i]], nodes[i] = nodes[i], nodes[remap[i]]
+		node := &nodes[remap[i]]
+
+		derivations := node.Derivations[:0]
+		for _, d := range node.Derivations {
+			if d.IsUnit() {
+				if remap[d.Left.Index] < 0 {
+					lost = true
+					continue
+				}
+				d.Left.Index = remap[d.Left.Index]
+			}
+			derivations = append(derivations, d)
+		}
+		node.Derivations = derivations
+	}
+	t.cells[spanIndex(cell)] = nodes[:kept]
+
+	if lost && t.Weight != nil {
+		t.rescore(cell)
+	}
+}
+
+func (t *Table) figureOfMerit(cell XY, node NonTerminal) float64 {
+	if t.FigureOfMerit == nil {
+		return node.Score
+	}
+
+	return t.FigureOfMerit(cell, node)
+}
+
+// rescore заново считает оценки нод ячейки после того, как у них пропали
+// выводы: сначала по выводам из других ячеек, потом по унарным, пока
+// оценки растут.
+func (t *Table) rescore(cell XY) {
+	nodes := t.cells[spanIndex(cell)]
+	for i := range nodes {
+		nodes[i].Score = math.Inf(-1)
+		for _, d := range nodes[i].Derivations {
+			if !d.IsUnit() {
+				nodes[i].Score = math.Max(nodes[i].Score, t.derivationScore(nodes[i].I, d))
+			}
+		}
+	}
+
+	for pass, changed := 0, true; changed && pass <= len(nodes); pass++ {
+		changed = false
+		for i := range nodes {
+			for _, d := range nodes[i].Derivations {
+				if score := t.derivationScore(nodes[i].I, d); d.IsUnit() && score > nodes[i].Score {
+					nodes[i].Score, changed = score, true
+				}
+			}
+		}
+	}
+}
+
+// derivationScore возвращает оценку вывода d нетерминала i по оценкам его
+// потомков.
+func (t *Table) derivationScore(i grammar.Ident, d Derivation) float64 {
+	switch {
+	case d.IsLeaf():
+		return t.leafScore(d)
+	case d.IsUnit():
+		child := t.node(d.Left)
+		return child.Score + math.Log(t.Weight(i, child.I))
+	default:
+		left, bottom := t.node(d.Left), t.node(d.Bottom)
+		return left.Score + bottom.Score + math.Log(t.Weight(i, left.I, bottom.I))
+	}
+}
+
+func (t *Table) node(c NonTerminalCoord) NonTerminal { return t.cells[spanIndex(c.XY)][c.Index] }
@@ -0,0 +1,73 @@
+package cyk_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	. "github.com/quenbyako/parser/cyk"
+	"github.com/quenbyako/parser/grammar"
+)
+
+func TestTable_Prune(t *testing.T) {
+	g, err := grammar.Parse("", strings.NewReader(`
+		S : P q [0.5] | R q [0.5] ;
+		P : a a [0.9] | a [0.1] ;
+		R : a a [0.1] | a [0.9] ;
+	`), "a", "q")
+	require.NoError(t, err)
+	cnf := g.AsCNF("S")
+
+	for _, tt := range []struct {
+		name     string
+		table    Table
+		expected []string
+	}{{
+		name:     "no pruning",
+		expected: []string{"(S (P a a) q)", "(S (R a a) q)"},
+	}, {
+		name:     "threshold",
+		table:    Table{Threshold: 0.5},
+		expected: []string{"(S (P a a) q)"},
+	}, {
+		name:     "beam",
+		table:    Table{Beam: 1},
+		expected: []string{"(S (P a a) q)"},
+	}, {
+		name: "figure of merit",
+		table: Table{Beam: 1, FigureOfMerit: func(cell XY, node NonTerminal) float64 {
+			if cell.X != cell.Y && node.I.ID == "R" {
+				return 0
+			}
+			return node.Score
+		}},
+		expected: []string{"(S (R a a) q)"},
+	}, {
+		// R выведен из терминала, так что без терминала он тоже пропадает
+		name: "derived nodes",
+		table: Table{Beam: 1, FigureOfMerit: func(cell XY, node NonTerminal) float64 {
+			if node.I.ID == "R" {
+				return 0
+			}
+			return node.Score - 1
+		}},
+		expected: nil,
+	}} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			table := &tt.table
+			table.Closure, table.Weight, table.KeepDerivations = cnf.Closure, cnf.Weight, true
+			for _, word := range strings.Fields("a a q") {
+				term := terminal(g, word)
+				table.AddTerminals(Terminal{Type: term, Value: word}, []grammar.Ident{term}, cnf.Select)
+			}
+
+			var got []string
+			for _, tree := range table.Forest(cnf.Roots()...).KBest(10) {
+				got = append(got, tree.String())
+			}
+			require.Equal(t, tt.expected, got)
+		})
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"math"
 	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/olekukonko/tablewriter"
 	"github.com/quenbyako/parser/grammar"
@@ -24,9 +26,116 @@ func (n XY) String() string { return fmt.Sprintf("coords[%v:%v]", clmconv.Itoa(n
 // Y
 // ↓   ↘
 
+// Table хранит треугольник ячеек в одном слайсе, колонка за колонкой: колонка
+// X целиком лежит сразу после колонки X-1, так что добавление терминала
+// справа только дописывает ячейки в конец, а нижние соседи ячейки лежат в
+// памяти подряд.
+//
+// Ноды таблицы хранят grammar.Ident, а правила ищутся через selector и
+// Closure, то есть через хеши грамматики. Разбор только на числах без
+// деревьев делает BitTable над grammar.Compiled.
+//
+// Нулевое значение готово к работе. Если длина предложения известна заранее,
+// лучше создать таблицу через NewTable, а после разбора вернуть ее в
+// sync.Pool и переиспользовать через Reset.
 type Table struct {
 	terms []Terminal
-	Data  map[XY][]NonTerminal
+	// nonterms[i] это нетерминалы, с которыми добавлен i-й терминал, еще до
+	// Filter. По ним правки пересобирают сдвинутые ячейки.
+	nonterms [][]grammar.Ident
+	cells    [][]NonTerminal
+	// lattice заполнен только у таблицы, собранной из решетки слов (см.
+	// FillLattice).
+	lattice *lattice
+
+	// Closure, если задан, применяется к каждой ячейке сразу после ее
+	// заполнения, пока в ней появляются новые нетерминалы: к каждому
+	// нетерминалу в ячейке дописываются все нетерминалы, которые из него
+	// выводятся унарными правилами (см. grammar.BinaryNF).
+	Closure closureFunc
+
+	// Weight, если задан, включает режим Витерби: у каждого нетерминала в
+	// ячейке остается только самый вероятный вывод, а его логарифм
+	// вероятности лежит в NonTerminal.Score. Weight возвращает вероятность
+	// правила parent : children (см. grammar.CNF.Weight).
+	Weight weightFunc
+
+	// KeepDerivations в режиме Витерби оставляет у нетерминала все выводы,
+	// а не только лучший; Score по-прежнему оценка лучшего. Нужен для
+	// Forest.KBest.
+	KeepDerivations bool
+
+	// Beam и Threshold отсекают ноды сразу после заполнения ячейки: Beam
+	// оставляет не больше Beam нод с лучшей оценкой, а Threshold выкидывает
+	// ноды, которые хуже лучшей в ячейке больше чем в 1/Threshold раз.
+	// Нулевые значения ничего не отсекают.
+	Beam      int
+	Threshold float64
+
+	// FigureOfMerit оценивает ноду для отсечения (логарифм, больше —
+	// лучше). По умолчанию это Score, но сюда можно добавить, например,
+	// оценку внешней вероятности. Для FillParallel функция должна быть
+	// безопасна для конкурентного вызова.
+	FigureOfMerit func(cell XY, node NonTerminal) float64
+
+	// Filter, если задан, не пускает в ячейку нетерминалы, для которых он
+	// вернул false, например те, что не могут стоять в дереве разбора всего
+	// предложения (см. TopDown). Фильтр зависит от координат ячейки, поэтому
+	// InsertTerminal и RemoveTerminal с ним не сдвигают ячейки, а собирают
+	// их заново.
+	Filter filterFunc
+}
+
+var _ Chart = (*Table)(nil)
+
+// NewTable создает таблицу, в которую без переаллокаций помещается
+// предложение из size терминалов.
+func NewTable(size int) *Table {
+	return &Table{
+		terms: make([]Terminal, 0, size),
+		cells: make([][]NonTerminal, 0, cellsCount(size)),
+	}
+}
+
+// spanIndex возвращает индекс ячейки в Table.cells.
+func spanIndex(cell XY) int { return cellsCount(cell.X) + cell.Y }
+
+// cellsCount возвращает количество ячеек в таблице из n терминалов.
+func cellsCount(n int) int { return n * (n + 1) / 2 }
+
+// Reset очищает таблицу, но сохраняет всю выделенную память (в том числе
+// внутри ячеек), так что следующее предложение такой же длины разбирается
+// без аллокаций на хранение. Closure остается прежним.
+func (t *Table) Reset() {
+	t.terms = t.terms[:0]
+	t.nonterms = t.nonterms[:0]
+	t.cells = t.cells[:0]
+	t.lattice = nil
+}
+
+func (t *Table) Len() int { return len(t.terms) }
+
+// Cell возвращает все ноды ячейки. Для координат за пределами таблицы
+// возвращает nil.
+func (t *Table) Cell(cell XY) []NonTerminal {
+	if cell.Y < 0 || cell.Y > cell.X || cell.X >= len(t.terms) {
+		return nil
+	}
+
+	return t.cells[spanIndex(cell)]
+}
+
+func (t *Table) Has(cell XY, i grammar.Ident) bool {
+	return slices.ContainsFunc(t.Cell(cell), func(n NonTerminal) bool { return n.I.Eq(i) })
+}
+
+func (t *Table) Idents(cell XY) []grammar.Ident {
+	res := make([]grammar.Ident, 0, len(t.Cell(cell)))
+	for _, n := range t.Cell(cell) {
+		res = slices.GentlyAppend(res, n.I)
+	}
+
+	return slices.SortEq(res)
 }
 
 func (t *Table) String() string {
@@ -39,7 +148,7 @@ func (t *Table) String() string {
 	for y := range t.terms {
 		row := make([]string, len(t.terms))
 		for x := range t.terms {
-			row[x] = strings.Join(slices.Remap(t.Data[XY{X: x, Y: y}], func(_ int, n NonTerminal) string { return n.I.String() }), ",")
+			row[x] = strings.Join(slices.Remap(t.Cell(XY{X: x, Y: y}), func(_ int, n NonTerminal) string { return n.I.String() }), ",")
 		}
 		w.Append(row)
 	}
@@ -50,19 +159,75 @@ func (t *Table) String() string {
 }
 
 func (t *Table) AddTerminals(term Terminal, nonterms []grammar.Ident, selector selectorFunc) {
-	t.terms = append(t.terms, term)
-	t.Data[termxy(len(t.terms)-1)] = slices.Remap(nonterms, func(_ int, i grammar.Ident) NonTerminal {
-		return NonTerminal{
-			I: i,
-			// просто что бы если была попытка через него найти нетерминал то
-			// улететь в панику
-			Left:   NonTerminalCoord{XY: termxy(math.MaxInt), Index: -1000},
-			Bottom: NonTerminalCoord{XY: termxy(math.MaxInt), Index: -1000},
+	t.checkLinear()
+	t.addTerminal(term, nonterms)
+	t.recalculateLine(len(t.terms)-1, selector)
+}
+
+// FillParallel добавляет в таблицу сразу все терминалы предложения и
+// заполняет ее по диагоналям: все отрезки одной длины друг от друга не
+// зависят, так что каждая диагональ считается пулом из workers горутин.
+// Результат ничем не отличается от последовательных вызовов AddTerminals,
+// порядок нод в каждой ячейке тот же самый.
+//
+// nonterms[i] это нетерминалы для terms[i]. selector и Closure должны быть
+// безопасны для конкурентного вызова.
+func (t *Table) FillParallel(terms []Terminal, nonterms [][]grammar.Ident, selector selectorFunc, workers int) {
+	t.checkLinear()
+	if len(terms) != len(nonterms) {
+		panic(fmt.Sprintf("got %d terminals and %d nonterminal sets", len(terms), len(nonterms)))
+	}
+	if workers < 1 {
+		workers = 1
+	}
+
+	from := len(t.terms)
+	for i, term := range terms {
+		t.addTerminal(term, nonterms[i])
+	}
+
+	for length := 1; length < len(t.terms); length++ {
+		// на каждой диагонали считаем только новые колонки
+		first := from
+		if first < length {
+			first = length
 		}
-	})
 
-	t.recalculateLine(len(t.terms)-1, selector)
+		var next int64 = int64(first) - 1
+		var wg sync.WaitGroup
+		for w := 0; w < workers && w < len(t.terms)-first; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for x := int(atomic.AddInt64(&next, 1)); x < len(t.terms); x = int(atomic.AddInt64(&next, 1)) {
+					t.FillCell(XY{X: x, Y: x - length}, selector)
+				}
+			}()
+		}
+		wg.Wait()
+	}
+}
+
+func (t *Table) addTerminal(term Terminal, nonterms []grammar.Ident) {
+	t.terms = append(t.terms, term)
+	t.nonterms = append(t.nonterms, nonterms)
+	t.growColumn()
 
+	t.setTerminal(len(t.terms)-1, nonterms)
+}
+
+// growColumn дописывает в конец пустые ячейки для последней колонки,
+// переиспользуя память, оставшуюся после Reset.
+func (t *Table) growColumn() {
+	for size := cellsCount(len(t.terms)); len(t.cells) < size; {
+		if len(t.cells) == cap(t.cells) {
+			t.cells = append(t.cells, nil)
+			continue
+		}
+
+		t.cells = t.cells[:len(t.cells)+1]
+		t.cells[len(t.cells)-1] = t.cells[len(t.cells)-1][:0]
+	}
 }
 
 func (t *Table) recalculateLine(i int, selector selectorFunc) {
@@ -74,6 +239,12 @@ func (t *Table) recalculateLine(i int, selector selectorFunc) {
 
 type selectorFunc = func(left, bottom grammar.Ident) ([]grammar.Ident, bool)
 
+type closureFunc = func(grammar.Ident) []grammar.Ident
+
+type weightFunc = func(parent grammar.Ident, children ...grammar.Ident) float64
+
+type filterFunc = func(cell XY, i grammar.Ident) bool
+
 func (t *Table) FillCell(cell XY, selector selectorFunc) {
 	if cell.Y > cell.X {
 		panic("out of bounds")
@@ -92,24 +263,153 @@ func (t *Table) FillCell(cell XY, selector selectorFunc) {
 		BottomCell.Y++
 	}
 
-	resultedTerms := make([]NonTerminal, 0)
+	resultedTerms := t.addEdges(cell, t.cells[spanIndex(cell)][:0])
 	for ; LeftCell.X < cell.X && BottomCell.Y <= cell.X; next() {
-		for leftIndex, leftNode := range t.Data[LeftCell] {
-			for bottomIndex, bottomNode := range t.Data[BottomCell] {
-				if newIdents, ok := selector(leftNode.I, bottomNode.I); ok {
-					resultedTerms = append(resultedTerms,
-						slices.Remap(newIdents, func(_ int, i grammar.Ident) NonTerminal {
-							return NonTerminal{
-								I:      i,
-								Left:   NonTerminalCoord{XY: LeftCell, Index: leftIndex},
-								Bottom: NonTerminalCoord{XY: BottomCell, Index: bottomIndex},
-							}
-						})...,
-					)
+		for leftIndex, leftNode := range t.Cell(LeftCell) {
+			for bottomIndex, bottomNode := range t.Cell(BottomCell) {
+				newIdents, ok := selector(leftNode.I, bottomNode.I)
+				if !ok {
+					continue
+				}
+				d := Derivation{
+					Left:   NonTerminalCoord{XY: LeftCell, Index: leftIndex},
+					Bottom: NonTerminalCoord{XY: BottomCell, Index: bottomIndex},
+				}
+				for _, i := range newIdents {
+					if t.Filter != nil && !t.Filter(cell, i) {
+						continue
+					}
+
+					var score float64
+					if t.Weight != nil {
+						score = leftNode.Score + bottomNode.Score + math.Log(t.Weight(i, leftNode.I, bottomNode.I))
+					}
+					resultedTerms, _ = t.add(resultedTerms, i, d, score)
 				}
 			}
 		}
 	}
 
-	t.Data[cell] = resultedTerms
+	t.cells[spanIndex(cell)] = t.closeCell(cell, resultedTerms)
+	t.prune(cell)
+}
+
+// closeCell дописывает в ячейку унарное замыкание ее нетерминалов. Левая
+// координата такого вывода указывает на ноду в этой же ячейке, из которой он
+// сделан, нижней координаты нет. Новые ноды тоже замыкаются, так что каждая
+// унарная связь в ячейке записана ровно один раз, даже если отношение
+// циклическое.
+//
+// В режиме Витерби улучшение одной ноды может улучшить те, что из нее
+// выведены раньше, поэтому ячейка обходится заново, пока оценки меняются.
+func (t *Table) closeCell(cell XY, nodes []NonTerminal) []NonTerminal {
+	if t.Closure == nil {
+		return nodes
+	}
+
+	for pass, changed := 0, true; changed && pass <= len(nodes); pass++ {
+		changed = false
+		for index := 0; index < len(nodes); index++ {
+			for _, parent := range t.Closure(nodes[index].I) {
+				if t.Filter != nil && !t.Filter(cell, parent) {
+					continue
+				}
+				d := Derivation{Left: NonTerminalCoord{XY: cell, Index: index}, Bottom: noCoord}
+				var score float64
+				if t.Weight != nil {
+					score = nodes[index].Score + math.Log(t.Weight(parent, nodes[index].I))
+				}
+
+				var improved bool
+				nodes, improved = t.add(nodes, parent, d, score)
+				changed = changed || improved
+			}
+		}
+	}
+
+	return nodes
+}
+
+// add добавляет в ячейку вывод d нетерминала i с оценкой score так, как
+// это нужно в текущем режиме таблицы. improved сообщает, что оценка
+// какой-то ноды выросла (без весов всегда false).
+func (t *Table) add(nodes []NonTerminal, i grammar.Ident, d Derivation, score float64) (_ []NonTerminal, improved bool) {
+	switch {
+	case t.Weight == nil:
+		return pack(nodes, i, d), false
+	case t.KeepDerivations:
+		return packAll(nodes, i, d, score)
+	default:
+		return packBest(nodes, i, d, score)
+	}
+}
+
+// pack добавляет в ячейку вывод d нетерминала i: если такой нетерминал в
+// ячейке уже есть, вывод дописывается к его альтернативам. Ноды, оставшиеся
+// в ячейке от прошлого заполнения, переиспользуются вместе с их выводами.
+func pack(nodes []NonTerminal, i grammar.Ident, d Derivation) []NonTerminal {
+	for index := range nodes {
+		if nodes[index].I.Eq(i) {
+			nodes[index].Derivations = append(nodes[index].Derivations, d)
+			return nodes
+		}
+	}
+
+	if len(nodes) == cap(nodes) {
+		return append(nodes, NonTerminal{I: i, Derivations: []Derivation{d}})
+	}
+
+	nodes = nodes[:len(nodes)+1]
+	node := &nodes[len(nodes)-1]
+	node.I = i
+	node.Derivations = append(node.Derivations[:0], d)
+	node.Score = 0
+
+	return nodes
+}
+
+// packBest это pack для режима Витерби: у нетерминала остается только вывод
+// с лучшей оценкой. improved сообщает, что ячейка изменилась.
+func packBest(nodes []NonTerminal, i grammar.Ident, d Derivation, score float64) (_ []NonTerminal, improved bool) {
+	for index := range nodes {
+		if !nodes[index].I.Eq(i) {
+			continue
+		}
+		if score <= nodes[index].Score {
+			return nodes, false
+		}
+
+		nodes[index].Derivations = append(nodes[index].Derivations[:0], d)
+		nodes[index].Score = score
+		return nodes, true
+	}
+
+	nodes = pack(nodes, i, d)
+	nodes[len(nodes)-1].Score = score
+
+	return nodes, true
+}
+
+// packAll это packBest, который сохраняет все выводы (Table.KeepDerivations).
+// Унарные выводы при повторных проходах замыкания не дублируются.
+func packAll(nodes []NonTerminal, i grammar.Ident, d Derivation, score float64) (_ []NonTerminal, improved bool) {
+	for index := range nodes {
+		if !nodes[index].I.Eq(i) {
+			continue
+		}
+		if !d.IsUnit() || !slices.Contains(nodes[index].Derivations, d) {
+			nodes[index].Derivations = append(nodes[index].Derivations, d)
+		}
+		if score <= nodes[index].Score {
+			return nodes, false
+		}
+
+		nodes[index].Score = score
+		return nodes, true
+	}
+
+	nodes = pack(nodes, i, d)
+	nodes[len(nodes)-1].Score = score
+
+	return nodes, true
 }
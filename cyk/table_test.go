@@ -0,0 +1,192 @@
+package cyk_test
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	. "github.com/quenbyako/parser/cyk"
+	"github.com/quenbyako/parser/grammar"
+)
+
+func TestTable_Closure(t *testing.T) {
+	const src = `
+		S : A B | C ;
+		A : [ a ] ;
+		B : b ;
+		C : c [ A ] ;
+	`
+
+	for _, tt := range []struct {
+		name     string
+		input    string
+		expected bool
+	}{
+		{name: "full", input: "a b", expected: true},
+		{name: "nullable", input: "b", expected: true},
+		{name: "chain", input: "c", expected: true},
+		{name: "chain with option", input: "c a", expected: true},
+		{name: "incomplete", input: "a", expected: false},
+		{name: "reversed", input: "b a", expected: false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := grammar.Parse("", strings.NewReader(src), "a", "b", "c")
+			require.NoError(t, err)
+			nf := g.AsBNF().As2NF("S")
+
+			table := &Table{Closure: nf.Closure}
+			words := strings.Fields(tt.input)
+			for _, word := range words {
+				term := terminal(g, word)
+				table.AddTerminals(Terminal{Type: term, Value: word}, []grammar.Ident{term}, nf.Select)
+			}
+
+			top := table.Cell(XY{X: len(words) - 1, Y: 0})
+			require.Equal(t, tt.expected, containsIdent(top, grammar.Ident{ID: nf.StartRule}))
+		})
+	}
+}
+
+func TestTable_ClosureBackPointers(t *testing.T) {
+	g, err := grammar.Parse("", strings.NewReader(`S : A ; A : a ;`), "a")
+	require.NoError(t, err)
+	nf := g.AsBNF().As2NF("S")
+
+	table := &Table{Closure: nf.Closure}
+	term := terminal(g, "a")
+	table.AddTerminals(Terminal{Type: term}, []grammar.Ident{term}, nf.Select)
+
+	cell := table.Cell(XY{})
+	require.Len(t, cell, 3)
+	require.True(t, cell[0].Derivations[0].IsLeaf())
+	for i, node := range cell[1:] {
+		require.Len(t, node.Derivations, 1)
+		require.True(t, node.Derivations[0].IsUnit())
+		// S выводится из A, а не напрямую из терминала
+		require.Equal(t, i, node.Derivations[0].Left.Index)
+	}
+}
+
+func containsIdent(nodes []NonTerminal, i grammar.Ident) bool {
+	for _, node := range nodes {
+		if node.I.Eq(i) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func TestTable_Reset(t *testing.T) {
+	g, err := grammar.Parse("", strings.NewReader(exprGrammar), "num")
+	require.NoError(t, err)
+	cnf := g.AsCNF("expr")
+
+	reused := NewTable(3)
+	reused.Closure = cnf.Closure
+	for _, input := range []string{"num + num", "( num * num )", "num"} {
+		reused.Reset()
+		fresh := &Table{Closure: cnf.Closure}
+		for _, term := range sentence(g, input) {
+			reused.AddTerminals(term, []grammar.Ident{term.Type}, cnf.Select)
+			fresh.AddTerminals(term, []grammar.Ident{term.Type}, cnf.Select)
+		}
+
+		require.Equal(t, fresh.Len(), reused.Len())
+		for y := 0; y < fresh.Len(); y++ {
+			for x := y; x < fresh.Len(); x++ {
+				cell := XY{X: x, Y: y}
+				expected := append([]NonTerminal{}, fresh.Cell(cell)...)
+				require.Equal(t, expected, append([]NonTerminal{}, reused.Cell(cell)...), "%v at %v", input, cell)
+			}
+		}
+	}
+}
+
+func TestTable_FillParallel(t *testing.T) {
+	g, err := grammar.Parse("", strings.NewReader(exprGrammar), "num")
+	require.NoError(t, err)
+	cnf := g.AsCNF("expr")
+
+	terms := sentence(g, "( num + num * - num ) * num + ( num )")
+	nonterms := make([][]grammar.Ident, len(terms))
+	for i, term := range terms {
+		nonterms[i] = []grammar.Ident{term.Type}
+	}
+
+	expected := &Table{Closure: cnf.Closure}
+	for _, term := range terms {
+		expected.AddTerminals(term, []grammar.Ident{term.Type}, cnf.Select)
+	}
+
+	for _, prefix := range []int{0, 1, 5, len(terms)} {
+		got := &Table{Closure: cnf.Closure}
+		for _, term := range terms[:prefix] {
+			got.AddTerminals(term, []grammar.Ident{term.Type}, cnf.Select)
+		}
+		got.FillParallel(terms[prefix:], nonterms[prefix:], cnf.Select, 4)
+
+		require.Equal(t, expected.Len(), got.Len())
+		for y := 0; y < expected.Len(); y++ {
+			for x := y; x < expected.Len(); x++ {
+				cell := XY{X: x, Y: y}
+				require.Equal(t, expected.Cell(cell), got.Cell(cell), "prefix %d at %v", prefix, cell)
+			}
+		}
+	}
+}
+
+func TestTable_Viterbi(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		weights  [2]string
+		expected string
+	}{
+		{"verb attachment", [2]string{"0.6", "0.4"}, "(S (NP n) (VP (VP v (NP n)) (PP p (NP n))))"},
+		{"noun attachment", [2]string{"0.9", "0.1"}, "(S (NP n) (VP v (NP (NP n) (PP p (NP n)))))"},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := grammar.Parse("", strings.NewReader(`
+				S  : NP VP ;
+				VP : v NP [`+tt.weights[0]+`] | VP PP [`+tt.weights[1]+`] ;
+				NP : NP PP [0.2] | n [0.8] ;
+				PP : p NP ;
+			`), "n", "v", "p")
+			require.NoError(t, err)
+			cnf := g.AsCNF("S")
+
+			fill := func(table *Table) {
+				for _, word := range strings.Fields("n v n p n") {
+					term := terminal(g, word)
+					table.AddTerminals(Terminal{Type: term, Value: word}, []grammar.Ident{term}, cnf.Select)
+				}
+			}
+
+			viterbi := &Table{Closure: cnf.Closure, Weight: cnf.Weight}
+			fill(viterbi)
+			best, ok := viterbi.Forest(cnf.Roots()...).Best()
+			require.True(t, ok)
+			require.False(t, best.IsAmbiguous())
+			tree, ok := best.Trees(1).Next()
+			require.True(t, ok)
+			require.Equal(t, tt.expected, tree.String())
+
+			// тот же результат, что и полный перебор всех деревьев
+			full := &Table{Closure: cnf.Closure}
+			fill(full)
+			it := full.Forest(cnf.Roots()...).Trees(0)
+			var bestProb float64
+			var bestTree string
+			for tree, ok := it.Next(); ok; tree, ok = it.Next() {
+				if p := treeProbability(cnf, tree); p > bestProb {
+					bestProb, bestTree = p, tree.String()
+				}
+			}
+			require.Equal(t, bestTree, tree.String())
+			require.InDelta(t, math.Log(bestProb), best.Score(), 1e-9)
+		})
+	}
+}
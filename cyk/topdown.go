@@ -0,0 +1,107 @@
+package cyk
+
+import (
+	"github.com/quenbyako/parser/grammar"
+)
+
+// TopDown возвращает фильтр для Table.Filter, который оставляет только те
+// ноды, которые могут стоять в дереве разбора всего предложения: на
+// отрезках с начала предложения только левые углы корней. Если длина
+// предложения length известна заранее (больше нуля), то на отрезках до его
+// конца остаются только правые углы; дописывать терминалы в такую таблицу
+// потом нельзя.
+func TopDown(c grammar.Corners, length int) filterFunc {
+	return func(cell XY, i grammar.Ident) bool {
+		if cell.Y == 0 && !c.Left.Has(i) {
+			return false
+		}
+		if length > 0 && cell.X == length-1 && !c.Right.Has(i) {
+			return false
+		}
+
+		return true
+	}
+}
+
+// PruneUnreachable удаляет из таблицы все ноды, до которых нельзя дойти от
+// корней roots в ячейке всего предложения, то есть которые не входят ни в
+// одно дерево разбора, и пересчитывает координаты оставшихся. Это
+// последний проход по готовой таблице: после него новые терминалы
+// добавлять нельзя, отрезки с ними будут собраны не полностью.
+func (t *Table) PruneUnreachable(roots ...grammar.Ident) {
+	if len(t.terms) == 0 {
+		return
+	}
+
+	reachable := make([][]bool, len(t.cells))
+	for i, cell := range t.cells {
+		reachable[i] = make([]bool, len(cell))
+	}
+
+	var queue []NonTerminalCoord
+	top := XY{X: len(t.terms) - 1, Y: 0}
+	for index, node := range t.Cell(top) {
+		for _, root := range roots {
+			if node.I.Eq(root) {
+				queue = append(queue, NonTerminalCoord{XY: top, Index: index})
+				break
+			}
+		}
+	}
+	for len(queue) > 0 {
+		c := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		if reachable[spanIndex(c.XY)][c.Index] {
+			continue
+		}
+		reachable[spanIndex(c.XY)][c.Index] = true
+
+		for _, d := range t.node(c).Derivations {
+			if d.IsLeaf() {
+				continue
+			}
+			queue = append(queue, d.Left)
+			if !d.IsUnit() {
+				queue = append(queue, d.Bottom)
+			}
+		}
+	}
+
+	// новые индексы всех нод, -1 у удаленных
+	remap := make([][]int, len(t.cells))
+	for i := range t.cells {
+		remap[i] = make([]int, len(t.cells[i]))
+		kept := 0
+		for j := range t.cells[i] {
+			remap[i][j] = -1
+			if reachable[i][j] {
+				remap[i][j] = kept
+				kept++
+			}
+		}
+	}
+	move := func(c NonTerminalCoord) NonTerminalCoord {
+		if c != noCoord {
+			c.Index = remap[spanIndex(c.XY)][c.Index]
+		}
+		return c
+	}
+
+	for i, nodes := range t.cells {
+		kept := 0
+		for j := range nodes {
+			if remap[i][j] < 0 {
+				continue
+			}
+			// как и в prune, меняем местами, а не копируем
+			nodes[kept], nodes[j] = nodes[j], nodes[kept]
+			for k, d := range nodes[kept].Derivations {
+				if !d.IsLeaf() {
+					nodes[kept].Derivations[k] = Derivation{Left: move(d.Left), Bottom: move(d.Bottom)}
+				}
+			}
+			kept++
+		}
+		t.cells[i] = nodes[:kept]
+	}
+}
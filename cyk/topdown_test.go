@@ -0,0 +1,90 @@
+package cyk_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	. "github.com/quenbyako/parser/cyk"
+	"github.com/quenbyako/parser/grammar"
+)
+
+func TestTable_TopDown(t *testing.T) {
+	g, err := grammar.Parse("", strings.NewReader(`
+		S  : NP VP ;
+		VP : v NP | VP PP ;
+		NP : NP PP | n ;
+		PP : p NP ;
+		Q  : p n ;
+	`), "n", "v", "p")
+	require.NoError(t, err)
+	cnf := g.AsCNF("S")
+	words := strings.Fields("n v n p n p n")
+
+	fill := func(table *Table) *Table {
+		table.Closure = cnf.Closure
+		for _, word := range words {
+			term := terminal(g, word)
+			table.AddTerminals(Terminal{Type: term, Value: word}, []grammar.Ident{term}, cnf.Select)
+		}
+		return table
+	}
+	trees := func(table *Table) (res []string) {
+		it := table.Forest(cnf.Roots()...).Trees(0)
+		for tree, ok := it.Next(); ok; tree, ok = it.Next() {
+			res = append(res, tree.String())
+		}
+		return res
+	}
+	size := func(table *Table) (res int) {
+		for x := 0; x < table.Len(); x++ {
+			for y := 0; y <= x; y++ {
+				res += len(table.Cell(XY{X: x, Y: y}))
+			}
+		}
+		return res
+	}
+
+	full := fill(&Table{})
+	filtered := fill(&Table{Filter: TopDown(cnf.Corners(), len(words))})
+	require.Equal(t, trees(full), trees(filtered))
+	// Q в конце предложения не правый угол S
+	require.False(t, filtered.Has(XY{X: 6, Y: 5}, grammar.Ident{ID: "Q"}))
+	require.True(t, full.Has(XY{X: 6, Y: 5}, grammar.Ident{ID: "Q"}))
+	require.Less(t, size(filtered), size(full))
+
+	filtered.PruneUnreachable(cnf.Roots()...)
+	require.Equal(t, trees(full), trees(filtered))
+	// S на "n v n" в разбор всего предложения не входит
+	require.False(t, filtered.Has(XY{X: 2, Y: 0}, grammar.Ident{ID: "S"}))
+
+	forest := filtered.Forest(cnf.Roots()...)
+	reachable := 0
+	for _, root := range forest.Roots() {
+		forest.Each(root, func(ForestNode) bool { reachable++; return true })
+	}
+	require.Equal(t, reachable, size(filtered))
+
+	// правки в начале предложения меняют, какие ячейки начинают его, так что
+	// фильтр применяется к ним заново
+	edited := fill(&Table{Filter: TopDown(cnf.Corners(), 0)})
+	check := func(sentence string) {
+		words = strings.Fields(sentence)
+		expected := fill(&Table{Filter: TopDown(cnf.Corners(), 0)})
+		require.Equal(t, expected.Len(), edited.Len(), sentence)
+		for x := 0; x < expected.Len(); x++ {
+			for y := 0; y <= x; y++ {
+				cell := XY{X: x, Y: y}
+				require.Equal(t, expected.Idents(cell), edited.Idents(cell), "%v at %v", sentence, cell)
+			}
+		}
+	}
+	n := terminal(g, "n")
+	edited.RemoveTerminal(0, cnf.Select)
+	check("v n p n p n")
+	edited.InsertTerminal(0, Terminal{Type: n, Value: "n"}, []grammar.Ident{n}, cnf.Select)
+	check("n v n p n p n")
+	edited.RemoveTerminal(3, cnf.Select)
+	check("n v n n p n")
+}
@@ -0,0 +1,232 @@
+package cyk
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+
+	"github.com/quenbyako/parser/grammar"
+)
+
+// Tree это одно дерево разбора, развернутое из леса.
+type Tree struct {
+	I    grammar.Ident
+	Span XY
+	// Terminal заполнен только у листьев, то есть у нетерминалов, которые
+	// пришли в таблицу вместе с терминалом.
+	Terminal *Terminal
+	// Features это атрибуты ноды, их заполняет Percolate.
+	Features map[string]grammar.Value
+
+	Children []*Tree
+}
+
+func (t *Tree) String() string {
+	if len(t.Children) == 0 {
+		return t.I.String()
+	}
+
+	children := make([]string, len(t.Children))
+	for i, child := range t.Children {
+		children[i] = child.String()
+	}
+
+	return fmt.Sprintf("(%v %v)", t.I, strings.Join(children, " "))
+}
+
+// Count возвращает количество деревьев разбора всего предложения: сумму по
+// всем корням. Считается снизу вверх, каждая нода леса считается один раз.
+//
+// Цикл из унарных правил дает бесконечно много деревьев, поэтому здесь (и в
+// Trees) учитываются только деревья, в которых ни одна нода леса не
+// повторяется на пути от корня к листу.
+func (f Forest) Count() *big.Int {
+	c := newCounter(f)
+	res := new(big.Int)
+	for _, root := range f.Roots() {
+		n, _ := c.count(root.coord)
+		res.Add(res, n)
+	}
+
+	return res
+}
+
+// Trees возвращает итератор, который разворачивает деревья разбора всего
+// предложения по одному. Порядок детерминирован: корни идут в порядке
+// Roots, альтернативы каждой ноды в порядке Alternatives, а внутри
+// бинарной альтернативы быстрее всего меняется правое поддерево. limit
+// ограничивает количество деревьев, 0 и меньше — без ограничения.
+//
+// Каждое дерево строится заново по своему номеру, так что память на обход
+// не зависит от того, сколько всего деревьев в лесу.
+func (f Forest) Trees(limit int) *TreeIterator { return newTreeIterator(f, f.Roots(), limit) }
+
+// Trees это Forest.Trees для деревьев с корнем в этой ноде.
+func (n ForestNode) Trees(limit int) *TreeIterator {
+	return newTreeIterator(n.f, []ForestNode{n}, limit)
+}
+
+func newTreeIterator(f Forest, roots []ForestNode, limit int) *TreeIterator {
+	it := &TreeIterator{
+		c:     newCounter(f),
+		roots: roots,
+		next:  new(big.Int),
+		limit: limit,
+	}
+	if len(it.roots) > 0 {
+		it.total, _ = it.c.count(it.roots[0].coord)
+	}
+
+	return it
+}
+
+// TreeIterator лениво перебирает деревья разбора, см. Forest.Trees.
+type TreeIterator struct {
+	c     *counter
+	roots []ForestNode
+	root  int
+	next  *big.Int // номер следующего дерева у текущего корня
+	total *big.Int // количество деревьев у текущего корня
+
+	limit int
+	done  int
+}
+
+// Next возвращает следующее дерево. Когда деревья закончились или
+// достигнут лимит, ok будет false.
+func (it *TreeIterator) Next() (_ *Tree, ok bool) {
+	if it.limit > 0 && it.done >= it.limit {
+		return nil, false
+	}
+
+	for it.root < len(it.roots) && it.next.Cmp(it.total) >= 0 {
+		it.root++
+		it.next.SetInt64(0)
+		if it.root < len(it.roots) {
+			it.total, _ = it.c.count(it.roots[it.root].coord)
+		}
+	}
+	if it.root >= len(it.roots) {
+		return nil, false
+	}
+
+	res := it.c.tree(it.roots[it.root].coord, new(big.Int).Set(it.next))
+	it.next.Add(it.next, big.NewInt(1))
+	it.done++
+
+	return res, true
+}
+
+// counter считает деревья у нод леса. Количество зависит от того, какие
+// ноды уже стоят на пути от корня (они отрезаются, что бы не уйти в цикл),
+// поэтому запоминаются только те значения, при подсчете которых не
+// пришлось отрезать ни одного предка.
+type counter struct {
+	f        Forest
+	memo     map[NonTerminalCoord]*big.Int
+	visiting map[NonTerminalCoord]int // нода -> глубина на текущем пути
+}
+
+func newCounter(f Forest) *counter {
+	return &counter{
+		f:        f,
+		memo:     make(map[NonTerminalCoord]*big.Int),
+		visiting: make(map[NonTerminalCoord]int),
+	}
+}
+
+func (c *counter) node(n NonTerminalCoord) NonTerminal {
+	return c.f.t.cells[spanIndex(n.XY)][n.Index]
+}
+
+// count возвращает количество деревьев ноды n и минимальную глубину
+// отрезанного предка (math.MaxInt, если ничего не отрезано).
+func (c *counter) count(n NonTerminalCoord) (_ *big.Int, low int) {
+	if res, ok := c.memo[n]; ok {
+		return res, math.MaxInt
+	}
+	if depth, ok := c.visiting[n]; ok {
+		return new(big.Int), depth
+	}
+
+	depth := len(c.visiting)
+	c.visiting[n] = depth
+	defer delete(c.visiting, n)
+
+	res, low := new(big.Int), math.MaxInt
+	for _, d := range c.node(n).Derivations {
+		switch {
+		case d.IsLeaf():
+			res.Add(res, big.NewInt(1))
+		case d.IsUnit():
+			child, l := c.count(d.Left)
+			res.Add(res, child)
+			low = minInt(low, l)
+		default:
+			left, l1 := c.count(d.Left)
+			right, l2 := c.count(d.Bottom)
+			res.Add(res, new(big.Int).Mul(left, right))
+			low = minInt(low, minInt(l1, l2))
+		}
+	}
+
+	if low >= depth {
+		c.memo[n] = res
+		low = math.MaxInt
+	}
+
+	return res, low
+}
+
+// tree строит дерево ноды n с номером k. k должен быть меньше count(n) при
+// том же пути от корня, и меняется по ходу.
+func (c *counter) tree(n NonTerminalCoord, k *big.Int) *Tree {
+	node := c.node(n)
+	res := &Tree{I: node.I, Span: n.XY}
+
+	c.visiting[n] = len(c.visiting)
+	defer delete(c.visiting, n)
+
+	for _, d := range node.Derivations {
+		switch {
+		case d.IsLeaf():
+			if k.Sign() == 0 {
+				term := c.f.t.leaf(n.XY, d)
+				res.Terminal = &term
+				return res
+			}
+			k.Sub(k, big.NewInt(1))
+
+		case d.IsUnit():
+			child, _ := c.count(d.Left)
+			if k.Cmp(child) < 0 {
+				res.Children = []*Tree{c.tree(d.Left, k)}
+				return res
+			}
+			k.Sub(k, child)
+
+		default:
+			left, _ := c.count(d.Left)
+			right, _ := c.count(d.Bottom)
+			if total := new(big.Int).Mul(left, right); k.Cmp(total) >= 0 {
+				k.Sub(k, total)
+				continue
+			}
+
+			li, ri := new(big.Int).QuoRem(k, right, new(big.Int))
+			res.Children = []*Tree{c.tree(d.Left, li), c.tree(d.Bottom, ri)}
+			return res
+		}
+	}
+
+	panic(fmt.Sprintf("tree number is out of range for %v%v", node.I, n.XY))
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
@@ -0,0 +1,69 @@
+package cyk_test
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	. "github.com/quenbyako/parser/cyk"
+	"github.com/quenbyako/parser/grammar"
+	"github.com/quenbyako/parser/slices"
+)
+
+func TestForest_Trees(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		grammar  string
+		words    int
+		expected int64
+	}{
+		// числа Каталана
+		{"catalan 1", `S : S S | a ;`, 1, 1},
+		{"catalan 4", `S : S S | a ;`, 4, 5},
+		{"catalan 6", `S : S S | a ;`, 6, 42},
+		{"unit cycle", `S : A | a ; A : S ;`, 1, 1},
+		{"unit cycle pairs", `S : A | S S | a ; A : S ;`, 3, 2},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := grammar.Parse("", strings.NewReader(tt.grammar), "a")
+			require.NoError(t, err)
+			nf := g.AsBNF().As2NF("S")
+
+			table := &Table{Closure: nf.Closure}
+			term := terminal(g, "a")
+			for i := 0; i < tt.words; i++ {
+				table.AddTerminals(Terminal{Type: term}, []grammar.Ident{term}, nf.Select)
+			}
+
+			forest := table.Forest(nf.Roots()...)
+			require.Equal(t, big.NewInt(tt.expected), forest.Count())
+
+			var trees []string
+			for it := forest.Trees(0); ; {
+				tree, ok := it.Next()
+				if !ok {
+					break
+				}
+				trees = append(trees, tree.String())
+			}
+			require.Len(t, trees, int(tt.expected))
+			require.Len(t, slices.ToMap(trees), len(trees), "trees must be unique")
+
+			var limited []string
+			for it := forest.Trees(2); ; {
+				tree, ok := it.Next()
+				if !ok {
+					break
+				}
+				limited = append(limited, tree.String())
+			}
+			if len(trees) > 2 {
+				trees = trees[:2]
+			}
+			require.Equal(t, trees, limited)
+		})
+	}
+}
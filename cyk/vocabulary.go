@@ -0,0 +1,267 @@
+package cyk
+
+import (
+	"github.com/quenbyako/parser/grammar"
+)
+
+// Vocabulary это словарь генератора текста, наложенный на терминалы
+// грамматики. Токен словаря это произвольная строка: он может состоять из
+// нескольких терминалов, начинаться или заканчиваться посреди терминала.
+//
+// Константы пишутся своим значением, а остальные терминалы — словами из
+// words. Терминалы, у которых нет ни одного написания, сгенерировать
+// нельзя. Между терминалами можно (но не обязательно) ставить пробелы,
+// табы и переводы строк.
+type Vocabulary struct {
+	start  *Recognizer
+	tokens []string
+
+	trie     []tokenNode
+	spelling []spellingNode
+}
+
+// tokenNode это узел префиксного дерева токенов словаря.
+type tokenNode struct {
+	edges trieEdges
+	ends  []int
+}
+
+// spellingNode это узел префиксного дерева написаний терминалов.
+type spellingNode struct {
+	edges trieEdges
+	ends  []grammar.Symbol
+	// longer это терминалы, у которых есть написание длиннее этого узла и
+	// начинающееся с него.
+	longer bitset
+}
+
+type trieEdge struct {
+	b    byte
+	node int
+}
+
+type trieEdges []trieEdge
+
+func (e trieEdges) child(b byte) (int, bool) {
+	for _, edge := range e {
+		if edge.b == b {
+			return edge.node, true
+		}
+	}
+
+	return 0, false
+}
+
+// NewVocabulary собирает словарь tokens для грамматики g. words это
+// написания терминалов, слова для символов, которые не являются
+// терминалами g, пропускаются.
+func NewVocabulary(g Grammar, tokens []string, words map[grammar.Ident][]string) *Vocabulary {
+	v := &Vocabulary{start: NewRecognizer(g), tokens: tokens, trie: []tokenNode{{}}}
+	c := v.start.e.c
+
+	for i, token := range tokens {
+		node := 0
+		for j := 0; j < len(token); j++ {
+			next, ok := v.trie[node].edges.child(token[j])
+			if !ok {
+				next = len(v.trie)
+				v.trie = append(v.trie, tokenNode{})
+				v.trie[node].edges = append(v.trie[node].edges, trieEdge{b: token[j], node: next})
+			}
+			node = next
+		}
+		v.trie[node].ends = append(v.trie[node].ends, i)
+	}
+
+	v.spelling = []spellingNode{{longer: newBitset(c.Len())}}
+	for s := 0; s < c.Len(); s++ {
+		sym := grammar.Symbol(s)
+		if !c.IsTerminal(sym) {
+			continue
+		}
+		spellings := words[c.Ident(sym)]
+		if value, ok := c.Constant(sym); ok {
+			spellings = append([]string{value}, spellings...)
+		}
+		for _, word := range spellings {
+			v.addSpelling(sym, word)
+		}
+	}
+
+	return v
+}
+
+func (v *Vocabulary) addSpelling(s grammar.Symbol, word string) {
+	if word == "" {
+		return
+	}
+
+	node := 0
+	for j := 0; j < len(word); j++ {
+		v.spelling[node].longer.set(int(s))
+		next, ok := v.spelling[node].edges.child(word[j])
+		if !ok {
+			next = len(v.spelling)
+			v.spelling = append(v.spelling, spellingNode{longer: newBitset(len(v.spelling[0].longer) * wordSize)})
+			v.spelling[node].edges = append(v.spelling[node].edges, trieEdge{b: word[j], node: next})
+		}
+		node = next
+	}
+	for _, end := range v.spelling[node].ends {
+		if end == s {
+			return
+		}
+	}
+	v.spelling[node].ends = append(v.spelling[node].ends, s)
+}
+
+// Len возвращает количество токенов в словаре.
+func (v *Vocabulary) Len() int { return len(v.tokens) }
+
+// Mask это множество токенов словаря: токен i входит в него, если
+// выставлен бит i%64 слова i/64.
+type Mask []uint64
+
+func (m Mask) Has(i int) bool { return bitset(m).has(i) }
+
+// Constraint ограничивает генерацию текста предложениями грамматики:
+// перед каждым шагом генератора Mask говорит, какие токены можно выбрать,
+// а Advance принимает выбранный.
+type Constraint struct {
+	v *Vocabulary
+	// cursors это все способы разрезать уже принятый текст на терминалы.
+	cursors []cursor
+}
+
+// cursor это один способ разрезать текст: r принял все законченные
+// терминалы, а node это узел дерева написаний, до которого дошел
+// недописанный терминал (0, если текст кончается между терминалами).
+type cursor struct {
+	r    *Recognizer
+	node int
+}
+
+// NewConstraint возвращает ограничение для пустого текста.
+func NewConstraint(v *Vocabulary) *Constraint {
+	return &Constraint{v: v, cursors: []cursor{{r: v.start.Fork()}}}
+}
+
+// Mask возвращает токены, после которых текст еще можно дополнить до
+// предложения. Токены перебираются по префиксному дереву, так что общие
+// начала токенов проверяются один раз.
+func (c *Constraint) Mask() Mask {
+	st := &stepper{v: c.v, fed: make(map[fedKey]*Recognizer)}
+	res := newBitset(len(c.v.tokens))
+
+	var walk func(node int, cursors []cursor)
+	walk = func(node int, cursors []cursor) {
+		for _, token := range c.v.trie[node].ends {
+			res.set(token)
+		}
+		for _, edge := range c.v.trie[node].edges {
+			if next := st.step(cursors, edge.b); len(next) > 0 {
+				walk(edge.node, next)
+			}
+		}
+	}
+	walk(0, c.cursors)
+
+	return Mask(res)
+}
+
+// Advance принимает токен словаря. Если он не входит в Mask, возвращает
+// false и ничего не меняет.
+func (c *Constraint) Advance(token int) bool {
+	return c.AdvanceString(c.v.tokens[token])
+}
+
+// AdvanceString принимает произвольный текст, например подсказку, с
+// которой начинается генерация. Если после него текст нельзя дополнить
+// до предложения, возвращает false и ничего не меняет.
+func (c *Constraint) AdvanceString(text string) bool {
+	st := &stepper{v: c.v, fed: make(map[fedKey]*Recognizer)}
+	cursors := c.cursors
+	for i := 0; i < len(text) && len(cursors) > 0; i++ {
+		cursors = st.step(cursors, text[i])
+	}
+	if len(cursors) == 0 {
+		return false
+	}
+	c.cursors = cursors
+
+	return true
+}
+
+// Accepts сообщает, что принятый текст это целое предложение, то есть
+// генерацию можно закончить.
+func (c *Constraint) Accepts() bool {
+	for _, cur := range c.cursors {
+		if cur.node == 0 && cur.r.Accepts() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// stepper двигает курсоры по одному байту. Распознаватели, полученные
+// после одного и того же терминала, переиспользуются, так что разные
+// токены с общим началом не пересчитывают одни и те же множества Эрли.
+type stepper struct {
+	v   *Vocabulary
+	fed map[fedKey]*Recognizer
+}
+
+type fedKey struct {
+	r *Recognizer
+	s grammar.Symbol
+}
+
+func (st *stepper) step(cursors []cursor, b byte) []cursor {
+	var res []cursor
+	add := func(cur cursor) {
+		for _, c := range res {
+			if c == cur {
+				return
+			}
+		}
+		res = append(res, cur)
+	}
+
+	for _, cur := range cursors {
+		if cur.node == 0 && isSpace(b) {
+			add(cur)
+		}
+
+		child, ok := st.v.spelling[cur.node].edges.child(b)
+		if !ok {
+			continue
+		}
+		node, predicted := &st.v.spelling[child], cur.r.last().predicted
+		if node.longer.intersects(predicted) {
+			add(cursor{r: cur.r, node: child})
+		}
+		for _, s := range node.ends {
+			if predicted.has(int(s)) {
+				add(cursor{r: st.feed(cur.r, s)})
+			}
+		}
+	}
+
+	return res
+}
+
+func (st *stepper) feed(r *Recognizer, s grammar.Symbol) *Recognizer {
+	key := fedKey{r: r, s: s}
+	if next, ok := st.fed[key]; ok {
+		return next
+	}
+
+	next := r.Fork()
+	next.feed(s)
+	st.fed[key] = next
+
+	return next
+}
+
+func isSpace(b byte) bool { return b == ' ' || b == '\t' || b == '\n' || b == '\r' }
@@ -0,0 +1,61 @@
+package cyk_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	. "github.com/quenbyako/parser/cyk"
+	"github.com/quenbyako/parser/grammar"
+)
+
+func TestConstraint(t *testing.T) {
+	g, err := grammar.Parse("", strings.NewReader(`
+		expr   : expr "+" term | term ;
+		term   : term "*" factor | factor ;
+		factor : "(" expr ")" | num ;
+	`), "num")
+	require.NoError(t, err)
+
+	tokens := []string{"1", "2", "+", "*", "(", ")", " ", "1+", "+(", ")*", "12", "x", "(1", " +"}
+	index := make(map[string]int)
+	for i, token := range tokens {
+		index[token] = i
+	}
+	v := NewVocabulary(g.AsCNF("expr"), tokens, map[grammar.Ident][]string{
+		terminal(g, "num"): {"1", "2", "12"},
+	})
+	require.Equal(t, len(tokens), v.Len())
+
+	mask := func(c *Constraint) []string {
+		m := c.Mask()
+		var res []string
+		for i, token := range tokens {
+			if m.Has(i) {
+				res = append(res, token)
+			}
+		}
+		return res
+	}
+
+	c := NewConstraint(v)
+	require.Equal(t, []string{"1", "2", "(", " ", "1+", "12", "(1"}, mask(c))
+
+	require.True(t, c.Advance(index["(1"]))
+	require.Equal(t, []string{"2", "+", "*", ")", " ", "+(", ")*", " +"}, mask(c))
+	require.False(t, c.Advance(index["x"]))
+	require.False(t, c.Advance(index["1+"]))
+
+	require.True(t, c.Advance(index[")*"]))
+	require.False(t, c.Accepts())
+	require.True(t, c.AdvanceString(" 2"))
+	require.True(t, c.Accepts())
+
+	// "1" может оказаться началом "12"
+	require.True(t, c.Advance(index["+"]))
+	require.True(t, c.Advance(index["1"]))
+	require.True(t, c.Accepts())
+	require.True(t, c.Advance(index["2"]))
+	require.True(t, c.Accepts())
+}
@@ -0,0 +1,159 @@
+package grammar
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/quenbyako/parser/slices"
+	"golang.org/x/exp/maps"
+)
+
+// BinaryNF это грамматика в бинарной нормальной форме (2NF). В отличии от CNF
+// здесь правила только разбиваются на правила длиной не больше двух, а
+// эпсилон и цепочные правила остаются на месте. Вместо их удаления заранее
+// считается унарное отношение, которое CYK применяет к каждой ячейке, так что
+// размер грамматики растет линейно, а дерево разбора восстанавливается без
+// всяких ChainList.
+//
+// Lange, Leiß — To CNF or not to CNF? An Efficient Yet Presentable Version of
+// the CYK Algorithm (2009)
+type BinaryNF struct {
+	StartRule  string
+	CanBeEmpty bool
+
+	Rules map[Ident]HashSet[DualRule]
+
+	// Nullable это все нетерминалы, из которых выводится пустая строка
+	Nullable Set[Ident]
+
+	// Units это замкнутое обратное унарное отношение: ключ — терминал или
+	// нетерминал, значения — все нетерминалы, которые из него "вырастают" без
+	// поглощения новых терминалов. То есть A входит в Units[B], если A ⇒⁺ B с
+	// учетом цепочных правил и правил вида A : B C, где C nullable.
+	Units map[Ident]Set[Ident]
+
+	Terminals map[Ident]ComplexIdent
+	Constants map[uint64]string
+	Heads     Heads
+
+	// обратный индекс для Select
+	combinations map[DualRule][]Ident
+	// незамкнутое унарное отношение, его отдает Closure
+	parents map[Ident]Set[Ident]
+}
+
+func (g *BinaryNF) String() string {
+	rulesStr := make([]string, 0, len(g.Rules))
+	for _, name := range slices.SortEq(maps.Keys(g.Rules)) {
+		for _, rule := range slices.SortEq(maps.Values(g.Rules[name])) {
+			rulesStr = append(rulesStr, fmt.Sprintf("%v -> %v %v .", name, rule[0], rule[1]))
+		}
+	}
+
+	for _, child := range slices.SortEq(maps.Keys(g.Units)) {
+		for _, parent := range slices.SortEq(maps.Keys(g.Units[child])) {
+			rulesStr = append(rulesStr, fmt.Sprintf("%v => %v", parent, child))
+		}
+	}
+
+	return strings.Join(rulesStr, "\n")
+}
+
+// Select возвращает все нетерминалы, которые собираются из пары left, bottom
+// одним бинарным правилом. Подходит в качестве селектора для cyk.Table.
+func (g *BinaryNF) Select(left, bottom Ident) ([]Ident, bool) {
+	res, ok := g.combinations[DualRule{left, bottom}]
+	return res, ok
+}
+
+// Closure возвращает нетерминалы, которые выводят i одним шагом унарного
+// отношения. Таблица применяет его до неподвижной точки, так что каждая
+// унарная связь попадает в лес разбора ровно один раз, без транзитивных
+// "срезок", которые есть в Units.
+func (g *BinaryNF) Closure(i Ident) []Ident { return slices.SortEq(maps.Keys(g.parents[i])) }
+
+// Combinations возвращает обратный индекс бинарных правил: пара селекторов ->
+// все нетерминалы, которые из нее собираются. Индекс менять нельзя.
+func (g *BinaryNF) Combinations() map[DualRule][]Ident { return g.combinations }
+
+// Roots возвращает нетерминалы, которые могут оказаться в корне дерева
+// разбора. Цепочки в 2NF не удаляются, так что это только стартовое правило.
+func (g *BinaryNF) Roots() []Ident { return []Ident{{ID: g.StartRule}} }
+
+// Compile собирает из грамматики неизменяемую Compiled.
+func (g *BinaryNF) Compile() *Compiled { return compile(g, g.Terminals, g.Constants) }
+
+// As2NF приводит грамматику к бинарной нормальной форме. Метод меняет саму
+// грамматику: длинные правила в ней разбиваются на короткие.
+func (g *BNF) As2NF(startRule string) *BinaryNF {
+	start := Ident{ID: startRule}
+	if _, found := g.Rules[start]; !found {
+		panic("start rule not found!")
+	}
+
+	g.ExplodeLongRules()
+
+	nullable := g.FindEpsilon(g.terminalSet())
+
+	res := &BinaryNF{
+		StartRule:  startRule,
+		CanBeEmpty: nullable.Has(start),
+		Rules:      make(map[Ident]HashSet[DualRule]),
+		Nullable:   nullable,
+		Terminals:  g.Terminals,
+		Constants:  g.Constants,
+		Heads:      g.Heads,
+	}
+
+	parents := make(map[Ident]Set[Ident])
+	for rule := range g.Rules.IterRules() {
+		switch len(rule.Rule) {
+		case 0:
+			// уже учтено в nullable
+		case 1:
+			parents[rule.Rule[0]] = parents[rule.Rule[0]].Append(rule.Name)
+		case 2:
+			left, right := rule.Rule[0], rule.Rule[1]
+			res.Rules[rule.Name] = res.Rules[rule.Name].Append(DualRule{left, right})
+			if nullable.Has(right) {
+				parents[left] = parents[left].Append(rule.Name)
+			}
+			if nullable.Has(left) {
+				parents[right] = parents[right].Append(rule.Name)
+			}
+		default:
+			panic("got too long rule! " + fmt.Sprintf("%v : %v ;", rule.Name, rule.Rule.String()))
+		}
+	}
+
+	res.combinations = combineRules(res.Rules)
+	res.parents = parents
+	res.Units = closeUnits(parents)
+
+	return res
+}
+
+// closeUnits считает транзитивное замыкание унарного отношения обходом в
+// ширину от каждого селектора.
+func closeUnits(parents map[Ident]Set[Ident]) map[Ident]Set[Ident] {
+	res := make(map[Ident]Set[Ident], len(parents))
+	for child := range parents {
+		closure := make(Set[Ident])
+		queue := maps.Keys(parents[child])
+		for len(queue) > 0 {
+			next := queue[0]
+			queue = queue[1:]
+			if closure.Has(next) || next == child {
+				continue
+			}
+			closure[next] = struct{}{}
+			queue = append(queue, maps.Keys(parents[next])...)
+		}
+
+		if len(closure) > 0 {
+			res[child] = closure
+		}
+	}
+
+	return res
+}
@@ -165,15 +165,36 @@ func (l ChainList) String() string {
 	return stringify(sorted, "\n")
 }
 
+// GenerateReplaces возвращает для каждого начала цепочки все, чем его можно
+// заменить в правилах: сам нетерминал (у него могут остаться не цепочные
+// правила) и идентификаторы всех цепочек, которые с него начинаются.
 func (l ChainList) GenerateReplaces() map[Ident][]IdentSet {
 	res := make(map[Ident][]IdentSet)
 	for _, obj := range l {
-		res[obj.Chain[0]] = append(res[obj.Chain[len(obj.Chain)-1]], IdentSet{obj.From})
+		from := obj.Chain[0]
+		if _, ok := res[from]; !ok {
+			res[from] = []IdentSet{{from}}
+		}
+		res[from] = append(res[from], IdentSet{obj.From})
 	}
 
 	return res
 }
 
+// Variants возвращает сам идентификатор и все идентификаторы цепочек, которые с
+// него начинаются. После PopChains любой из них может стоять на месте
+// исходного нетерминала, например в корне дерева разбора.
+func (l ChainList) Variants(i Ident) []Ident {
+	res := []Ident{i}
+	for _, obj := range l {
+		if obj.Chain[0] == i {
+			res = append(res, obj.From)
+		}
+	}
+
+	return slices.SortEq(res)
+}
+
 // PopChains заменяет все цепочные правила, при этом сохраняя информацию о том,
 // какие цепочки конкретно были заменены.
 //
@@ -182,11 +203,18 @@ func (l ChainList) GenerateReplaces() map[Ident][]IdentSet {
 func (g *BNF) PopChains() ChainList {
 	res := make(RuleSet)
 	chains := make(ChainList)
+	terms := g.terminalSet()
+	weights := g.Weights.like()
+	heads := g.Heads.like()
 
 	for name, rules := range g.Rules {
 		for _, rule := range rules {
-			if !rule.isChain(slices.ToMap(maps.Keys(g.Terminals))) {
+			if !rule.isChain(terms) {
 				res = res.AppendRules(name, rule)
+				weights.add(name, rule, g.Weights.Get(name, rule))
+				if head, ok := g.Heads.Get(name, rule); ok {
+					heads.set(name, rule, head)
+				}
 				continue
 			}
 			if name == rule[0] {
@@ -195,20 +223,24 @@ func (g *BNF) PopChains() ChainList {
 				continue
 			}
 
-			res, chains = g.getAllChainVariations(res, chains, []Ident{name, rule[0]})
+			res, chains = g.getAllChainVariations(res, chains, terms, []Ident{name, rule[0]}, weights, heads, g.Weights.Get(name, rule))
 		}
 	}
 
 	for from, to := range chains.GenerateReplaces() {
-		res = res.ReplaceEverywhere(from, to)
+		res, weights, heads = res.replaceEverywhere(from, to, weights, heads)
 	}
 
-	g.Rules = res
+	g.Rules, g.Weights, g.Heads = res, weights, heads
 
 	return chains
 }
 
-func (g *BNF) getAllChainVariations(res RuleSet, chains ChainList, chain Chain) (RuleSet, ChainList) {
+// getAllChainVariations для взвешенной грамматики дает каждому правилу
+// цепочки вероятность p всей цепочки, умноженную на вероятность самого
+// правила. Вершина у правила цепочки та же, что у правила, которое она
+// копирует.
+func (g *BNF) getAllChainVariations(res RuleSet, chains ChainList, terms Set[Ident], chain Chain, weights Weights, heads Heads, p float64) (RuleSet, ChainList) {
 	lastItem := chain[len(chain)-1]
 	rules, ok := g.Rules[lastItem]
 	if !ok {
@@ -216,9 +248,9 @@ func (g *BNF) getAllChainVariations(res RuleSet, chains ChainList, chain Chain)
 	}
 
 	for _, rule := range rules {
-		if rule.isChain(slices.ToMap(maps.Keys(g.Terminals))) {
+		if rule.isChain(terms) {
 			if !slices.ContainsEq(chain, rule[0]) {
-				res, chains = g.getAllChainVariations(res, chains, append(chain, rule[0]))
+				res, chains = g.getAllChainVariations(res, chains, terms, append(chain, rule[0]), weights, heads, p*g.Weights.Get(lastItem, rule))
 			}
 			continue
 		}
@@ -226,6 +258,10 @@ func (g *BNF) getAllChainVariations(res RuleSet, chains ChainList, chain Chain)
 		var newIdent Ident
 		newIdent, chains = chains.GetOrGenerate(chain, func() Ident { return g.Counter.NewIdent(chain[0].ID) })
 		res = res.AppendRules(newIdent, rule)
+		weights.set(newIdent, rule, p*g.Weights.Get(lastItem, rule))
+		if head, ok := g.Heads.Get(lastItem, rule); ok {
+			heads.set(newIdent, rule, head)
+		}
 	}
 
 	return res, chains
@@ -0,0 +1,34 @@
+package grammar_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/maps"
+
+	. "github.com/quenbyako/parser/grammar"
+)
+
+// цепочка A → B не должна прятать остальные правила A: раньше S : A b
+// заменялось только на S : X b (X это цепочка A → B), и "a b" переставало
+// выводиться
+func TestCNF_ChainKeepsOtherRules(t *testing.T) {
+	g, err := Parse("", strings.NewReader(`
+		S : A b ;
+		A : B | a ;
+		B : c ;
+	`), "a", "b", "c")
+	require.NoError(t, err)
+	cnf := g.AsCNF("S")
+
+	require.Len(t, cnf.Chains, 1)
+	chain := maps.Values(cnf.Chains)[0]
+	require.Equal(t, Chain{{ID: "A"}, {ID: "B"}}, chain.Chain)
+
+	a, b := Ident{ID: "A"}, terminal(g, "b")
+	require.ElementsMatch(t, []DualRule{{a, b}, {chain.From, b}}, maps.Values(cnf.Rules[Ident{ID: "S"}]))
+
+	replaces := cnf.Chains.GenerateReplaces()
+	require.Equal(t, map[Ident][]IdentSet{a: {{a}, {chain.From}}}, replaces)
+}
@@ -4,7 +4,6 @@ import (
 	"strconv"
 
 	"github.com/quenbyako/parser/slices"
-	"golang.org/x/exp/maps"
 )
 
 // CutEpsilon ищет все правила, в которых содержится эпсилон-правила, и преобразовывает эти правила в такие, в
@@ -12,10 +11,21 @@ import (
 //
 // https://t.ly/xM1u
 func (g *BNF) RemoveEpsilonRules() {
-	terms := slices.ToMap(maps.Keys(g.Terminals))
+	terms := g.terminalSet()
 
 	potentiallyEmpty := g.FindEpsilon(terms)
 
+	// для PCFG: у варианта правила, где nullable селектор выкинут, вероятность
+	// умножается на e(X), а где оставлен — на 1-e(X), потому что сам X теперь
+	// выводит только непустые строки. Правила nullable нетерминала A
+	// нормируются на 1-e(A) по той же причине.
+	var empty map[Ident]float64
+	weights := g.Weights.like()
+	heads := g.Heads.like()
+	if weights != nil {
+		empty = g.emptyProbabilities(potentiallyEmpty)
+	}
+
 	newSet := make(RuleSet, len(g.Rules))
 	for name, rules := range g.Rules {
 		if len(rules) == 0 {
@@ -31,16 +41,35 @@ func (g *BNF) RemoveEpsilonRules() {
 			})
 
 			for _, replaced := range slices.Possibles(variants) {
+				// считаем до фильтрации: Filter переиспользует слайс
+				p := g.Weights.Get(name, rule)
+				for j, i := range replaced {
+					switch {
+					case i.ID == epsilonSymbol:
+						p *= empty[rule[j]]
+					case potentiallyEmpty.Has(i):
+						p *= 1 - empty[i]
+					}
+				}
+				if e := empty[name]; e < 1 {
+					p /= 1 - e
+				}
+
+				kept := slices.Remap(replaced, func(_ int, i Ident) bool { return i.ID != epsilonSymbol })
 				filtered := slices.Filter(replaced, func(i Ident) bool { return i.ID != epsilonSymbol })
 				if len(filtered) > 0 {
 					newSet = newSet.AppendRules(name, filtered)
+					weights.add(name, filtered, p)
+					if head, ok := g.Heads.Get(name, rule); ok {
+						heads.set(name, filtered, headAfter(head, kept))
+					}
 				}
 			}
 		}
 	}
 
 	// filter completely empty rules
-	g.Rules = filterCompleteEmpty(newSet, terms)
+	g.Rules, g.Weights, g.Heads = filterCompleteEmpty(newSet, terms, weights, heads)
 }
 
 func (g BNF) FindEpsilon(terminals Set[Ident]) Set[Ident] {
@@ -91,18 +120,28 @@ type identIndexes struct {
 //
 //	S   : D S ;
 //	D   : some_term ;
-func filterCompleteEmpty(ruleset RuleSet, terms Set[Ident]) RuleSet {
+func filterCompleteEmpty(ruleset RuleSet, terms Set[Ident], weights Weights, heads Heads) (RuleSet, Weights, Heads) {
 	res := make(RuleSet, len(ruleset))
+	resWeights := weights.like()
+	resHeads := heads.like()
 
 	confirmedEmpty := make(Set[Ident])
 	for rule := range ruleset.IterRules() {
+		// считаем до фильтрации: Filter переиспользует слайс
+		p := weights.Get(rule.Name, rule.Rule)
+		head, headed := heads.Get(rule.Name, rule.Rule)
+		kept := slices.Remap(rule.Rule, func(_ int, i Ident) bool { return !isRuleEmpty(ruleset, i, terms, confirmedEmpty) })
 		filtered := slices.Filter(rule.Rule, func(i Ident) bool { return !isRuleEmpty(ruleset, i, terms, confirmedEmpty) })
 		if len(filtered) > 0 {
 			res = res.AppendRules(rule.Name, filtered)
+			resWeights.add(rule.Name, filtered, p)
+			if headed {
+				resHeads.set(rule.Name, filtered, headAfter(head, kept))
+			}
 		}
 	}
 
-	return res
+	return res, resWeights, resHeads
 }
 
 func isRuleEmpty(ruleset RuleSet, i Ident, terms, confirmed Set[Ident]) bool {
@@ -167,7 +206,9 @@ func (i *epsilonIndex) setAsEpsilon(id Ident) {
 
 func (i *epsilonIndex) setCounters(id Ident, rules []IdentSet) {
 	i.set(id, func(i *identIndexes) {
-		i.counters = slices.Remap(rules, func(_ int, i IdentSet) int { return len(i) })
+		// считаем только уникальные селекторы: в concernedRules правило
+		// попадает один раз, даже если селектор в нем повторяется
+		i.counters = slices.Remap(rules, func(_ int, i IdentSet) int { return len(slices.ToMap(i)) })
 	})
 }
 
@@ -0,0 +1,43 @@
+package grammar_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/maps"
+
+	. "github.com/quenbyako/parser/grammar"
+)
+
+// пустая альтернатива опции остается в BNF: раньше AsBNF ее выкидывал, и
+// A : [ a ] превращалось в A : a, так что S : A b не выводило "b"
+func TestAsBNF_KeepsEmptyAlternatives(t *testing.T) {
+	g, err := Parse("", strings.NewReader(`
+		S : A b ;
+		A : [ a ] ;
+	`), "a", "b")
+	require.NoError(t, err)
+
+	bnf := g.AsBNF()
+	a := Ident{ID: "A"}
+	require.ElementsMatch(t, []IdentSet{{terminal(g, "a")}, {}}, maps.Values(bnf.Rules[a]))
+	require.Contains(t, bnf.FindEpsilon(nil), a)
+
+	cnf := g.AsCNF("S")
+	require.False(t, cnf.CanBeEmpty)
+	require.Contains(t, cnf.StopRules[terminal(g, "b")], Ident{ID: "S"})
+}
+
+// повторяющийся селектор считается в правиле один раз: раньше у S : A A
+// счетчик был 2, а уменьшался только на 1, так что пустой S не находился
+func TestFindEpsilon_RepeatedSelector(t *testing.T) {
+	g, err := Parse("", strings.NewReader(`
+		S : A A ;
+		A : { a } ;
+	`), "a")
+	require.NoError(t, err)
+
+	require.Contains(t, g.AsBNF().FindEpsilon(nil), Ident{ID: "S"})
+	require.True(t, g.AsBNF().As2NF("S").CanBeEmpty)
+}
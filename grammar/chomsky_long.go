@@ -1,19 +1,42 @@
 package grammar
 
+import "golang.org/x/exp/maps"
+
 // ExplodeLongRules разбивает все длинные правила на несколько коротких. Длинными считаются все правила
 // содержащие более 2 селекторов.
 //
 // https://t.ly/-ilI
 func (g *BNF) ExplodeLongRules() {
 	res := make(RuleSet, len(g.Rules))
+	weights := g.Weights.like()
+	heads := g.Heads.like()
 
 	for rule := range g.Rules.IterRules() {
 		replaced, more := explodeLongRule(rule.Rule, func() Ident { return g.Counter.NewIdent(rule.Name.ID) })
 		res = mapsMerge(res, more)
 		res = res.AppendRules(rule.Name, replaced)
+
+		// вершина длинного правила либо первый символ, либо лежит дальше, в
+		// сгенерированном хвосте
+		if head, ok := g.Heads.Get(rule.Name, rule.Rule); ok {
+			name, r := rule.Name, replaced
+			for head > 0 && len(more[r[1]]) > 0 {
+				heads.set(name, r, 1)
+				name, r, head = r[1], maps.Values(more[r[1]])[0], head-1
+			}
+			heads.set(name, r, head)
+		}
+
+		// у сгенерированных нетерминалов ровно одно правило
+		weights.add(rule.Name, replaced, g.Weights.Get(rule.Name, rule.Rule))
+		for name, rules := range more {
+			for _, r := range rules {
+				weights.set(name, r, 1)
+			}
+		}
 	}
 
-	g.Rules = res
+	g.Rules, g.Weights, g.Heads = res, weights, heads
 }
 
 func explodeLongRule(r IdentSet, identGenerator func() Ident) (replaced IdentSet, moreRules RuleSet) {
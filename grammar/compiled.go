@@ -0,0 +1,220 @@
+package grammar
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/quenbyako/parser/constraints"
+	"github.com/quenbyako/parser/slices"
+	"golang.org/x/exp/maps"
+)
+
+// Symbol это плотный номер терминала, константы или нетерминала в
+// скомпилированной грамматике. Номера идут подряд с нуля, так что ими можно
+// индексировать слайсы и битовые множества.
+type Symbol uint32
+
+// Compiled это неизменяемая грамматика, в которой все символы заменены на
+// Symbol, а правила лежат в плоских слайсах, проиндексированных символом. Все
+// строки и хеши остаются только в таблице символов: Lookup нужен на входе в
+// парсер, Ident и Complex на выходе, а все что между ними работает только с
+// числами.
+//
+// Собирается из CNF или BinaryNF методом Compile.
+//
+// В cyk на ней работает только BitTable (BackendBitset и BackendValiant).
+// Table по-прежнему хранит в нодах Ident и ищет правила через Select и
+// Closure грамматики: из ее нод строятся деревья, лес, правки и поиск, и все
+// они отдают идентификаторы грамматики. Перевод Table на Symbol меняет весь
+// этот API, так что он сюда не входит.
+type Compiled struct {
+	StartRule string
+
+	idents    []Ident
+	complex   []ComplexIdent
+	constants []string
+	kinds     []symbolKind
+	symbols   map[Ident]Symbol
+
+	// бинарные правила: pairs отсортированы по (Left, Right), pairsStart[s]
+	// это индекс первой пары, у которой Left == s
+	pairs       []Pair
+	pairsStart  []uint32
+	parents     []Symbol
+	parentStart []uint32
+
+	// closure[closureStart[s]:closureStart[s+1]] это Closure(s)
+	closure      []Symbol
+	closureStart []uint32
+
+	roots []Symbol
+}
+
+// Pair это пара соседних символов, из которых собирается бинарное правило.
+type Pair struct{ Left, Right Symbol }
+
+type symbolKind uint8
+
+const (
+	kindNonTerminal symbolKind = iota
+	kindTerminal
+	kindConstant
+)
+
+type binarized interface {
+	Closure(Ident) []Ident
+	Combinations() map[DualRule][]Ident
+	Roots() []Ident
+}
+
+func compile(g binarized, terminals map[Ident]ComplexIdent, constants map[uint64]string) *Compiled {
+	combinations := g.Combinations()
+
+	// сначала собираем вообще все символы, потом нумеруем их по порядку, что
+	// бы номера не зависели от порядка обхода мап
+	all := symbols(g, terminals, constants)
+
+	c := &Compiled{symbols: make(map[Ident]Symbol, len(all))}
+	for _, i := range slices.SortEq(maps.Keys(all)) {
+		c.symbols[i] = Symbol(len(c.idents))
+		c.idents = append(c.idents, i)
+
+		term, kind, value := ComplexIdent{}, kindNonTerminal, ""
+		if t, ok := terminals[i]; ok {
+			term, kind = t, kindTerminal
+		} else if v, ok := constants[i.AttrHash]; ok && i.ID == constIdentName {
+			kind, value = kindConstant, v
+		}
+		c.complex = append(c.complex, term)
+		c.kinds = append(c.kinds, kind)
+		c.constants = append(c.constants, value)
+	}
+
+	if roots := g.Roots(); len(roots) > 0 {
+		c.StartRule = roots[0].ID
+		c.roots = slices.Remap(roots, func(_ int, i Ident) Symbol { return c.symbols[i] })
+	}
+
+	pairs := make([]Pair, 0, len(combinations))
+	for pair := range combinations {
+		pairs = append(pairs, Pair{c.symbols[pair[0]], c.symbols[pair[1]]})
+	}
+	c.pairs = slices.SortFunc(pairs, func(a, b Pair) bool { return a.Cmp(b) < 0 })
+
+	c.pairsStart = make([]uint32, len(c.idents)+1)
+	c.parentStart = make([]uint32, 0, len(c.pairs)+1)
+	for _, pair := range c.pairs {
+		c.pairsStart[pair.Left+1]++
+		c.parentStart = append(c.parentStart, uint32(len(c.parents)))
+		names := combinations[DualRule{c.idents[pair.Left], c.idents[pair.Right]}]
+		c.parents = append(c.parents, slices.Sort(slices.Remap(names, func(_ int, i Ident) Symbol { return c.symbols[i] }))...)
+	}
+	c.parentStart = append(c.parentStart, uint32(len(c.parents)))
+	for s := 1; s < len(c.pairsStart); s++ {
+		c.pairsStart[s] += c.pairsStart[s-1]
+	}
+
+	c.closureStart = make([]uint32, 0, len(c.idents)+1)
+	for _, i := range c.idents {
+		c.closureStart = append(c.closureStart, uint32(len(c.closure)))
+		c.closure = append(c.closure, slices.Sort(slices.Remap(g.Closure(i), func(_ int, i Ident) Symbol { return c.symbols[i] }))...)
+	}
+	c.closureStart = append(c.closureStart, uint32(len(c.closure)))
+
+	return c
+}
+
+// symbols возвращает все символы грамматики: терминалы, константы и все,
+// что из них выводится.
+func symbols(g binarized, terminals map[Ident]ComplexIdent, constants map[uint64]string) Set[Ident] {
+	res := make(Set[Ident])
+	queue := append(maps.Keys(terminals), g.Roots()...)
+	for hash := range constants {
+		queue = append(queue, Ident{ID: constIdentName, AttrHash: hash})
+	}
+	for pair, names := range g.Combinations() {
+		queue = append(append(queue, pair[0], pair[1]), names...)
+	}
+	for len(queue) > 0 {
+		next := queue[0]
+		queue = queue[1:]
+		if res.Has(next) {
+			continue
+		}
+		res[next] = struct{}{}
+		queue = append(queue, g.Closure(next)...)
+	}
+
+	return res
+}
+
+// Len возвращает количество символов в грамматике.
+func (c *Compiled) Len() int { return len(c.idents) }
+
+// Lookup возвращает номер символа. Это единственное место, где используется
+// хеш, так что вызывать его стоит один раз на каждый входной терминал.
+func (c *Compiled) Lookup(i Ident) (Symbol, bool) {
+	s, ok := c.symbols[i]
+	return s, ok
+}
+
+func (c *Compiled) Ident(s Symbol) Ident { return c.idents[s] }
+
+// Complex возвращает селектор терминала. Для нетерминалов и констант ok будет
+// false.
+func (c *Compiled) Complex(s Symbol) (_ ComplexIdent, ok bool) {
+	return c.complex[s], c.kinds[s] == kindTerminal
+}
+
+// Constant возвращает значение константы. Для всех остальных символов ok
+// будет false.
+func (c *Compiled) Constant(s Symbol) (_ string, ok bool) {
+	return c.constants[s], c.kinds[s] == kindConstant
+}
+
+func (c *Compiled) IsTerminal(s Symbol) bool { return c.kinds[s] != kindNonTerminal }
+
+// Pairs возвращает все пары из бинарных правил, отсортированные по (Left,
+// Right). Слайс менять нельзя.
+func (c *Compiled) Pairs() []Pair { return c.pairs }
+
+// PairsOf возвращает все пары, у которых левый символ left.
+func (c *Compiled) PairsOf(left Symbol) []Pair {
+	return c.pairs[c.pairsStart[left]:c.pairsStart[left+1]]
+}
+
+// Parents возвращает нетерминалы, которые собираются из пары с индексом p в
+// Pairs().
+func (c *Compiled) Parents(p int) []Symbol { return c.parents[c.parentStart[p]:c.parentStart[p+1]] }
+
+// Combine возвращает нетерминалы, которые собираются из пары left, right.
+func (c *Compiled) Combine(left, right Symbol) []Symbol {
+	from, to := int(c.pairsStart[left]), int(c.pairsStart[left+1])
+	p := from + sort.Search(to-from, func(i int) bool { return c.pairs[from+i].Right >= right })
+	if p == to || c.pairs[p].Right != right {
+		return nil
+	}
+
+	return c.Parents(p)
+}
+
+// Closure возвращает символы, которые выводятся из s без соседей за один
+// шаг. Сам s в результат не входит.
+func (c *Compiled) Closure(s Symbol) []Symbol {
+	return c.closure[c.closureStart[s]:c.closureStart[s+1]]
+}
+
+// Roots возвращает символы, которые могут стоять в корне разбора.
+func (c *Compiled) Roots() []Symbol { return c.roots }
+
+func (c *Compiled) String() string {
+	return fmt.Sprintf("compiled[%v: %d symbols, %d pairs]", c.StartRule, len(c.idents), len(c.pairs))
+}
+
+func (p Pair) Cmp(o Pair) int {
+	if res := constraints.Comparator(p.Left, o.Left); res != 0 {
+		return res
+	}
+
+	return constraints.Comparator(p.Right, o.Right)
+}
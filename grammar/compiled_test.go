@@ -0,0 +1,101 @@
+package grammar_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	. "github.com/quenbyako/parser/grammar"
+)
+
+func TestCNF_Compile(t *testing.T) {
+	g, err := Parse("", strings.NewReader(`
+		expr   : expr "+" term | term ;
+		term   : term "*" factor | factor ;
+		factor : "(" expr ")" | num<kind=int> ;
+	`), "num")
+	require.NoError(t, err)
+
+	cnf := g.AsCNF("expr")
+	c := cnf.Compile()
+
+	for s := 0; s < c.Len(); s++ {
+		sym := Symbol(s)
+		found, ok := c.Lookup(c.Ident(sym))
+		require.True(t, ok)
+		require.Equal(t, sym, found)
+	}
+
+	for pair, names := range cnf.Combinations() {
+		left, ok := c.Lookup(pair[0])
+		require.True(t, ok)
+		right, ok := c.Lookup(pair[1])
+		require.True(t, ok)
+
+		got := []Ident{}
+		for _, sym := range c.Combine(left, right) {
+			got = append(got, c.Ident(sym))
+		}
+		require.Equal(t, names, got)
+	}
+
+	for term, complex := range g.Terminals {
+		sym, ok := c.Lookup(term)
+		require.True(t, ok)
+		got, ok := c.Complex(sym)
+		require.True(t, ok)
+		require.Equal(t, complex, got)
+		require.True(t, c.IsTerminal(sym))
+	}
+
+	for hash, value := range g.Constants {
+		sym, ok := c.Lookup(Ident{ID: "CONST", AttrHash: hash})
+		require.True(t, ok)
+		got, ok := c.Constant(sym)
+		require.True(t, ok)
+		require.Equal(t, value, got)
+	}
+
+	start, ok := c.Lookup(Ident{ID: "expr"})
+	require.True(t, ok)
+	require.Contains(t, c.Roots(), start)
+	require.False(t, c.IsTerminal(start))
+}
+
+func TestCNF_Corners(t *testing.T) {
+	g, err := Parse("", strings.NewReader(`
+		expr   : expr "+" term | term ;
+		term   : term "*" factor | factor ;
+		factor : "(" expr ")" | num<kind=int> ;
+	`), "num")
+	require.NoError(t, err)
+
+	constant := func(value string) Ident {
+		for hash, v := range g.Constants {
+			if v == value {
+				return Ident{ID: "CONST", AttrHash: hash}
+			}
+		}
+		panic("unknown constant " + value)
+	}
+
+	corners := g.AsCNF("expr").Corners()
+	for _, tt := range []struct {
+		i           Ident
+		left, right bool
+	}{
+		{Ident{ID: "expr"}, true, true},
+		{constant("("), true, false},
+		{constant(")"), false, true},
+		{constant("+"), false, false},
+		{constant("*"), false, false},
+	} {
+		require.Equal(t, tt.left, corners.Left.Has(tt.i), tt.i.String())
+		require.Equal(t, tt.right, corners.Right.Has(tt.i), tt.i.String())
+	}
+	for term := range g.Terminals {
+		require.True(t, corners.Left.Has(term))
+		require.True(t, corners.Right.Has(term))
+	}
+}
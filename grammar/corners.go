@@ -0,0 +1,57 @@
+package grammar
+
+// Corners это символы, которые могут стоять на краях дерева разбора всего
+// предложения. Left — все символы, до которых от корня можно дойти, спускаясь
+// только к левому потомку бинарного правила или по унарному отношению, Right
+// — то же самое для правого потомка. Отношения рефлексивные, так что корни
+// тоже входят в оба множества.
+//
+// Для CYK это фильтр сверху вниз: нода на отрезке, который начинается с
+// первого терминала, должна быть в Left, а на отрезке до последнего — в
+// Right.
+type Corners struct {
+	Left, Right Set[Ident]
+}
+
+// Corners считает углы грамматики по бинарным правилам и стоп правилам.
+func (g *CNF) Corners() Corners { return corners(g, symbols(g, g.Terminals, g.Constants)) }
+
+// Corners считает углы грамматики по бинарным правилам и унарному
+// отношению.
+func (g *BinaryNF) Corners() Corners { return corners(g, symbols(g, g.Terminals, g.Constants)) }
+
+func corners(g binarized, all Set[Ident]) Corners {
+	// все отношения здесь от родителя к потомку
+	left := make(map[Ident][]Ident)
+	right := make(map[Ident][]Ident)
+	for pair, names := range g.Combinations() {
+		for _, name := range names {
+			left[name] = append(left[name], pair[0])
+			right[name] = append(right[name], pair[1])
+		}
+	}
+	units := make(map[Ident][]Ident)
+	for child := range all {
+		for _, parent := range g.Closure(child) {
+			units[parent] = append(units[parent], child)
+		}
+	}
+
+	walk := func(down map[Ident][]Ident) Set[Ident] {
+		res := make(Set[Ident])
+		queue := append([]Ident{}, g.Roots()...)
+		for len(queue) > 0 {
+			next := queue[0]
+			queue = queue[1:]
+			if res.Has(next) {
+				continue
+			}
+			res[next] = struct{}{}
+			queue = append(append(queue, down[next]...), units[next]...)
+		}
+
+		return res
+	}
+
+	return Corners{Left: walk(left), Right: walk(right)}
+}
@@ -60,6 +60,19 @@ func (r Repeat) UnwrapBNF(c func() Ident) (replaces []IdentSet, newRules RuleSet
 	return []IdentSet{{newID}}, newRules
 }
 
+// Weighted это альтернатива правила с явно заданной вероятностью, например
+// `np : adj noun [0.7] ;`. Встречается только на верхнем уровне правила.
+type Weighted struct {
+	E Expr
+	P float64
+}
+
+var _ Expr = Weighted{}
+
+func (_ Weighted) expr()                                          {}
+func (w Weighted) String() string                                 { return fmt.Sprintf("%v [%v]", w.E, w.P) }
+func (w Weighted) UnwrapBNF(c func() Ident) ([]IdentSet, RuleSet) { return w.E.UnwrapBNF(c) }
+
 type Seq []Expr
 
 var _ Expr = Seq{}
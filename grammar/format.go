@@ -0,0 +1,126 @@
+package grammar
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/quenbyako/parser/slices"
+	"golang.org/x/exp/maps"
+)
+
+// WriteTo записывает грамматику в формате, который читает Parse, вместе с
+// весами правил, так что обученные веса можно сохранить и загрузить обратно
+// (с тем же списком терминалов и тем же стартовым правилом). Правила с
+// нулевой вероятностью (например, обученной в ноль или вовсе отсутствующей
+// в Weights, как их видит Weight) не записываются.
+//
+// Сгенерированные нетерминалы записываются как обычные, а корни-цепочки
+// (см. Roots) — как цепочные правила стартового с весом 1, так что после
+// повторного AsCNF вероятности деревьев не меняются. CanBeEmpty в этом
+// формате не выражается и теряется.
+func (g *CNF) WriteTo(w io.Writer) (int64, error) {
+	rules := make(map[Ident][]IdentSet)
+	for name, pairs := range g.Rules {
+		for _, pair := range pairs {
+			rules[name] = append(rules[name], IdentSet{pair[0], pair[1]})
+		}
+	}
+	for child, parents := range g.StopRules {
+		for parent := range parents {
+			rules[parent] = append(rules[parent], IdentSet{child})
+		}
+	}
+	start := Ident{ID: g.StartRule}
+	rootChains := make(Set[Ident])
+	for _, root := range g.Roots() {
+		if root != start {
+			rules[start] = append(rules[start], IdentSet{root})
+			rootChains[root] = struct{}{}
+		}
+	}
+
+	names := g.nonterminalNames(rules)
+
+	buf := bufio.NewWriter(w)
+	var written int64
+	for _, name := range slices.SortEq(maps.Keys(rules)) {
+		alts := make([]string, 0, len(rules[name]))
+		for _, rule := range slices.SortEq(rules[name]) {
+			weight := 1.0
+			if g.Weights != nil && !(name == start && len(rule) == 1 && rootChains.Has(rule[0])) {
+				weight = g.Weights.Get(name, rule)
+			}
+			if weight == 0 {
+				continue
+			}
+
+			alt := strings.Join(slices.Remap(rule, func(_ int, i Ident) string { return g.formatIdent(i, names) }), " ")
+			if g.Weights != nil {
+				alt += " [" + strconv.FormatFloat(weight, 'g', -1, 64) + "]"
+			}
+			alts = append(alts, alt)
+		}
+		if len(alts) == 0 {
+			continue
+		}
+
+		n, err := fmt.Fprintf(buf, "%v\n    : %v\n    ;\n", names[name], strings.Join(alts, "\n    | "))
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+
+	return written, buf.Flush()
+}
+
+// nonterminalNames дает имена всем нетерминалам. Сгенерированные после
+// загрузки становятся обычными, так что их имена не должны совпасть ни с
+// одним существующим, иначе при следующем сохранении два разных нетерминала
+// получат одно имя.
+func (g *CNF) nonterminalNames(rules map[Ident][]IdentSet) map[Ident]string {
+	res := make(map[Ident]string, len(rules))
+	taken := make(Set[string])
+	for name := range rules {
+		if !name.Generated {
+			res[name] = name.String()
+			taken[name.String()] = struct{}{}
+		}
+	}
+
+	counters := make(map[string]int)
+	for _, name := range slices.SortEq(maps.Keys(rules)) {
+		if !name.Generated {
+			continue
+		}
+		for {
+			counters[name.ID]++
+			if n := name.ID + "_" + strconv.Itoa(counters[name.ID]); !taken.Has(n) {
+				res[name] = n
+				taken[n] = struct{}{}
+				break
+			}
+		}
+	}
+
+	return res
+}
+
+func (g *CNF) formatIdent(i Ident, names map[Ident]string) string {
+	if v, ok := g.Constants[i.AttrHash]; ok && i.ID == constIdentName {
+		return strconv.Quote(v)
+	}
+	if name, ok := names[i]; ok {
+		return name
+	}
+
+	term, ok := g.Terminals[i]
+	if !ok || len(term.Properties) == 0 && len(term.Conditions) == 0 {
+		return i.String()
+	}
+
+	return term.ID + "<" + term.selector(Value.String) + ">"
+}
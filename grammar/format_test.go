@@ -0,0 +1,65 @@
+package grammar_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	. "github.com/quenbyako/parser/grammar"
+)
+
+func TestCNF_WriteTo(t *testing.T) {
+	g, err := Parse("", strings.NewReader(`
+		S : A b [0.8] | C [0.2] ;
+		A : [ a ] | num<kind=int> "+" ;
+		C : b ;
+	`), "a", "b", "num")
+	require.NoError(t, err)
+	cnf := g.AsCNF("S")
+
+	buf := bytes.NewBuffer(nil)
+	_, err = cnf.WriteTo(buf)
+	require.NoError(t, err)
+	require.Contains(t, buf.String(), `num<kind="int">`)
+	require.Contains(t, buf.String(), `"+"`)
+
+	loaded, err := Parse("", buf, "a", "b", "num")
+	require.NoError(t, err)
+	reloaded := loaded.AsCNF("S")
+
+	s, b := Ident{ID: "S"}, terminal(g, "b")
+	require.InDelta(t, cnf.Weight(s, Ident{ID: "A"}, b), reloaded.Weight(s, Ident{ID: "A"}, b), 1e-9)
+	require.InDelta(t, cnf.Weight(s, b), reloaded.Weight(s, b), 1e-9)
+
+	// вес цепочки из корня переезжает в новый сгенерированный корень
+	chained := func(cnf *CNF) (res float64) {
+		for _, root := range cnf.Roots() {
+			if root != s {
+				res += cnf.Weight(root, b)
+			}
+		}
+		return res
+	}
+	require.InDelta(t, chained(cnf), chained(reloaded), 1e-9)
+
+	// правила с нулевым и пропавшим весом не записываются: для Weight оба
+	// невозможны
+	zero, _ := CanonicalRule{Name: s, Rule: IdentSet{Ident{ID: "A"}, b}}.Hash()
+	cnf.Weights[zero] = 0
+	missing, _ := CanonicalRule{Name: s, Rule: IdentSet{b}}.Hash()
+	delete(cnf.Weights, missing)
+
+	buf.Reset()
+	_, err = cnf.WriteTo(buf)
+	require.NoError(t, err)
+	require.NotContains(t, buf.String(), "[0]")
+	loaded, err = Parse("", buf, "a", "b", "num")
+	require.NoError(t, err)
+	reloaded = loaded.AsCNF("S")
+	require.Zero(t, cnf.Weight(s, b))
+	require.Zero(t, reloaded.Weight(s, Ident{ID: "A"}, b))
+	require.Zero(t, reloaded.Weight(s, b))
+	require.InDelta(t, chained(cnf), chained(reloaded), 1e-9)
+}
@@ -1,10 +1,14 @@
 package grammar
 
 import (
+	"encoding/binary"
 	"fmt"
+	"math"
 	"strings"
 
+	"github.com/alecthomas/participle/v2/lexer"
 	"github.com/quenbyako/parser/slices"
+	"github.com/zeebo/xxh3"
 	"golang.org/x/exp/maps"
 )
 
@@ -20,6 +24,13 @@ type EBNF struct {
 	Terminals map[Ident]ComplexIdent
 	// сюда помещаются все константы, которые есть в грамматике (не регулярки)
 	Constants map[uint64]string
+	// Schema это объявленные в грамматике типы атрибутов терминалов.
+	Schema Schema
+	// Positions это место, где селектор терминала или нетерминала впервые
+	// встречается в исходнике, для диагностики.
+	Positions map[Ident]lexer.Position
+	// Heads это вершины правил и протекание атрибутов к нетерминалам.
+	Heads Heads
 }
 
 func (e *EBNF) String() string {
@@ -42,14 +53,51 @@ func (e EBNF) AsBNF() (res *BNF) {
 		Rules:     make(RuleSet, len(e.Rules)),
 		Counter:   make(IdentCounter),
 		Terminals: e.Terminals,
+		Constants: e.Constants,
+		Heads:     e.Heads,
 	}
+	weighted := isWeighted(e)
+	alts := make(map[Ident][][]IdentSet)
+	weights := make(map[Ident][]float64)
+	type headedRule struct {
+		CanonicalRule
+		head int
+	}
+	var heads []headedRule
 	for name, exprs := range e.Rules {
 		for _, expr := range exprs {
-			unwrapped, moreRules := expr.UnwrapBNF(func() Ident { return res.Counter.NewIdent(name.ID) })
-			res.Rules = res.Rules.AppendRules(name, slices.Filter(unwrapped, func(s IdentSet) bool { return len(s) > 0 })...)
+			unwrapped, unwrappedHeads, moreRules := unwrapHeads(expr, func() Ident { return res.Counter.NewIdent(name.ID) })
+			// пустые альтернативы (например, от опций) остаются, их потом
+			// убирает RemoveEpsilonRules
+			res.Rules = res.Rules.AppendRules(name, unwrapped...)
 			res.Rules = mapsMerge(res.Rules, moreRules)
+			for i, head := range unwrappedHeads {
+				if head >= 0 {
+					heads = append(heads, headedRule{CanonicalRule{Name: name, Rule: unwrapped[i]}, head})
+				}
+			}
+
+			if weighted {
+				w := math.NaN()
+				if expr, ok := expr.(Weighted); ok {
+					w = expr.P
+				}
+				alts[name] = append(alts[name], unwrapped)
+				weights[name] = append(weights[name], w)
+			}
+		}
+	}
+
+	if weighted {
+		e.weigh(res, alts, weights)
+	}
+	if len(heads) > 0 {
+		res.Heads.rules = make(map[uint64]int, len(heads))
+		for _, rule := range heads {
+			res.Heads.set(rule.Name, rule.Rule, rule.head)
 		}
 	}
+	res.specialize(e.Heads.Selectors)
 
 	return res
 }
@@ -138,6 +186,18 @@ type CanonicalRule struct {
 	Rule IdentSet
 }
 
+func (r CanonicalRule) String() string { return fmt.Sprintf("%v : %v ;", r.Name, r.Rule) }
+
+func (r CanonicalRule) Hash() (uint64, error) {
+	res := make([]byte, 16)
+	h0, _ := r.Name.Hash()
+	binary.LittleEndian.PutUint64(res[0:8], h0)
+	h1, _ := r.Rule.Hash()
+	binary.LittleEndian.PutUint64(res[8:16], h1)
+
+	return xxh3.Hash(res), nil
+}
+
 func (r RuleSet) IterRules() chan CanonicalRule {
 	m := make(chan CanonicalRule)
 	go func(r RuleSet) {
@@ -168,7 +228,16 @@ func (r RuleSet) GetRules(name Ident) []IdentSet {
 // ReplaceEverywhere заменяет определенный нетерминал на несколько
 // последовательностей нетерминалов
 func (r RuleSet) ReplaceEverywhere(id Ident, to []IdentSet) RuleSet {
+	res, _, _ := r.replaceEverywhere(id, to, nil, Heads{})
+	return res
+}
+
+// replaceEverywhere это ReplaceEverywhere, который переносит веса правил:
+// каждый вариант правила получает вес исходного.
+func (r RuleSet) replaceEverywhere(id Ident, to []IdentSet, weights Weights, heads Heads) (RuleSet, Weights, Heads) {
 	res := RuleSet{}
+	resWeights := weights.like()
+	resHeads := heads.like()
 
 	for name, rules := range r {
 		for _, rule := range rules {
@@ -184,17 +253,24 @@ func (r RuleSet) ReplaceEverywhere(id Ident, to []IdentSet) RuleSet {
 				}
 			}
 
+			head, headed := heads.Get(name, rule)
 			for _, variantRaw := range slices.Possibles(more) {
 				variant := slices.AppendMany(variantRaw...)
 				if len(variant) > 0 {
 					res = res.AppendRules(name, variant)
+					resWeights.add(name, variant, weights.Get(name, rule))
+				}
+				// вершина остается на месте, только если ее заменили одним
+				// символом
+				if headed && len(variant) > 0 && len(variantRaw[head]) == 1 {
+					resHeads.set(name, variant, len(slices.AppendMany(variantRaw[:head]...)))
 				}
 			}
 		}
 
 	}
 
-	return res
+	return res, resWeights, resHeads
 }
 
 // BNF абсолютно отличается от грамматики:
@@ -203,12 +279,31 @@ func (r RuleSet) ReplaceEverywhere(id Ident, to []IdentSet) RuleSet {
 type BNF struct {
 	Rules     RuleSet
 	Terminals map[Ident]ComplexIdent
+	Constants map[uint64]string
+	// Weights заполнены, только если в грамматике заданы веса правил
+	Weights Weights
+	Heads   Heads
 
 	Counter IdentCounter
 }
 
 func (g *BNF) String() string { return g.Rules.String() }
 
+// terminalSet возвращает все терминалы грамматики. Константы в Terminals не
+// попадают, поэтому их приходится собирать прямо из правил.
+func (g *BNF) terminalSet() Set[Ident] {
+	terms := slices.ToMap(maps.Keys(g.Terminals))
+	for rule := range g.Rules.IterRules() {
+		for _, i := range rule.Rule {
+			if i.ID == constIdentName {
+				terms[i] = struct{}{}
+			}
+		}
+	}
+
+	return terms
+}
+
 func (g *BNF) AsCNF(startRule string) *CNF {
 	allowedEmpty, found := g.ContainsEmptyRules(Ident{ID: startRule})
 	if !found {
@@ -226,7 +321,10 @@ func (g *BNF) AsCNF(startRule string) *CNF {
 
 	dualRules := make(map[Ident]HashSet[DualRule])
 	stopRules := make(map[Ident]Set[Ident])
+	weights := g.Weights.like()
 	for rule := range g.Rules.IterRules() {
+		weights.set(rule.Name, rule.Rule, g.Weights.Get(rule.Name, rule.Rule))
+
 		switch len(rule.Rule) {
 		case 0:
 			panic("found empty rule! " + fmt.Sprintf("%v : %v ;", rule.Name, epsilonSymbol))
@@ -241,11 +339,16 @@ func (g *BNF) AsCNF(startRule string) *CNF {
 	}
 
 	return &CNF{
-		StartRule:  startRule,
-		CanBeEmpty: allowedEmpty,
-		Chains:     chains,
-		Rules:      dualRules,
-		StopRules:  stopRules,
+		StartRule:    startRule,
+		CanBeEmpty:   allowedEmpty,
+		Chains:       chains,
+		Rules:        dualRules,
+		StopRules:    stopRules,
+		Terminals:    g.Terminals,
+		Constants:    g.Constants,
+		Weights:      weights,
+		Heads:        g.Heads,
+		combinations: combineRules(dualRules),
 	}
 }
 
@@ -279,8 +382,40 @@ type CNF struct {
 	// ключ — результирующий терминал или нетерминал, значения — все вариации во
 	// что может этот терминал разрастись
 	StopRules map[Ident]Set[Ident]
+
+	Terminals map[Ident]ComplexIdent
+	Constants map[uint64]string
+	// Weights это вероятности бинарных и стоп правил, если грамматика
+	// взвешена (см. Weight)
+	Weights Weights
+	Heads   Heads
+
+	// обратный индекс для Select
+	combinations map[DualRule][]Ident
+}
+
+// Select возвращает все нетерминалы, которые собираются из пары left, bottom.
+// Подходит в качестве селектора для cyk.Table.
+func (g *CNF) Select(left, bottom Ident) ([]Ident, bool) {
+	res, ok := g.combinations[DualRule{left, bottom}]
+	return res, ok
 }
 
+// Closure возвращает стоп правила для терминала i: для CNF это единственный
+// способ вырастить из ячейки что-то без соседей.
+func (g *CNF) Closure(i Ident) []Ident { return slices.SortEq(maps.Keys(g.StopRules[i])) }
+
+// Combinations возвращает обратный индекс бинарных правил: пара селекторов ->
+// все нетерминалы, которые из нее собираются. Индекс менять нельзя.
+func (g *CNF) Combinations() map[DualRule][]Ident { return g.combinations }
+
+// Roots возвращает все нетерминалы, которые могут оказаться в корне дерева
+// разбора: стартовое правило и все цепочки, которые из него начинаются.
+func (g *CNF) Roots() []Ident { return g.Chains.Variants(Ident{ID: g.StartRule}) }
+
+// Compile собирает из грамматики неизменяемую Compiled.
+func (g *CNF) Compile() *Compiled { return compile(g, g.Terminals, g.Constants) }
+
 func (g *CNF) String() string {
 	rulesStr := make([]string, 0, len(g.Rules))
 	keys := slices.SortEq(maps.Keys(g.Rules))
@@ -0,0 +1,253 @@
+package grammar
+
+import (
+	"fmt"
+
+	"github.com/quenbyako/parser/slices"
+	"golang.org/x/exp/maps"
+)
+
+// GNF это грамматика в нормальной форме Грейбах: каждое правило начинается с
+// терминала, за которым идут только нетерминалы. Такую грамматику удобно
+// превращать в магазинный автомат.
+type GNF struct {
+	StartRule  string
+	CanBeEmpty bool
+	Chains     ChainList
+
+	Rules RuleSet
+
+	// Origins хранит для каждого правила (ключ — хеш CanonicalRule)
+	// последовательность правил исходной грамматики, подстановкой которых оно
+	// получилось. Исходной считается грамматика уже без эпсилон и цепочных
+	// правил, сами цепочки лежат в Chains.
+	//
+	// у правил вида `X : терминал ;`, которые появились при выносе терминалов
+	// из хвоста правила, последовательность пустая.
+	Origins map[uint64][]CanonicalRule
+}
+
+func (g *GNF) String() string { return g.Rules.String() }
+
+// Origin возвращает правила исходной грамматики, из которых было получено
+// правило name : rule.
+func (g *GNF) Origin(name Ident, rule IdentSet) []CanonicalRule {
+	h, _ := CanonicalRule{Name: name, Rule: rule}.Hash()
+	return g.Origins[h]
+}
+
+// AsGNF приводит грамматику к нормальной форме Грейбах. Так же как и AsCNF,
+// метод меняет саму грамматику: удаляет из нее эпсилон и цепочные правила.
+//
+// https://en.wikipedia.org/wiki/Greibach_normal_form
+func (g *BNF) AsGNF(startRule string) *GNF {
+	allowedEmpty, found := g.ContainsEmptyRules(Ident{ID: startRule})
+	if !found {
+		panic("start rule not found!")
+	}
+
+	g.RemoveEpsilonRules()
+	chains := g.PopChains()
+
+	c := newGreibach(g)
+	c.removeLeftRecursion()
+	c.substituteHeads()
+	c.liftTerminals()
+
+	res := &GNF{
+		StartRule:  startRule,
+		CanBeEmpty: allowedEmpty,
+		Chains:     chains,
+		Rules:      make(RuleSet, len(c.rules)),
+		Origins:    make(map[uint64][]CanonicalRule),
+	}
+	for name, rules := range c.rules {
+		for _, rule := range rules {
+			h, _ := CanonicalRule{Name: name, Rule: rule.rule}.Hash()
+			if _, ok := res.Origins[h]; ok {
+				continue
+			}
+			res.Rules = res.Rules.AppendRules(name, rule.rule)
+			res.Origins[h] = rule.origin
+		}
+	}
+
+	return res
+}
+
+type gnfRule struct {
+	rule   IdentSet
+	origin []CanonicalRule
+}
+
+type greibach struct {
+	terms   Set[Ident]
+	counter IdentCounter
+
+	// нетерминалы исходной грамматики в порядке, в котором убирается левая
+	// рекурсия
+	order []Ident
+	rules map[Ident][]gnfRule
+}
+
+func newGreibach(g *BNF) *greibach {
+	c := &greibach{
+		terms:   g.terminalSet(),
+		counter: g.Counter,
+		order:   slices.SortEq(maps.Keys(g.Rules)),
+		rules:   make(map[Ident][]gnfRule, len(g.Rules)),
+	}
+
+	for _, name := range c.order {
+		for _, rule := range slices.SortEq(maps.Values(g.Rules[name])) {
+			c.rules[name] = append(c.rules[name], gnfRule{
+				rule:   rule,
+				origin: []CanonicalRule{{Name: name, Rule: rule}},
+			})
+		}
+	}
+
+	return c
+}
+
+// removeLeftRecursion добивается того, что у каждого правила A_i первый
+// селектор либо терминал, либо A_j где j > i, либо сгенерированный
+// нетерминал.
+func (c *greibach) removeLeftRecursion() {
+	for i, ai := range c.order {
+		for _, aj := range c.order[:i] {
+			c.rules[ai] = c.expandHead(c.rules[ai], aj)
+		}
+		c.removeDirectRecursion(ai)
+	}
+}
+
+// expandHead подставляет все правила head вместо первого селектора правил,
+// которые с него начинаются.
+func (c *greibach) expandHead(rules []gnfRule, head Ident) []gnfRule {
+	res := make([]gnfRule, 0, len(rules))
+	for _, rule := range rules {
+		if rule.rule[0] != head {
+			res = append(res, rule)
+			continue
+		}
+
+		for _, sub := range c.rules[head] {
+			res = append(res, gnfRule{
+				rule:   slices.AppendMany(sub.rule, rule.rule[1:]),
+				origin: slices.AppendMany(rule.origin, sub.origin),
+			})
+		}
+	}
+
+	return res
+}
+
+// removeDirectRecursion заменяет
+//
+//	A : A α | β ;
+//
+// на
+//
+//	A : β | β Z ;
+//	Z : α | α Z ;
+func (c *greibach) removeDirectRecursion(name Ident) {
+	var recursive, rest []gnfRule
+	for _, rule := range c.rules[name] {
+		switch {
+		case rule.rule[0] != name:
+			rest = append(rest, rule)
+		case len(rule.rule) > 1:
+			recursive = append(recursive, gnfRule{rule: rule.rule[1:], origin: rule.origin})
+		default:
+			// `A : A ;` ничего не дает, пропускаем
+		}
+	}
+
+	if len(recursive) == 0 {
+		c.rules[name] = rest
+		return
+	}
+
+	z := c.counter.NewIdent(name.ID)
+	c.rules[name] = withTail(rest, z)
+	c.rules[z] = withTail(recursive, z)
+}
+
+func withTail(rules []gnfRule, tail Ident) []gnfRule {
+	res := slices.Clone(rules)
+	for _, rule := range rules {
+		res = append(res, gnfRule{
+			rule:   append(slices.Clone(rule.rule), tail),
+			origin: rule.origin,
+		})
+	}
+
+	return res
+}
+
+// substituteHeads раскрывает первые селекторы до тех пор, пока каждое правило
+// не начнется с терминала. После removeLeftRecursion граф "первых селекторов"
+// ацикличен, поэтому обход в глубину всегда заканчивается.
+func (c *greibach) substituteHeads() {
+	done := make(Set[Ident], len(c.rules))
+	visiting := make(Set[Ident])
+
+	var resolve func(name Ident)
+	resolve = func(name Ident) {
+		if done.Has(name) {
+			return
+		}
+		if visiting.Has(name) {
+			panic(fmt.Sprintf("left recursion through %v was not removed", name))
+		}
+		visiting[name] = struct{}{}
+
+		res := make([]gnfRule, 0, len(c.rules[name]))
+		for _, rule := range c.rules[name] {
+			head := rule.rule[0]
+			if c.terms.Has(head) {
+				res = append(res, rule)
+				continue
+			}
+
+			resolve(head)
+			res = append(res, c.expandHead([]gnfRule{rule}, head)...)
+		}
+
+		c.rules[name] = res
+		delete(visiting, name)
+		done[name] = struct{}{}
+	}
+
+	for _, name := range slices.SortEq(maps.Keys(c.rules)) {
+		resolve(name)
+	}
+}
+
+// liftTerminals выносит терминалы, стоящие не на первом месте, в отдельные
+// правила, что бы хвост каждого правила состоял только из нетерминалов.
+func (c *greibach) liftTerminals() {
+	lifted := make(map[Ident]Ident)
+	lift := func(term Ident) Ident {
+		if name, ok := lifted[term]; ok {
+			return name
+		}
+		name := c.counter.NewIdent(term.ID)
+		lifted[term] = name
+		c.rules[name] = []gnfRule{{rule: IdentSet{term}}}
+
+		return name
+	}
+
+	for _, name := range slices.SortEq(maps.Keys(c.rules)) {
+		for i, rule := range c.rules[name] {
+			c.rules[name][i].rule = append(IdentSet{rule.rule[0]}, slices.Remap(rule.rule[1:], func(_ int, selector Ident) Ident {
+				if c.terms.Has(selector) {
+					return lift(selector)
+				}
+				return selector
+			})...)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package grammar_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zeebo/xxh3"
+
+	. "github.com/quenbyako/parser/grammar"
+)
+
+func TestBNF_AsGNF(t *testing.T) {
+	const exprGrammar = `
+		expr   : expr "+" term | term ;
+		term   : term "*" factor | factor ;
+		factor : "(" expr ")" | num ;
+	`
+
+	for _, tt := range []struct {
+		name     string
+		input    string
+		expected bool
+	}{
+		{name: "single", input: `num`, expected: true},
+		{name: "sum", input: `num + num`, expected: true},
+		{name: "priority", input: `num + num * num`, expected: true},
+		{name: "brackets", input: `( num + num ) * num`, expected: true},
+		{name: "unfinished", input: `num +`, expected: false},
+		{name: "unbalanced", input: `( num`, expected: false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := Parse("", strings.NewReader(exprGrammar), "num")
+			require.NoError(t, err)
+
+			gnf := g.AsBNF().AsGNF("expr")
+			requireGreibach(t, gnf, terms(g))
+
+			var recognized bool
+			for _, start := range gnf.Chains.Variants(Ident{ID: gnf.StartRule}) {
+				recognized = recognized || recognizeGNF(gnf, []Ident{start}, sentence(tt.input))
+			}
+			require.Equal(t, tt.expected, recognized)
+		})
+	}
+}
+
+func TestGNF_Origin(t *testing.T) {
+	g, err := Parse("", strings.NewReader(`
+		S : A b ;
+		A : a ;
+	`), "a", "b")
+	require.NoError(t, err)
+
+	gnf := g.AsBNF().AsGNF("S")
+	for rule := range gnf.Rules.IterRules() {
+		if rule.Name.Eq(Ident{ID: "S"}) {
+			require.Equal(t, []string{"S : A b ;", "A : a ;"}, stringifyRules(gnf.Origin(rule.Name, rule.Rule)))
+		}
+	}
+}
+
+func requireGreibach(t *testing.T, gnf *GNF, terms Set[Ident]) {
+	t.Helper()
+
+	for rule := range gnf.Rules.IterRules() {
+		require.True(t, terms.Has(rule.Rule[0]), "rule %v must start with terminal", rule)
+		for _, selector := range rule.Rule[1:] {
+			require.False(t, terms.Has(selector), "rule %v must contain only one terminal", rule)
+		}
+	}
+}
+
+// recognizeGNF это простейший магазинный автомат: на каждом шаге снимаем
+// нетерминал со стека и пробуем все его правила, которые начинаются с
+// текущего терминала.
+func recognizeGNF(g *GNF, stack []Ident, input []Ident) bool {
+	if len(stack) == 0 || len(input) == 0 {
+		return len(stack) == 0 && len(input) == 0
+	}
+
+	for _, rule := range g.Rules.GetRules(stack[0]) {
+		if rule[0].Eq(input[0]) && recognizeGNF(g, append(append([]Ident{}, rule[1:]...), stack[1:]...), input[1:]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func terms(g *EBNF) Set[Ident] {
+	res := make(Set[Ident])
+	for term := range g.Terminals {
+		res = res.Append(term)
+	}
+	for hash := range g.Constants {
+		res = res.Append(Ident{ID: "CONST", AttrHash: hash})
+	}
+
+	return res
+}
+
+func sentence(s string) []Ident {
+	res := []Ident{}
+	for _, word := range strings.Fields(s) {
+		if word == "num" {
+			res = append(res, Ident{ID: word, AttrHash: xxh3.HashString("")})
+		} else {
+			res = append(res, Ident{ID: "CONST", AttrHash: xxh3.HashString(word)})
+		}
+	}
+
+	return res
+}
+
+func stringifyRules(rules []CanonicalRule) []string {
+	res := make([]string, len(rules))
+	for i, rule := range rules {
+		res[i] = rule.String()
+	}
+
+	return res
+}
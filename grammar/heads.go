@@ -0,0 +1,228 @@
+package grammar
+
+import "github.com/quenbyako/parser/slices"
+
+// Head это символ, помеченный вершиной правила: `np : adj noun^ ;`.
+type Head struct{ I Ident }
+
+var _ Expr = Head{}
+
+func (_ Head) expr()                                          {}
+func (h Head) String() string                                 { return h.I.String() + "^" }
+func (h Head) UnwrapBNF(c func() Ident) ([]IdentSet, RuleSet) { return h.I.UnwrapBNF(c) }
+
+// Heads это вершины правил и объявления протекания атрибутов
+// (`@percolate np<case num> ;`): нетерминал в дереве разбора получает
+// перечисленные атрибуты своей вершины.
+//
+// Вершины хранятся для каждого правила отдельно, так же как Weights, и
+// переезжают вместе с правилами при приведении к нормальной форме.
+//
+// По протекшим атрибутам нетерминал можно выбрать в правилах:
+// `s : np<case=nom> vp ;`. Такие селекторы проверяет сам разбор (см.
+// BNF.specialize), а готовые атрибуты в дереве считает cyk.Tree.Percolate.
+type Heads struct {
+	// Percolate[np] это атрибуты, которые np берет у своей вершины.
+	Percolate map[string][]string
+	// Selectors это селекторы нетерминалов, которые встречаются в правилах,
+	// так же как EBNF.Terminals у терминалов.
+	Selectors map[Ident]ComplexIdent
+
+	// ключ — хеш CanonicalRule, значение — номер вершины в правиле. nil
+	// означает, что вершин в грамматике нет вообще.
+	rules map[uint64]int
+}
+
+// Get возвращает номер вершины в правиле name : rule, если он известен.
+func (h Heads) Get(name Ident, rule IdentSet) (int, bool) {
+	i, ok := h.rules[ruleHash(name, rule)]
+	return i, ok
+}
+
+// set запоминает вершину правила. Если одно и то же правило получилось из
+// нескольких, остается первая вершина.
+func (h Heads) set(name Ident, rule IdentSet, i int) {
+	if h.rules == nil || i < 0 {
+		return
+	}
+	if _, ok := h.rules[ruleHash(name, rule)]; !ok {
+		h.rules[ruleHash(name, rule)] = i
+	}
+}
+
+// like возвращает те же объявления без вершин правил, если в h вершины
+// есть.
+func (h Heads) like() Heads {
+	if h.rules != nil {
+		h.rules = make(map[uint64]int, len(h.rules))
+	}
+
+	return h
+}
+
+// headAfter возвращает номер вершины head в правиле после того, как из
+// него выкинули символы с kept[i] == false, или -1, если выкинули саму
+// вершину.
+func headAfter(head int, kept []bool) int {
+	if head < 0 || head >= len(kept) || !kept[head] {
+		return -1
+	}
+
+	return len(slices.Filter(kept[:head], func(k bool) bool { return k }))
+}
+
+// unwrapHeads работает как Expr.UnwrapBNF, но кроме правил возвращает для
+// каждого из них номер вершины: -1, если ее нет, и -2, если вершин в одной
+// альтернативе больше одной.
+func unwrapHeads(e Expr, c func() Ident) (rules []IdentSet, heads []int, newRules RuleSet) {
+	switch e := e.(type) {
+	case Head:
+		rules, newRules = e.UnwrapBNF(c)
+		return rules, []int{0}, newRules
+
+	case Group:
+		return unwrapHeads(e.E, c)
+
+	case Weighted:
+		return unwrapHeads(e.E, c)
+
+	case Option:
+		rules, heads, newRules = unwrapHeads(e.E, c)
+		return append(rules, IdentSet{}), append(heads, -1), newRules
+
+	case Alts:
+		newRules = make(RuleSet)
+		for _, alt := range e {
+			more, moreHeads, evenMoreRules := unwrapHeads(alt, c)
+			newRules = mapsMerge(newRules, evenMoreRules)
+			rules, heads = append(rules, more...), append(heads, moreHeads...)
+		}
+		return rules, heads, newRules
+
+	case Seq:
+		newRules = make(RuleSet)
+		type variant struct {
+			rule IdentSet
+			head int
+		}
+		exploded := slices.Remap(e, func(_ int, e Expr) []variant {
+			more, moreHeads, evenMoreRules := unwrapHeads(e, c)
+			newRules = mapsMerge(newRules, evenMoreRules)
+			return slices.Remap(more, func(i int, rule IdentSet) variant { return variant{rule, moreHeads[i]} })
+		})
+
+		for _, possible := range slices.Possibles(exploded) {
+			rule, head := IdentSet{}, -1
+			for _, v := range possible {
+				switch {
+				case v.head == -2 || v.head >= 0 && head != -1:
+					head = -2
+				case v.head >= 0:
+					head = len(rule) + v.head
+				}
+				rule = append(rule, v.rule...)
+			}
+			rules, heads = append(rules, rule), append(heads, head)
+		}
+		return rules, heads, newRules
+
+	default:
+		// повторы и сами символы: вершин внутри повтора не бывает
+		rules, newRules = e.UnwrapBNF(c)
+		return rules, slices.Remap(rules, func(int, IdentSet) int { return -1 }), newRules
+	}
+}
+
+// HeadRules отвечает на вопросы о вершинах для дерева разбора
+// бинаризованной грамматики, в котором есть сгенерированные нетерминалы и
+// цепочки. Собирается методами CNF.HeadRules и BinaryNF.HeadRules.
+type HeadRules struct {
+	Heads
+
+	chains    map[Ident]Chain
+	terminals map[Ident]ComplexIdent
+}
+
+func newHeadRules(h Heads, chains ChainList, terminals map[Ident]ComplexIdent) *HeadRules {
+	res := &HeadRules{Heads: h, chains: make(map[Ident]Chain, len(chains)), terminals: terminals}
+	for _, obj := range chains {
+		res.chains[obj.From] = obj.Chain
+	}
+
+	return res
+}
+
+// HeadRules возвращает вершины правил вместе с цепочками грамматики.
+func (g *CNF) HeadRules() *HeadRules { return newHeadRules(g.Heads, g.Chains, g.Terminals) }
+
+// HeadRules возвращает вершины правил. Цепочек в 2NF нет, унарные правила
+// остаются в дереве как есть.
+func (g *BinaryNF) HeadRules() *HeadRules { return newHeadRules(g.Heads, nil, g.Terminals) }
+
+// Chain возвращает цепочку правил, которую заменил нетерминал i при
+// приведении к CNF.
+func (h *HeadRules) Chain(i Ident) (Chain, bool) {
+	c, ok := h.chains[i]
+	return c, ok
+}
+
+// Label возвращает символ исходной грамматики, который стоит в дереве за i:
+// у цепочки это ее начало, у остальных сам i.
+func (h *HeadRules) Label(i Ident) Ident {
+	if c, ok := h.chains[i]; ok {
+		return c[0]
+	}
+
+	return i
+}
+
+// Head возвращает номер вершины среди потомков children ноды parent, или
+// -1. Вершины берутся из правила parent : children, а если в нем ничего не
+// помечено, вершиной считается единственный потомок.
+func (h *HeadRules) Head(parent Ident, children []Ident) int {
+	if i, ok := h.Get(parent, children); ok {
+		return i
+	}
+	if len(children) == 1 {
+		return 0
+	}
+
+	return -1
+}
+
+// Features возвращает атрибуты, которые parent берет у вершины с атрибутами
+// head. Сгенерированные нетерминалы берут все, остальные — только
+// объявленные в `@percolate`, а если там ничего нет, возвращается nil.
+func (h *HeadRules) Features(parent Ident, head map[string]Value) map[string]Value {
+	if parent.Generated {
+		return head
+	}
+
+	var res map[string]Value
+	for _, k := range h.Percolate[parent.ID] {
+		if v, ok := head[k]; ok {
+			if res == nil {
+				res = make(map[string]Value)
+			}
+			res[k] = v
+		}
+	}
+
+	return res
+}
+
+// Terminal возвращает атрибуты, которые гарантирует селектор терминала i:
+// флаги и равенства. Это атрибуты листа дерева, если у входа других нет.
+func (h *HeadRules) Terminal(i Ident) map[string]Value {
+	term, ok := h.terminals[i]
+	if !ok || len(term.Properties) == 0 {
+		return nil
+	}
+
+	res := make(map[string]Value, len(term.Properties))
+	for k, v := range term.Properties {
+		res[k] = v
+	}
+
+	return res
+}
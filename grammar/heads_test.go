@@ -0,0 +1,162 @@
+package grammar_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/quenbyako/parser/slices"
+
+	. "github.com/quenbyako/parser/grammar"
+)
+
+func TestParse_Heads(t *testing.T) {
+	g, err := Parse("", strings.NewReader(`
+		@percolate np<case num> ;
+		np : [det] adj noun^ | pron^ | np^ conj np ;
+		vp : ( verb^ | aux vp^ ) [ np ] ;
+		pp : prep np ;
+	`), "det", "adj", "noun", "pron", "conj", "verb", "aux", "prep")
+	require.NoError(t, err)
+	require.Equal(t, map[string][]string{"np": {"case", "num"}}, g.Heads.Percolate)
+
+	bnf := g.AsBNF()
+	for _, tt := range []struct {
+		name string
+		rule []string
+		want int
+	}{
+		{"np", []string{"det", "adj", "noun"}, 2},
+		{"np", []string{"adj", "noun"}, 1},
+		{"np", []string{"pron"}, 0},
+		{"np", []string{"np", "conj", "np"}, 0},
+		{"vp", []string{"verb"}, 0},
+		{"vp", []string{"aux", "vp", "np"}, 1},
+	} {
+		rule := slices.Remap(tt.rule, func(_ int, s string) Ident {
+			if s == "np" || s == "vp" {
+				return Ident{ID: s}
+			}
+			return terminal(g, s)
+		})
+		var ok bool
+		for _, r := range bnf.Rules[Ident{ID: tt.name}] {
+			if slices.Equal(r, rule) {
+				ok = true
+			}
+		}
+		require.True(t, ok, "%v : %v", tt.name, tt.rule)
+		head, ok := bnf.Heads.Get(Ident{ID: tt.name}, rule)
+		require.True(t, ok, "%v : %v", tt.name, tt.rule)
+		require.Equal(t, tt.want, head, "%v : %v", tt.name, tt.rule)
+	}
+	// у pp вершины нет
+	_, ok := bnf.Heads.Get(Ident{ID: "pp"}, IdentSet{terminal(g, "prep"), {ID: "np"}})
+	require.False(t, ok)
+
+	// пометки переживают приведение к нормальной форме
+	heads := g.AsCNF("np").HeadRules()
+	require.Equal(t, -1, heads.Head(Ident{ID: "np"}, []Ident{terminal(g, "adj"), terminal(g, "adj")}))
+	require.Equal(t,
+		map[string]Value{"case": StringValue("nom")},
+		heads.Features(Ident{ID: "np"}, map[string]Value{"case": StringValue("nom"), "anim": {}}),
+	)
+	require.Nil(t, heads.Features(Ident{ID: "vp"}, map[string]Value{"num": StringValue("sg")}))
+}
+
+// вершины помечаются у каждого правила отдельно: один и тот же список
+// потомков может встретиться в разных правилах с разными вершинами
+func TestHeadRules_PerProduction(t *testing.T) {
+	g, err := Parse("", strings.NewReader(`
+		s  : np^ vp | vp^ np | x ;
+		x  : np vp^ ;
+		np : noun ;
+		vp : verb ;
+	`), "noun", "verb")
+	require.NoError(t, err)
+
+	np, vp := Ident{ID: "np"}, Ident{ID: "vp"}
+	for _, heads := range []*HeadRules{g.AsCNF("s").HeadRules(), g.AsBNF().As2NF("s").HeadRules()} {
+		require.Equal(t, 0, heads.Head(Ident{ID: "s"}, []Ident{np, vp}))
+		require.Equal(t, 0, heads.Head(Ident{ID: "s"}, []Ident{vp, np}))
+		require.Equal(t, 1, heads.Head(Ident{ID: "x"}, []Ident{np, vp}))
+	}
+
+	// длинное правило бинаризуется, и вершина уходит в сгенерированный
+	// нетерминал
+	g, err = Parse("", strings.NewReader(`s : noun verb^ noun ;`), "noun", "verb")
+	require.NoError(t, err)
+	cnf := g.AsCNF("s")
+	var found bool
+	for _, rule := range cnf.Rules[Ident{ID: "s"}] {
+		head, ok := cnf.Heads.Get(Ident{ID: "s"}, rule[:])
+		require.True(t, ok, rule)
+		require.Equal(t, 1, head, rule)
+		require.True(t, rule[1].Generated, rule)
+		for _, inner := range cnf.Rules[rule[1]] {
+			head, ok := cnf.Heads.Get(rule[1], inner[:])
+			require.True(t, ok, inner)
+			require.Equal(t, 0, head, inner)
+			found = true
+		}
+	}
+	require.True(t, found)
+}
+
+func TestParse_HeadErrors(t *testing.T) {
+	for _, tt := range []struct{ src, err string }{
+		{"np^ : noun ;", `src:1:1: rule np can't be marked as a head`},
+		{"@percolate np<case> ;\n@percolate np<num> ;\nnp : noun ;", `src:2:1: percolation to np is already declared at src:1:1`},
+		{"@percolate noun<case> ;\nnp : noun ;", `src:1:1: noun is a terminal, its attributes come from the input`},
+		{"np : noun^ noun^ ;", `src:1:1: rule np has more than one head in one alternative`},
+		{"np : { noun^ } ;", `src:1:8: noun inside a repetition can't be a head`},
+		{"s : np<case=nom> ;\nnp : noun ;", `src:1:8: attribute case of np is not percolated from its head`},
+		{"@percolate np<case> ;\ns : np<num> ;\nnp : noun ;", `src:2:8: attribute num of np is not percolated from its head`},
+		{"np<case> : noun ;", `src:1:1: rule np can't have a selector`},
+		{"@attribute case (nom | acc) ;\n@percolate np<case> ;\ns : np<case=dat> ;\nnp : noun^ ;", `src:3:5: np<case="dat">: attribute case has no value "dat", expected one of "nom", "acc"`},
+	} {
+		_, err := Parse("src", strings.NewReader(tt.src), "noun")
+		require.EqualError(t, err, tt.err)
+	}
+}
+
+// селектор нетерминала по протекшим атрибутам уходит через вершины в
+// селекторы терминалов
+func TestBNF_Selectors(t *testing.T) {
+	g, err := Parse("", strings.NewReader(`
+		@percolate np<case num> ;
+		@percolate nn<case> ;
+		s  : np<case=nom num!=sg> verb ;
+		np : det nn^ | pron<case=acc>^ | det adj ;
+		nn : adj nn^ | noun ;
+	`), "det", "adj", "noun", "pron", "verb")
+	require.NoError(t, err)
+
+	// новые терминалы появляются только под np<case=nom num!=sg>
+	bnf := g.AsBNF()
+	matches := func(word string, props map[string]Value) bool {
+		for i, term := range bnf.Terminals {
+			if _, ok := g.Terminals[i]; !ok && term.Select(ComplexIdent{ID: word, Properties: props}) {
+				return true
+			}
+		}
+		return false
+	}
+
+	nom, acc, sg := StringValue("nom"), StringValue("acc"), StringValue("sg")
+	require.True(t, matches("noun", map[string]Value{"case": nom}))
+	require.False(t, matches("noun", map[string]Value{"case": acc}))
+	// nn не берет num у вершины, так что у np его нет, и num!=sg выполнено
+	require.True(t, matches("noun", map[string]Value{"case": nom, "num": sg}))
+	// pron<case=acc> и case=nom одновременно не бывает
+	require.False(t, matches("pron", map[string]Value{"case": nom}))
+	require.False(t, matches("pron", map[string]Value{"case": acc}))
+
+	// у правила без вершины атрибутов нет
+	for rule := range bnf.Rules.IterRules() {
+		if rule.Name.ID == "np" && rule.Name.AttrHash != 0 {
+			require.NotEqual(t, IdentSet{terminal(g, "det"), terminal(g, "adj")}, rule.Rule)
+		}
+	}
+}
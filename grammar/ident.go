@@ -3,13 +3,13 @@ package grammar
 import (
 	"encoding/binary"
 	"fmt"
+	"sort"
 	"strings"
 	"unicode"
 
 	"github.com/quenbyako/parser/constraints"
 	"github.com/quenbyako/parser/slices"
 	"github.com/zeebo/xxh3"
-	"golang.org/x/exp/maps"
 )
 
 // TODO: remove it, but i don't know how...
@@ -72,15 +72,22 @@ func (i Ident) Hash() (uint64, error) {
 }
 
 type ComplexIdent struct {
-	ID         string
-	Properties map[string]*string
+	ID string
+	// Properties у входного терминала это его атрибуты, а у терминала
+	// грамматики — требования "атрибут есть" (флаг) и "атрибут равен
+	// значению".
+	Properties map[string]Value
+	// Conditions это условия селектора, кроме наличия и равенства: они
+	// бывают только у терминалов грамматики, у входных терминалов атрибуты
+	// лежат в Properties.
+	Conditions []Condition
 }
 
 func (i ComplexIdent) String() string {
-	if len(i.Properties) == 0 {
+	if len(i.Properties) == 0 && len(i.Conditions) == 0 {
 		return i.ID
 	}
-	return i.ID + "<" + i.metadata() + ">"
+	return i.ID + "<" + i.selector(displayValue) + ">"
 }
 
 func (i ComplexIdent) Hash() (uint64, error) { return xxh3.HashString(i.metadata()), nil }
@@ -89,19 +96,17 @@ func (i ComplexIdent) Hash() (uint64, error) { return xxh3.HashString(i.metadata
 //
 // объект, у которого вызывается метод является фильтром
 func (i ComplexIdent) Select(o ComplexIdent) bool {
-	if len(i.Properties) == 0 {
-		return i.ID == o.ID
-	}
-
-	// guaranteed that i requires some attributes, so returning false
-	if len(o.Properties) == 0 {
+	if i.ID != o.ID {
 		return false
 	}
 
 	for k, v1 := range i.Properties {
-		if v2, ok := o.Properties[k]; v1 == nil {
-			return ok
-		} else if v2 == nil || *v1 != *v2 {
+		if v2, ok := o.Properties[k]; !ok || v1.Kind != KindFlag && !v1.Eq(v2) {
+			return false
+		}
+	}
+	for _, c := range i.Conditions {
+		if !c.match(o.Properties) {
 			return false
 		}
 	}
@@ -109,22 +114,44 @@ func (i ComplexIdent) Select(o ComplexIdent) bool {
 	return true
 }
 
-func (i ComplexIdent) metadata() string {
-	if len(i.Properties) == 0 {
+func (i ComplexIdent) metadata() string { return i.selector(metadataValue) }
+
+// selector записывает все атрибуты селектора через пробел, отсортированными
+// по имени, так что от порядка в грамматике запись (и хеш) не зависит.
+// Значения записываются через value.
+func (i ComplexIdent) selector(value func(Value) string) string {
+	if len(i.Properties) == 0 && len(i.Conditions) == 0 {
 		return ""
 	}
 
-	keys := slices.Sort(maps.Keys(i.Properties))
-	metadata := make([]string, len(keys))
-	for j, k := range keys {
-		if v := i.Properties[k]; v != nil {
-			metadata[j] = k + "=" + normalizeMetadataValue(*v)
+	type entry struct{ key, text string }
+	entries := make([]entry, 0, len(i.Properties)+len(i.Conditions))
+	for k, v := range i.Properties {
+		if v.Kind != KindFlag {
+			entries = append(entries, entry{k, k + "=" + value(v)})
 		} else {
-			metadata[j] = k
+			entries = append(entries, entry{k, k})
+		}
+	}
+	for _, c := range i.Conditions {
+		entries = append(entries, entry{c.Key, c.format(value)})
+	}
+	sort.Slice(entries, func(a, b int) bool {
+		if entries[a].key != entries[b].key {
+			return entries[a].key < entries[b].key
+		}
+		return entries[a].text < entries[b].text
+	})
+
+	res := make([]string, 0, len(entries))
+	for j, e := range entries {
+		// `case=(nom)` и `case=nom` это одно и то же
+		if j == 0 || e != entries[j-1] {
+			res = append(res, e.text)
 		}
 	}
 
-	return strings.Join(metadata, " ")
+	return strings.Join(res, " ")
 }
 
 func normalizeMetadataValue(s string) string {
@@ -3,8 +3,10 @@ package grammar
 import (
 	"fmt"
 	"io"
+	"regexp"
 
 	"github.com/alecthomas/participle/v2"
+	"github.com/alecthomas/participle/v2/lexer"
 	"golang.org/x/exp/maps"
 
 	"github.com/quenbyako/parser/constraints"
@@ -75,52 +77,401 @@ type Hasher interface {
 }
 
 type grammar struct {
-	P []production `parser:"@@*"`
+	S []statement `parser:"@@*"`
 }
 
-func (g grammar) normalize(terms Set[string]) *EBNF {
+// statement это правило, объявление схемы или протекания атрибутов.
+type statement struct {
+	D *declaration `parser:"  @@"`
+	H *percolation `parser:"| @@"`
+	P *production  `parser:"| @@"`
+}
+
+func (g grammar) productions() []production {
+	res := make([]production, 0, len(g.S))
+	for _, s := range g.S {
+		if s.P != nil {
+			res = append(res, *s.P)
+		}
+	}
+
+	return res
+}
+
+func (g grammar) normalize(terms Set[string], schema Schema) (*EBNF, error) {
 	res := &EBNF{
 		Rules: make(map[Ident][]Expr),
 
 		Terminals: make(map[Ident]ComplexIdent),
 		Constants: make(map[uint64]string),
+		Schema:    schema,
+		Positions: make(map[Ident]lexer.Position),
+		Heads:     Heads{Percolate: make(map[string][]string), Selectors: make(map[Ident]ComplexIdent)},
 	}
-	for _, p := range g.P {
-		name, expr := p.normalize(res, terms)
-		exprs := []Expr{expr}
-		if alts, ok := expr.(Alts); ok {
-			exprs = alts
+	for _, p := range g.productions() {
+		rule, exprs := p.normalize(res, terms)
+		res.Rules[rule] = append(res.Rules[rule], exprs...)
+		for _, expr := range exprs {
+			// генератор здесь только для проверки, настоящие нетерминалы
+			// появятся в AsBNF
+			_, heads, _ := unwrapHeads(expr, func() Ident { return Ident{ID: rule.ID, Generated: true} })
+			if slices.Contains(heads, -2) {
+				return nil, fmt.Errorf("%v: rule %v has more than one head in one alternative", p.N.Pos, rule)
+			}
 		}
+	}
+	for _, s := range g.S {
+		if s.H != nil {
+			res.Heads.Percolate[s.H.Name] = append([]string{}, s.H.Keys...)
+		}
+	}
+
+	return res, nil
+}
 
-		res.Rules[name] = append(res.Rules[name], exprs...)
+// schema собирает объявления схемы.
+func (g grammar) schema() (Schema, error) {
+	var decls []declaration
+	for _, s := range g.S {
+		if s.D != nil {
+			decls = append(decls, *s.D)
+		}
 	}
 
-	return res
+	return buildSchema(decls)
+}
+
+// validate проверяет то, что не выразить грамматикой парсера.
+func (g grammar) validate(terms Set[string]) error {
+	percolated := make(map[string]lexer.Position)
+	keys := make(map[string]Set[string])
+	for _, s := range g.S {
+		if s.H == nil {
+			continue
+		}
+		if pos, ok := percolated[s.H.Name]; ok {
+			return fmt.Errorf("%v: percolation to %v is already declared at %v", s.H.Pos, s.H.Name, pos)
+		}
+		if terms.Has(s.H.Name) {
+			return fmt.Errorf("%v: %v is a terminal, its attributes come from the input", s.H.Pos, s.H.Name)
+		}
+		percolated[s.H.Name] = s.H.Pos
+		keys[s.H.Name] = slices.ToMap(s.H.Keys)
+	}
+
+	for _, p := range g.productions() {
+		if p.N.Head {
+			return fmt.Errorf("%v: rule %v can't be marked as a head", p.N.Pos, p.N.Ident)
+		}
+		if len(p.N.Params) > 0 {
+			return fmt.Errorf("%v: rule %v can't have a selector", p.N.Pos, p.N.Ident)
+		}
+		var err error
+		p.walkRepeated(func(n name, repeated bool) {
+			if n.Head && repeated && err == nil {
+				err = fmt.Errorf("%v: %v inside a repetition can't be a head", n.Pos, n.Ident)
+			}
+		})
+		if err != nil {
+			return err
+		}
+		for _, alt := range p.E.A {
+			if alt.W != nil && (*alt.W <= 0 || *alt.W > 1) {
+				return fmt.Errorf("%v: weight %v of %v is out of range (0, 1]", alt.Pos, *alt.W, p.N.Ident)
+			}
+		}
+	}
+
+	var err error
+	g.eachName(func(n name) {
+		for _, item := range n.Params {
+			// у нетерминала есть только те атрибуты, что протекают от
+			// вершины
+			if !terms.Has(n.Ident) && !keys[n.Ident].Has(item.Key) && err == nil {
+				err = fmt.Errorf("%v: attribute %v of %v is not percolated from its head", item.Pos, item.Key, n.Ident)
+			}
+			if err == nil {
+				err = item.validate()
+			}
+		}
+	})
+
+	return err
+}
+
+// eachName вызывает fn для каждого имени в грамматике: и для заголовков
+// правил, и для всех упоминаний внутри них.
+func (g grammar) eachName(fn func(name)) {
+	for _, p := range g.productions() {
+		fn(p.N)
+		p.walk(fn)
+	}
+}
+
+// walk вызывает fn для каждого имени в теле правила, в том числе внутри
+// групп, опций и повторов.
+func (p production) walk(fn func(name)) {
+	p.walkRepeated(func(n name, _ bool) { fn(n) })
+}
+
+// walkRepeated работает как walk, но еще сообщает, стоит ли имя внутри
+// повтора.
+func (p production) walkRepeated(fn func(n name, repeated bool)) {
+	var walkAlts func(alts []sequence, repeated bool)
+	walkSeq := func(s sequence, repeated bool) {
+		for _, t := range s.T {
+			switch {
+			case t.Name != nil:
+				fn(*t.Name, repeated)
+			case t.Group != nil:
+				walkAlts(t.Group.E.A, repeated)
+			case t.Option != nil:
+				walkAlts(t.Option.E.A, repeated)
+			case t.Repeat != nil:
+				walkAlts(t.Repeat.E.A, true)
+			}
+		}
+	}
+	walkAlts = func(alts []sequence, repeated bool) {
+		for _, s := range alts {
+			walkSeq(s, repeated)
+		}
+	}
+
+	for _, alt := range p.E.A {
+		walkSeq(alt.S, false)
+	}
 }
 
 type production struct {
-	C string `parser:"@Comment?"`
-	N name   `parser:"@@ (':')"`
-	E alts   `parser:"@@ ';'"`
+	C string       `parser:"@Comment?"`
+	N name         `parser:"@@ (':')"`
+	E weightedAlts `parser:"@@ ';'"`
 }
 
-func (p production) normalize(n *EBNF, terms Set[string]) (Ident, Expr) {
+func (p production) normalize(n *EBNF, terms Set[string]) (Ident, []Expr) {
 	name := p.N.asNonTerm()
 	return name, p.E.normalize(n, terms)
 }
 
+// weightedAlts это альтернативы на верхнем уровне правила: только у них
+// может быть вес, например `np : adj noun [0.7] | noun [0.3] ;`.
+type weightedAlts struct {
+	A []weightedSequence `parser:"@@ ( '|' @@ )*"`
+}
+
+func (e weightedAlts) normalize(n *EBNF, terms Set[string]) []Expr {
+	return slices.Remap(e.A, func(_ int, alt weightedSequence) Expr { return alt.normalize(n, terms) })
+}
+
+type weightedSequence struct {
+	Pos lexer.Position
+
+	S sequence `parser:"@@"`
+	W *float64 `parser:"( '[' @(Float | Int) ']' )?"`
+}
+
+func (s weightedSequence) normalize(n *EBNF, terms Set[string]) Expr {
+	if s.W == nil {
+		return s.S.normalize(n, terms)
+	}
+
+	return Weighted{E: s.S.normalize(n, terms), P: *s.W}
+}
+
+// name это символ в правиле. `^` после него помечает вершину правила:
+// `np : adj noun^ ;`.
 type name struct {
+	Pos lexer.Position
+
 	Ident  string          `parser:"@Ident"`
 	Params []identMetadata `parser:"( '<' @@ + '>' )?"`
+	Head   bool            `parser:"@'^'?"`
 }
 
+// identMetadata это одно условие селектора терминала:
+//
+//	noun<case>           атрибут есть
+//	noun<!anim>          атрибута нет
+//	noun<case=nom>       атрибут равен значению
+//	noun<case!=nom>      атрибута нет или он не равен значению
+//	noun<case=(gen|acc)> значение одно из перечисленных (так же и с !=)
+//	noun<lemma^=un>      значение начинается с префикса
+//	noun<lemma~="^un">   значение подходит под регулярное выражение
+//	noun<count>=2>       значение это число, которое сравнивается с данным
 type identMetadata struct {
-	Key   string  `parser:"@Ident"`
-	Value *string `parser:"( '=' ( @Ident | @String ) )?"`
+	Pos lexer.Position
+
+	Absent  bool        `parser:"@'!'?"`
+	Key     string      `parser:"@Ident"`
+	Compare *comparison `parser:"( @@"`
+	Match   *match      `parser:"| @@ )?"`
+}
+
+// comparison сравнивает атрибут только с числом, поэтому `noun<case>` не
+// путается со сравнением.
+type comparison struct {
+	Op    string `parser:"@( '<' '=' | '>' '=' | '<' | '>' )"`
+	Value number `parser:"@@"`
+}
+
+type match struct {
+	Op    string    `parser:"@( '!' '=' | '^' '=' | '~' '=' | '=' )"`
+	Value *literal  `parser:"( @@"`
+	Alts  []literal `parser:"| '(' @@ ( '|' @@ )* ')' )"`
+}
+
+// literal это значение атрибута. Тип берется из записи: числа это int или
+// float, true и false это bool, все остальное — строки.
+type literal struct {
+	Number *number `parser:"  @@"`
+	Str    *string `parser:"| @String"`
+	Word   *string `parser:"| @Ident"`
+}
+
+type number struct {
+	Neg   bool     `parser:"@'-'?"`
+	Float *float64 `parser:"( @Float"`
+	Int   *int64   `parser:"| @Int )"`
+}
+
+func (l literal) value() Value {
+	switch {
+	case l.Number != nil:
+		return l.Number.value()
+	case l.Str != nil:
+		return StringValue(*l.Str)
+	case *l.Word == "true" || *l.Word == "false":
+		return BoolValue(*l.Word == "true")
+	default:
+		return StringValue(*l.Word)
+	}
+}
+
+func (n number) value() Value {
+	if n.Float != nil {
+		if n.Neg {
+			return FloatValue(-*n.Float)
+		}
+		return FloatValue(*n.Float)
+	}
+	if n.Neg {
+		return IntValue(-*n.Int)
+	}
+	return IntValue(*n.Int)
+}
+
+// validate проверяет то, что не зависит от схемы: типы значений
+// проверяет EBNF.Check.
+func (m identMetadata) validate() error {
+	switch {
+	case m.Absent && (m.Compare != nil || m.Match != nil):
+		return fmt.Errorf("%v: attribute %v can't be both absent and compared", m.Pos, m.Key)
+	case m.Match == nil:
+		return nil
+	case m.Match.Alts != nil && m.Match.Op != "=" && m.Match.Op != "!=":
+		return fmt.Errorf("%v: operator %v of attribute %v doesn't accept alternatives", m.Pos, m.Match.Op, m.Key)
+	case m.Match.Op == "~=":
+		if _, err := regexp.Compile(m.Match.Value.value().Text()); err != nil {
+			return fmt.Errorf("%v: attribute %v: %w", m.Pos, m.Key, err)
+		}
+	}
+
+	return nil
+}
+
+func (m match) values() []Value {
+	if m.Value != nil {
+		return []Value{m.Value.value()}
+	}
+
+	return slices.Remap(m.Alts, func(_ int, l literal) Value { return l.value() })
+}
+
+// attribute это объявление типа атрибута:
+//
+//	@attribute count int ;
+//	@attribute case (nom | gen | acc) ;
+//
+// Типы это flag, string, int, float и bool, либо перечисление значений.
+type attribute struct {
+	Pos lexer.Position
+
+	Key  string    `parser:"'@' 'attribute' @Ident"`
+	Kind *string   `parser:"( @( 'flag' | 'string' | 'int' | 'float' | 'bool' )"`
+	Enum []literal `parser:"| '(' @@ ( '|' @@ )* ')' ) ';'"`
+}
+
+var kinds = map[string]ValueKind{
+	"flag":   KindFlag,
+	"string": KindString,
+	"int":    KindInt,
+	"float":  KindFloat,
+	"bool":   KindBool,
+}
+
+func (a attribute) normalize() (AttributeType, error) {
+	if a.Kind != nil {
+		return AttributeType{Kind: kinds[*a.Kind]}, nil
+	}
+
+	res := AttributeType{Kind: a.Enum[0].value().Kind}
+	for _, l := range a.Enum {
+		v := l.value()
+		if v.Kind != res.Kind {
+			return AttributeType{}, fmt.Errorf("%v: values of attribute %v must be of one type, got %v and %v", a.Pos, a.Key, res.Enum[0], v)
+		}
+		res.Enum = append(res.Enum, v)
+	}
+
+	return res, nil
+}
+
+// percolation объявляет, какие атрибуты нетерминал берет у своей вершины:
+// `@percolate np<case num> ;`.
+type percolation struct {
+	Pos lexer.Position
+
+	Name string   `parser:"'@' 'percolate' @Ident"`
+	Keys []string `parser:"'<' @Ident+ '>' ';'"`
+}
+
+func (i name) complex() ComplexIdent {
+	res := ComplexIdent{ID: i.Ident, Properties: make(map[string]Value, len(i.Params))}
+	for _, item := range i.Params {
+		switch {
+		case item.Absent:
+			res.Conditions = append(res.Conditions, Condition{Key: item.Key, Op: OpAbsent})
+		case item.Compare != nil:
+			res.Conditions = append(res.Conditions, Condition{Key: item.Key, Op: comparisons[item.Compare.Op], Values: []Value{item.Compare.Value.value()}})
+		case item.Match == nil:
+			res.Properties[item.Key] = Value{}
+		case item.Match.Op == "=" && item.Match.Value != nil:
+			res.Properties[item.Key] = item.Match.Value.value()
+		default:
+			res.Conditions = append(res.Conditions, Condition{Key: item.Key, Op: comparisons[item.Match.Op], Values: item.Match.values()}.compile())
+		}
+	}
+
+	return res
+}
+
+var comparisons = map[string]Operator{
+	"=":  OpIn,
+	"!=": OpNotIn,
+	"^=": OpPrefix,
+	"~=": OpMatch,
+	"<":  OpLess,
+	"<=": OpLessEqual,
+	">":  OpGreater,
+	">=": OpGreaterEqual,
 }
 
 func (i name) normalize(n *EBNF, terms Set[string]) Expr {
 	if _, ok := terms[i.Ident]; !ok {
+		if len(i.Params) > 0 {
+			return i.asSelector(n)
+		}
 		return i.asNonTerm()
 	}
 
@@ -128,34 +479,33 @@ func (i name) normalize(n *EBNF, terms Set[string]) Expr {
 }
 
 func (i name) asTerm(n *EBNF) Ident {
-	params := make(map[string]*string, len(i.Params))
-	for _, item := range i.Params {
-		params[item.Key] = item.Value
-	}
-
-	replacer := ComplexIdent{
-		ID:         i.Ident,
-		Properties: params,
-	}
+	replacer := i.complex()
 
 	hash, _ := replacer.Hash()
 	ident := Ident{ID: i.Ident, AttrHash: hash}
 	n.Terminals[ident] = replacer
+	if _, ok := n.Positions[ident]; !ok {
+		n.Positions[ident] = i.Pos
+	}
 
 	return ident
 }
 
-func (i name) asNonTerm() Ident {
-	if len(i.Params) == 0 {
-		return Ident{ID: i.Ident}
-	}
+func (i name) asNonTerm() Ident { return Ident{ID: i.Ident} }
 
-	params := make(map[string]*string, len(i.Params))
-	for _, item := range i.Params {
-		params[item.Key] = item.Value
+// asSelector возвращает нетерминал с селектором по протекшим атрибутам,
+// `np<case=nom>`. Правила для него строит AsBNF (см. Heads.Selectors).
+func (i name) asSelector(n *EBNF) Ident {
+	selector := i.complex()
+
+	hash, _ := selector.Hash()
+	ident := Ident{ID: i.Ident, AttrHash: hash}
+	n.Heads.Selectors[ident] = selector
+	if _, ok := n.Positions[ident]; !ok {
+		n.Positions[ident] = i.Pos
 	}
 
-	panic(fmt.Sprintf("nonterminal %v not allowed to get params (for now)", ComplexIdent{i.Ident, params}))
+	return ident
 }
 
 type alts struct {
@@ -235,6 +585,8 @@ func (t term) normalize(n *EBNF, terms Set[string]) Expr {
 		n.Constants[hash] = *t.Const
 
 		return Ident{ID: constIdentName, AttrHash: hash}
+	case t.Name != nil && t.Name.Head:
+		return Head{I: t.Name.normalize(n, terms).(Ident)}
 	case t.Name != nil:
 		return t.Name.normalize(n, terms)
 	case t.Group != nil:
@@ -250,6 +602,8 @@ func (t term) normalize(n *EBNF, terms Set[string]) Expr {
 
 var parser = participle.MustBuild[grammar](
 	participle.Unquote("String"),
+	// вес альтернативы и опция начинаются одинаково: `[`
+	participle.UseLookahead(2),
 )
 
 // грамматика уже очищенна от терминалов и констант.
@@ -269,6 +623,21 @@ func Parse(file string, input io.Reader, terminals ...string) (*EBNF, error) {
 	if err != nil {
 		return nil, err
 	}
+	schema, err := g.schema()
+	if err != nil {
+		return nil, err
+	}
+	if err := g.validate(slices.ToMap(terminals)); err != nil {
+		return nil, err
+	}
+
+	res, err := g.normalize(slices.ToMap(terminals), schema)
+	if err != nil {
+		return nil, err
+	}
+	if err := res.Check(schema); err != nil {
+		return nil, err
+	}
 
-	return g.normalize(slices.ToMap(terminals)), nil
+	return res, nil
 }
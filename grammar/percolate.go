@@ -0,0 +1,167 @@
+package grammar
+
+import (
+	"golang.org/x/exp/maps"
+
+	"github.com/quenbyako/parser/slices"
+)
+
+// specialize строит правила для нетерминалов с селекторами (см.
+// Heads.Selectors), так что их атрибуты проверяет сам разбор.
+//
+// У np<case=nom> те же правила, что у np, но условия на атрибуты, которые
+// np берет у вершины, уходят в вершину правила: нетерминал получает свой
+// селектор с этими условиями, а у терминала они дописываются к его
+// собственному селектору, так что noun<case=nom> подойдет только входу с
+// нужным падежом. Правила, где селектор выполниться не может (вершины нет
+// или атрибут до нетерминала не протекает), выкидываются. Веса и вершины у
+// новых правил те же, что у исходных.
+func (g *BNF) specialize(selectors map[Ident]ComplexIdent) {
+	if len(selectors) == 0 {
+		return
+	}
+
+	g.Terminals = maps.Clone(g.Terminals)
+	s := specializer{g: g, done: make(map[specialized]Ident)}
+	for _, i := range slices.SortEq(maps.Keys(selectors)) {
+		s.nonterminal(Ident{ID: i.ID}, selectors[i])
+	}
+}
+
+type specialized struct {
+	base Ident
+	hash uint64
+}
+
+type specializer struct {
+	g    *BNF
+	done map[specialized]Ident
+}
+
+// nonterminal возвращает нетерминал base с селектором sel и, если его еще
+// нет, строит его правила.
+func (s specializer) nonterminal(base Ident, sel ComplexIdent) Ident {
+	sel.ID = base.ID
+	hash, _ := sel.Hash()
+	key := specialized{base: base, hash: hash}
+	if res, ok := s.done[key]; ok {
+		return res
+	}
+	res := Ident{ID: base.ID, AttrHash: hash}
+	if base.Generated {
+		res = s.g.Counter.NewIdent(base.ID)
+	}
+	// запоминаем до правил: они бывают рекурсивными
+	s.done[key] = res
+
+	// сгенерированные нетерминалы берут у вершины все атрибуты
+	down, rest := sel.split(func(k string) bool {
+		return base.Generated || slices.Contains(s.g.Heads.Percolate[base.ID], k)
+	})
+	for _, rule := range slices.SortEq(maps.Values(s.g.Rules[base])) {
+		head, explicit := s.g.Heads.Get(base, rule)
+		if !explicit {
+			head = -1
+			if len(rule) == 1 {
+				head = 0
+			}
+		}
+
+		// без вершины у нетерминала атрибутов нет вообще
+		local, pushed := rest, down
+		if head < 0 {
+			local, pushed = sel, ComplexIdent{}
+		}
+		if !local.Select(ComplexIdent{ID: base.ID}) {
+			continue
+		}
+
+		specializedRule := rule
+		if head >= 0 {
+			child, ok := s.symbol(rule[head], pushed)
+			if !ok {
+				continue
+			}
+			specializedRule = append(IdentSet{}, rule...)
+			specializedRule[head] = child
+		}
+
+		s.g.Rules = s.g.Rules.AppendRules(res, specializedRule)
+		s.g.Weights.set(res, specializedRule, s.g.Weights.Get(base, rule))
+		if explicit {
+			s.g.Heads.set(res, specializedRule, head)
+		}
+	}
+
+	return res
+}
+
+// symbol возвращает символ i, на который наложены условия sel, или false,
+// если они не выполнятся никогда.
+func (s specializer) symbol(i Ident, sel ComplexIdent) (Ident, bool) {
+	switch term, ok := s.g.Terminals[i]; {
+	case len(sel.Properties) == 0 && len(sel.Conditions) == 0:
+		return i, true
+
+	case ok:
+		merged := term.merge(sel)
+		hash, _ := merged.Hash()
+		res := Ident{ID: i.ID, AttrHash: hash}
+		s.g.Terminals[res] = merged
+		return res, true
+
+	case i.ID == constIdentName:
+		// у констант атрибутов нет
+		sel.ID = i.ID
+		return i, sel.Select(ComplexIdent{ID: i.ID})
+
+	default:
+		return s.nonterminal(i, sel), true
+	}
+}
+
+// split делит селектор на условия по атрибутам, для которых keep
+// возвращает true, и все остальные.
+func (i ComplexIdent) split(keep func(string) bool) (in, out ComplexIdent) {
+	in = ComplexIdent{ID: i.ID, Properties: make(map[string]Value)}
+	out = ComplexIdent{ID: i.ID, Properties: make(map[string]Value)}
+	for k, v := range i.Properties {
+		if keep(k) {
+			in.Properties[k] = v
+		} else {
+			out.Properties[k] = v
+		}
+	}
+	for _, c := range i.Conditions {
+		if keep(c.Key) {
+			in.Conditions = append(in.Conditions, c)
+		} else {
+			out.Conditions = append(out.Conditions, c)
+		}
+	}
+
+	return in, out
+}
+
+// merge дописывает к селектору условия o: подходить должны оба.
+func (i ComplexIdent) merge(o ComplexIdent) ComplexIdent {
+	res := ComplexIdent{
+		ID:         i.ID,
+		Properties: make(map[string]Value, len(i.Properties)+len(o.Properties)),
+		Conditions: append(append([]Condition{}, i.Conditions...), o.Conditions...),
+	}
+	for k, v := range i.Properties {
+		res.Properties[k] = v
+	}
+	for k, v := range o.Properties {
+		switch old, ok := res.Properties[k]; {
+		case !ok || old.Kind == KindFlag:
+			res.Properties[k] = v
+		case v.Kind != KindFlag:
+			// второе равенство тому же атрибуту пишется условием
+			res.Conditions = append(res.Conditions, Condition{Key: k, Op: OpIn, Values: []Value{v}})
+		}
+	}
+
+	return res
+}
@@ -67,3 +67,19 @@ func (r DualRule) Hash() (uint64, error) {
 
 	return xxh3.Hash(res), nil
 }
+
+// combineRules строит обратный индекс бинарных правил: для каждой пары
+// селекторов — отсортированный список нетерминалов, которые из нее собираются.
+func combineRules(rules map[Ident]HashSet[DualRule]) map[DualRule][]Ident {
+	res := make(map[DualRule][]Ident)
+	for name, pairs := range rules {
+		for _, pair := range pairs {
+			res[pair] = append(res[pair], name)
+		}
+	}
+	for pair, names := range res {
+		res[pair] = slices.SortEq(names)
+	}
+
+	return res
+}
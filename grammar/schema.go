@@ -0,0 +1,303 @@
+package grammar
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/alecthomas/participle/v2"
+	"github.com/alecthomas/participle/v2/lexer"
+	"golang.org/x/exp/maps"
+
+	"github.com/quenbyako/parser/slices"
+)
+
+// AttributeType это объявленный тип атрибута (`@attribute count int ;`).
+type AttributeType struct {
+	// Kind это тип значений. KindFlag значит, что значений у атрибута не
+	// бывает вообще, только наличие.
+	Kind ValueKind
+	// Enum, если не пустой, перечисляет все допустимые значения:
+	// `@attribute case (nom | gen | acc) ;`.
+	Enum []Value
+}
+
+func (t AttributeType) String() string {
+	if len(t.Enum) == 0 {
+		return t.Kind.String()
+	}
+
+	return "(" + fmtStringify(t.Enum, " | ") + ")"
+}
+
+// Schema это объявления атрибутов терминалов. Необъявленные атрибуты не
+// проверяются.
+type Schema struct {
+	Attributes map[string]AttributeType
+	// Terminals перечисляет атрибуты, которые бывают у терминала данного
+	// вида: `@terminal noun<case num anim> ;`. У необъявленных видов
+	// проверяются только типы атрибутов.
+	Terminals map[string][]string
+
+	// где объявлены атрибуты и терминалы, если схема прочитана из файла
+	attrPos, termPos map[string]lexer.Position
+}
+
+// ParseSchema читает схему из отдельного файла, в котором есть только
+// объявления `@attribute` и `@terminal`, без правил.
+func ParseSchema(file string, input io.Reader) (Schema, error) {
+	f, err := schemaParser.Parse(file, input)
+	if err != nil {
+		return Schema{}, err
+	}
+
+	return buildSchema(f.D)
+}
+
+// Merge возвращает схему с объявлениями и s, и other, например схему
+// грамматики вместе со схемой из отдельного файла:
+//
+//	side, err := grammar.ParseSchema("schema.txt", f)
+//	schema, err := g.Schema.Merge(side)
+//	err = g.Check(schema)
+//
+// Один и тот же атрибут или терминал, объявленный в обеих схемах, это
+// ошибка, даже если объявления совпадают.
+func (s Schema) Merge(other Schema) (Schema, error) {
+	res := Schema{
+		Attributes: make(map[string]AttributeType, len(s.Attributes)+len(other.Attributes)),
+		Terminals:  make(map[string][]string, len(s.Terminals)+len(other.Terminals)),
+		attrPos:    make(map[string]lexer.Position, len(s.attrPos)+len(other.attrPos)),
+		termPos:    make(map[string]lexer.Position, len(s.termPos)+len(other.termPos)),
+	}
+	for _, from := range []Schema{s, other} {
+		for _, k := range slices.Sort(maps.Keys(from.Attributes)) {
+			if _, ok := res.Attributes[k]; ok {
+				return Schema{}, redeclared("attribute", k, from.attrPos[k], res.attrPos[k])
+			}
+			res.Attributes[k], res.attrPos[k] = from.Attributes[k], from.attrPos[k]
+		}
+		for _, k := range slices.Sort(maps.Keys(from.Terminals)) {
+			if _, ok := res.Terminals[k]; ok {
+				return Schema{}, redeclared("terminal", k, from.termPos[k], res.termPos[k])
+			}
+			res.Terminals[k], res.termPos[k] = slices.Clone(from.Terminals[k]), from.termPos[k]
+		}
+	}
+
+	return res, nil
+}
+
+// redeclared это ошибка повторного объявления. Позиции есть только у
+// прочитанных объявлений.
+func redeclared(kind, name string, pos, prev lexer.Position) error {
+	if pos.Line == 0 || prev.Line == 0 {
+		return fmt.Errorf("%v %v is already declared", kind, name)
+	}
+
+	return fmt.Errorf("%v: %v %v is already declared at %v", pos, kind, name, prev)
+}
+
+// Check проверяет все селекторы терминалов и нетерминалов грамматики по
+// схеме s и возвращает *SchemaError со всеми найденными ошибками.
+func (e *EBNF) Check(s Schema) error {
+	var res SchemaError
+	for _, selectors := range []map[Ident]ComplexIdent{e.Terminals, e.Heads.Selectors} {
+		for ident, selector := range selectors {
+			for _, err := range s.check(selector) {
+				res = append(res, Diagnostic{Pos: e.Positions[ident], Selector: selector, Err: err})
+			}
+		}
+	}
+	if len(res) == 0 {
+		return nil
+	}
+
+	sort.SliceStable(res, func(i, j int) bool {
+		a, b := res[i].Pos, res[j].Pos
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		if a.Column != b.Column {
+			return a.Column < b.Column
+		}
+		return res[i].Selector.String() < res[j].Selector.String()
+	})
+
+	return &res
+}
+
+// Diagnostic это ошибка в одном селекторе. Pos это место, где
+// селектор впервые встречается в грамматике.
+type Diagnostic struct {
+	Pos      lexer.Position
+	Selector ComplexIdent
+	Err      error
+}
+
+func (d Diagnostic) Error() string { return fmt.Sprintf("%v: %v: %v", d.Pos, d.Selector, d.Err) }
+
+func (d Diagnostic) Unwrap() error { return d.Err }
+
+// SchemaError это все ошибки селекторов, по одной на строку.
+type SchemaError []Diagnostic
+
+func (e *SchemaError) Error() string { return fmtStringify(*e, "\n") }
+
+// check возвращает все несоответствия селектора t схеме.
+func (s Schema) check(t ComplexIdent) []error {
+	var res []error
+	allowed, declared := s.Terminals[t.ID]
+	known := func(key string) bool {
+		if !declared || slices.Contains(allowed, key) {
+			return true
+		}
+		res = append(res, fmt.Errorf("terminal %v has no attribute %v", t.ID, key))
+		return false
+	}
+
+	for _, k := range slices.Sort(maps.Keys(t.Properties)) {
+		if v := t.Properties[k]; known(k) && v.Kind != KindFlag {
+			if err := s.checkValue(k, v); err != nil {
+				res = append(res, err)
+			}
+		}
+	}
+	for _, c := range t.Conditions {
+		if !known(c.Key) {
+			continue
+		}
+		if err := s.checkOperator(c.Key, c.Op); err != nil {
+			res = append(res, err)
+			continue
+		}
+		if c.Op != OpIn && c.Op != OpNotIn {
+			continue
+		}
+		for _, v := range c.Values {
+			if err := s.checkValue(c.Key, v); err != nil {
+				res = append(res, err)
+			}
+		}
+	}
+
+	return res
+}
+
+// checkValue проверяет, что значение v атрибута key подходит под его
+// объявление.
+func (s Schema) checkValue(key string, v Value) error {
+	t, ok := s.Attributes[key]
+	if !ok {
+		return nil
+	}
+
+	switch {
+	case t.Kind == KindFlag:
+		return fmt.Errorf("attribute %v is a flag and takes no value, got %v", key, v)
+	case t.Kind == KindFloat && v.Kind == KindInt:
+	case t.Kind != v.Kind:
+		return fmt.Errorf("attribute %v is %v, got %v %v", key, t.Kind, v.Kind, v)
+	}
+	if len(t.Enum) == 0 {
+		return nil
+	}
+	for _, allowed := range t.Enum {
+		if allowed.Eq(v) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("attribute %v has no value %v, expected one of %v", key, v, fmtStringify(t.Enum, ", "))
+}
+
+// checkOperator проверяет, что у атрибута key есть смысл в условии op.
+func (s Schema) checkOperator(key string, op Operator) error {
+	t, ok := s.Attributes[key]
+	if !ok {
+		return nil
+	}
+
+	switch {
+	case op.numeric() && t.Kind != KindInt && t.Kind != KindFloat:
+		return fmt.Errorf("attribute %v is %v and can't be compared with %v", key, t, op)
+	case (op == OpPrefix || op == OpMatch) && t.Kind != KindString:
+		return fmt.Errorf("attribute %v is %v and can't be matched with %v", key, t, op)
+	}
+
+	return nil
+}
+
+type schemaFile struct {
+	D []declaration `parser:"@@*"`
+}
+
+// declaration это объявление схемы: атрибута или вида терминала.
+type declaration struct {
+	A *attribute    `parser:"  @@"`
+	T *terminalKind `parser:"| @@"`
+}
+
+// buildSchema собирает схему из объявлений.
+func buildSchema(decls []declaration) (Schema, error) {
+	res := Schema{
+		Attributes: make(map[string]AttributeType),
+		Terminals:  make(map[string][]string),
+		attrPos:    make(map[string]lexer.Position),
+		termPos:    make(map[string]lexer.Position),
+	}
+	for _, d := range decls {
+		switch {
+		case d.A != nil:
+			if pos, ok := res.attrPos[d.A.Key]; ok {
+				return Schema{}, redeclared("attribute", d.A.Key, d.A.Pos, pos)
+			}
+			t, err := d.A.normalize()
+			if err != nil {
+				return Schema{}, err
+			}
+			res.attrPos[d.A.Key] = d.A.Pos
+			res.Attributes[d.A.Key] = t
+		case d.T != nil:
+			if pos, ok := res.termPos[d.T.Name]; ok {
+				return Schema{}, redeclared("terminal", d.T.Name, d.T.Pos, pos)
+			}
+			res.termPos[d.T.Name] = d.T.Pos
+			res.Terminals[d.T.Name] = append([]string{}, d.T.Keys...)
+		}
+	}
+
+	return res, nil
+}
+
+// terminalKind перечисляет атрибуты терминала: `@terminal noun<case num> ;`.
+// Терминал без атрибутов объявляется как `@terminal punct ;`.
+type terminalKind struct {
+	Pos lexer.Position
+
+	Name string   `parser:"'@' 'terminal' @Ident"`
+	Keys []string `parser:"( '<' @Ident+ '>' )? ';'"`
+}
+
+var schemaParser = participle.MustBuild[schemaFile](
+	participle.Unquote("String"),
+	participle.UseLookahead(2),
+)
+
+// String записывает схему так же, как она объявляется в грамматике.
+func (s Schema) String() string {
+	strs := make([]string, 0, len(s.Attributes)+len(s.Terminals))
+	for _, k := range slices.Sort(maps.Keys(s.Attributes)) {
+		strs = append(strs, fmt.Sprintf("@attribute %v %v ;", k, s.Attributes[k]))
+	}
+	for _, k := range slices.Sort(maps.Keys(s.Terminals)) {
+		if keys := s.Terminals[k]; len(keys) > 0 {
+			strs = append(strs, fmt.Sprintf("@terminal %v<%v> ;", k, strings.Join(keys, " ")))
+		} else {
+			strs = append(strs, fmt.Sprintf("@terminal %v ;", k))
+		}
+	}
+
+	return strings.Join(strs, "\n")
+}
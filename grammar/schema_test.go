@@ -0,0 +1,94 @@
+package grammar_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	. "github.com/quenbyako/parser/grammar"
+)
+
+func TestParse_TerminalSchema(t *testing.T) {
+	_, err := Parse("src", strings.NewReader(`
+@attribute case (nom | gen | acc) ;
+@terminal noun<case num anim> ;
+@terminal punct ;
+
+S : noun<case=gent> verb<tense=past> noun<gender=f> ;
+T : punct<kind=comma> noun<case=gent> ;
+`), "noun", "verb", "punct")
+
+	var schemaErr *SchemaError
+	require.ErrorAs(t, err, &schemaErr)
+	require.Len(t, *schemaErr, 3)
+	require.EqualError(t, err, strings.Join([]string{
+		`src:6:5: noun<case="gent">: attribute case has no value "gent", expected one of "nom", "gen", "acc"`,
+		`src:6:38: noun<gender="f">: terminal noun has no attribute gender`,
+		`src:7:5: punct<kind="comma">: terminal punct has no attribute kind`,
+	}, "\n"))
+	require.Equal(t, 6, (*schemaErr)[0].Pos.Line)
+	require.Equal(t, "noun", (*schemaErr)[0].Selector.ID)
+}
+
+func TestParseSchema(t *testing.T) {
+	schema, err := ParseSchema("schema", strings.NewReader(`
+@attribute case (nom | gen | acc) ;
+@attribute count int ;
+@terminal noun<case count> ;
+`))
+	require.NoError(t, err)
+	require.Equal(t, map[string][]string{"noun": {"case", "count"}}, schema.Terminals)
+	require.Equal(t, "@attribute case (\"nom\" | \"gen\" | \"acc\") ;\n@attribute count int ;\n@terminal noun<case count> ;", schema.String())
+
+	// без схемы грамматика разбирается, а проверяется уже отдельно
+	g, err := Parse("src", strings.NewReader(`S : noun<case=nom count>=2> | noun<case=gent anim> ;`), "noun")
+	require.NoError(t, err)
+	require.EqualError(t, g.Check(schema), strings.Join([]string{
+		`src:1:31: noun<anim case="gent">: terminal noun has no attribute anim`,
+		`src:1:31: noun<anim case="gent">: attribute case has no value "gent", expected one of "nom", "gen", "acc"`,
+	}, "\n"))
+
+	g, err = Parse("src", strings.NewReader(`S : noun<case=gen> ;`), "noun")
+	require.NoError(t, err)
+	require.NoError(t, g.Check(schema))
+}
+
+func TestParseSchema_Errors(t *testing.T) {
+	for _, tt := range []struct{ src, err string }{
+		{"@terminal noun<case> ;\n@terminal noun<num> ;", `schema:2:1: terminal noun is already declared at schema:1:1`},
+		{"@attribute case string ;\n@attribute case int ;", `schema:2:1: attribute case is already declared at schema:1:1`},
+		{"S : noun ;", `schema:1:1: unexpected token "S"`},
+	} {
+		_, err := ParseSchema("schema", strings.NewReader(tt.src))
+		require.EqualError(t, err, tt.err)
+	}
+}
+
+func TestSchema_Merge(t *testing.T) {
+	g, err := Parse("src", strings.NewReader(`
+@attribute case (nom | gen | acc) ;
+
+S : noun<case=nom num=pl> | noun<case=gen num=dual> ;
+`), "noun")
+	require.NoError(t, err)
+
+	side, err := ParseSchema("schema", strings.NewReader(`
+@attribute num (sg | pl) ;
+@terminal noun<case num> ;
+`))
+	require.NoError(t, err)
+
+	schema, err := g.Schema.Merge(side)
+	require.NoError(t, err)
+	require.Equal(t, "@attribute case (\"nom\" | \"gen\" | \"acc\") ;\n@attribute num (\"sg\" | \"pl\") ;\n@terminal noun<case num> ;", schema.String())
+	require.EqualError(t, g.Check(schema), `src:4:29: noun<case="gen" num="dual">: attribute num has no value "dual", expected one of "sg", "pl"`)
+
+	// повторное объявление это ошибка, даже если объявления совпадают
+	other, err := ParseSchema("other", strings.NewReader("@terminal verb ;\n@terminal noun<case num> ;"))
+	require.NoError(t, err)
+	_, err = side.Merge(other)
+	require.EqualError(t, err, `other:2:1: terminal noun is already declared at schema:3:1`)
+	_, err = g.Schema.Merge(Schema{Attributes: map[string]AttributeType{"case": {Kind: KindString}}})
+	require.EqualError(t, err, `attribute case is already declared`)
+}
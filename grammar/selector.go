@@ -0,0 +1,189 @@
+package grammar
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Operator это вид условия на атрибут терминала в селекторе.
+type Operator int
+
+const (
+	// OpAbsent: атрибута нет вообще, `!anim`.
+	OpAbsent Operator = iota
+	// OpIn: значение одно из Values, `case=(gen|acc)`.
+	OpIn
+	// OpNotIn: атрибута нет, или его значение не из Values, `case!=nom`.
+	OpNotIn
+	// OpPrefix: значение начинается с Values[0], `lemma^=un`.
+	OpPrefix
+	// OpMatch: значение подходит под регулярное выражение Values[0]
+	// (синтаксис пакета regexp, без неявных ^ и $), `lemma~="^un.*able$"`.
+	OpMatch
+	// OpLess и остальные сравнивают значение с Values[0] как числа,
+	// `count>=2`. Если значение не число (и не строка с числом), условие
+	// не выполняется.
+	OpLess
+	OpLessEqual
+	OpGreater
+	OpGreaterEqual
+)
+
+func (o Operator) String() string {
+	switch o {
+	case OpAbsent:
+		return "!"
+	case OpIn:
+		return "="
+	case OpNotIn:
+		return "!="
+	case OpPrefix:
+		return "^="
+	case OpMatch:
+		return "~="
+	case OpLess:
+		return "<"
+	case OpLessEqual:
+		return "<="
+	case OpGreater:
+		return ">"
+	case OpGreaterEqual:
+		return ">="
+	default:
+		return "op(" + strconv.Itoa(int(o)) + ")"
+	}
+}
+
+func (o Operator) numeric() bool { return o >= OpLess && o <= OpGreaterEqual }
+
+// Condition это условие селектора на один атрибут, которое не выражается
+// через ComplexIdent.Properties (там только "атрибут есть" и "атрибут
+// равен значению").
+//
+// У условий OpMatch, прочитанных Parse, выражение скомпилировано заранее.
+// Условие, собранное вручную, компилирует его при каждой проверке.
+type Condition struct {
+	Key    string
+	Op     Operator
+	Values []Value
+
+	re *regexp.Regexp
+}
+
+// compile компилирует выражение условия OpMatch. Выражение уже проверено
+// при разборе грамматики.
+func (c Condition) compile() Condition {
+	if c.Op == OpMatch && len(c.Values) > 0 {
+		c.re = regexp.MustCompile(c.Values[0].Text())
+	}
+
+	return c
+}
+
+// match проверяет условие на атрибутах входного терминала.
+func (c Condition) match(props map[string]Value) bool {
+	v, ok := props[c.Key]
+	switch c.Op {
+	case OpAbsent:
+		return !ok
+	case OpNotIn:
+		return !ok || v.Kind == KindFlag || !containsValue(c.Values, v)
+	}
+	if !ok || v.Kind == KindFlag || len(c.Values) == 0 {
+		return false
+	}
+
+	switch c.Op {
+	case OpIn:
+		return containsValue(c.Values, v)
+	case OpPrefix:
+		return strings.HasPrefix(v.Text(), c.Values[0].Text())
+	case OpMatch:
+		re := c.re
+		if re == nil {
+			var err error
+			if re, err = regexp.Compile(c.Values[0].Text()); err != nil {
+				return false
+			}
+		}
+		return re.MatchString(v.Text())
+	}
+
+	got, ok := v.Number()
+	if !ok {
+		return false
+	}
+	want, ok := c.Values[0].Number()
+	if !ok {
+		return false
+	}
+	switch c.Op {
+	case OpLess:
+		return got < want
+	case OpLessEqual:
+		return got <= want
+	case OpGreater:
+		return got > want
+	case OpGreaterEqual:
+		return got >= want
+	default:
+		return false
+	}
+}
+
+// normalize возвращает условие в каноническом виде: альтернативы
+// отсортированы и без повторов, так что равносильные селекторы дают один
+// и тот же хеш.
+func (c Condition) normalize() Condition {
+	if c.Op != OpIn && c.Op != OpNotIn {
+		return c
+	}
+
+	values := append([]Value(nil), c.Values...)
+	sort.Slice(values, func(i, j int) bool {
+		if a, b := values[i].Text(), values[j].Text(); a != b {
+			return a < b
+		}
+		return values[i].Kind < values[j].Kind
+	})
+	res := values[:0]
+	for i, v := range values {
+		if i == 0 || v != values[i-1] {
+			res = append(res, v)
+		}
+	}
+	c.Values = res
+
+	return c
+}
+
+// format записывает условие так же, как оно пишется в грамматике, значения
+// записываются через value.
+func (c Condition) format(value func(Value) string) string {
+	c = c.normalize()
+	if c.Op == OpAbsent {
+		return "!" + c.Key
+	}
+	if len(c.Values) == 1 {
+		return c.Key + c.Op.String() + value(c.Values[0])
+	}
+
+	values := make([]string, len(c.Values))
+	for i, v := range c.Values {
+		values[i] = value(v)
+	}
+
+	return c.Key + c.Op.String() + "(" + strings.Join(values, "|") + ")"
+}
+
+func containsValue(values []Value, v Value) bool {
+	for _, want := range values {
+		if want.Eq(v) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,179 @@
+package grammar_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zeebo/xxh3"
+	"golang.org/x/exp/maps"
+
+	. "github.com/quenbyako/parser/grammar"
+)
+
+func parseSelector(t *testing.T, selector string) (Ident, ComplexIdent) {
+	t.Helper()
+
+	g, err := Parse("", strings.NewReader(`S : noun`+selector+` ;`), "noun")
+	require.NoError(t, err)
+	i := terminal(g, "noun")
+
+	return i, g.Terminals[i]
+}
+
+func TestComplexIdent_Select(t *testing.T) {
+	str := StringValue
+
+	for _, tt := range []struct {
+		selector string
+		props    map[string]Value
+		want     bool
+	}{
+		{`<case=nom>`, map[string]Value{"case": str("nom")}, true},
+		{`<case!=nom>`, map[string]Value{"case": str("nom")}, false},
+		{`<case!=nom>`, map[string]Value{"case": str("gen")}, true},
+		{`<case!=nom>`, nil, true},
+		{`<case=(gen|acc)>`, map[string]Value{"case": str("acc")}, true},
+		{`<case=(gen|acc)>`, map[string]Value{"case": str("nom")}, false},
+		{`<case!=(gen|acc)>`, map[string]Value{"case": str("nom")}, true},
+		{`<!anim>`, nil, true},
+		{`<!anim>`, map[string]Value{"anim": {}}, false},
+		{`<anim case=nom>`, map[string]Value{"case": str("nom")}, false},
+		{`<anim case=nom>`, map[string]Value{"anim": {}, "case": str("nom")}, true},
+		{`<lemma^=un>`, map[string]Value{"lemma": str("undo")}, true},
+		{`<lemma^=un>`, map[string]Value{"lemma": str("redo")}, false},
+		{`<lemma~="^un.*able$">`, map[string]Value{"lemma": str("unbreakable")}, true},
+		{`<lemma~="^un.*able$">`, map[string]Value{"lemma": str("unbroken")}, false},
+		{`<count>=2>`, map[string]Value{"count": str("2")}, true},
+		{`<count>2>`, map[string]Value{"count": str("2")}, false},
+		{`<count<2.5>`, map[string]Value{"count": str("2")}, true},
+		{`<count>-1>`, map[string]Value{"count": str("0")}, true},
+		{`<count<=2>`, map[string]Value{"count": str("many")}, false},
+		{`<count>=2 count<5>`, map[string]Value{"count": str("7")}, false},
+	} {
+		_, selector := parseSelector(t, tt.selector)
+		require.Equal(t, tt.want, selector.Select(ComplexIdent{ID: "noun", Properties: tt.props}), tt.selector)
+	}
+
+	_, selector := parseSelector(t, `<case=nom>`)
+	require.False(t, selector.Select(ComplexIdent{ID: "verb", Properties: map[string]Value{"case": str("nom")}}))
+
+	// условие, собранное вручную, работает так же, а неправильное выражение
+	// ничему не подходит
+	unbreakable := ComplexIdent{ID: "noun", Properties: map[string]Value{"lemma": str("unbreakable")}}
+	for _, tt := range []struct {
+		expr string
+		want bool
+	}{
+		{"^un.*able$", true},
+		{"^re", false},
+		{"(un", false},
+	} {
+		selector := ComplexIdent{ID: "noun", Conditions: []Condition{{Key: "lemma", Op: OpMatch, Values: []Value{str(tt.expr)}}}}
+		require.Equal(t, tt.want, selector.Select(unbreakable), tt.expr)
+	}
+}
+
+func TestComplexIdent_Hash(t *testing.T) {
+	for _, tt := range [][]string{
+		{`<case=nom>`, `<case=(nom)>`, `<case="nom">`},
+		{`<case=(gen|acc)>`, `<case=(acc|gen|acc)>`},
+		{`<case!=nom anim>`, `<anim case!=(nom)>`},
+		{`<count>=2>`, `<count>=2.0>`},
+		{`<anim=true>`, `<anim="true">`},
+		{`<count=2>`, `<count="2">`, `<count=2.0>`},
+	} {
+		first, _ := parseSelector(t, tt[0])
+		for _, selector := range tt[1:] {
+			i, _ := parseSelector(t, selector)
+			require.Equal(t, first, i, selector)
+		}
+	}
+
+	// у селекторов только из наличия и равенства хеш прежний
+	i, _ := parseSelector(t, `<case=nom anim>`)
+	require.Equal(t, xxh3.HashString(`anim case="nom"`), i.AttrHash)
+	i, _ = parseSelector(t, `<anim=true>`)
+	require.Equal(t, xxh3.HashString(`anim="true"`), i.AttrHash)
+
+	a, _ := parseSelector(t, `<case!=nom>`)
+	b, _ := parseSelector(t, `<!case>`)
+	require.NotEqual(t, a, b)
+}
+
+func TestParse_SelectorErrors(t *testing.T) {
+	for _, tt := range []struct{ src, err string }{
+		{`S : noun<lemma~="(un"> ;`, `src:1:10: attribute lemma: error parsing regexp: missing closing ): ` + "`(un`"},
+		{`S : noun<!case=nom> ;`, `src:1:10: attribute case can't be both absent and compared`},
+		{`S : noun<lemma^=(a|b)> ;`, `src:1:10: operator ^= of attribute lemma doesn't accept alternatives`},
+	} {
+		_, err := Parse("src", strings.NewReader(tt.src), "noun")
+		require.EqualError(t, err, tt.err)
+	}
+}
+
+func TestCNF_WriteTo_Selectors(t *testing.T) {
+	g, err := Parse("", strings.NewReader(`
+		S : noun<case=(gen|acc) !anim lemma~="^un"> verb<count>=2 proper=true> ;
+	`), "noun", "verb")
+	require.NoError(t, err)
+	cnf := g.AsCNF("S")
+
+	buf := bytes.NewBuffer(nil)
+	_, err = cnf.WriteTo(buf)
+	require.NoError(t, err)
+	require.Contains(t, buf.String(), `noun<!anim case=("acc"|"gen") lemma~="^un">`)
+	require.Contains(t, buf.String(), `verb<count>=2 proper=true>`)
+
+	loaded, err := Parse("", buf, "noun", "verb")
+	require.NoError(t, err)
+	require.ElementsMatch(t, maps.Keys(g.Terminals), maps.Keys(loaded.Terminals))
+}
+
+func TestParse_Attributes(t *testing.T) {
+	g, err := Parse("src", strings.NewReader(`
+		@attribute count int ;
+		@attribute case (nom | gen | acc) ;
+		@attribute anim flag ;
+		@attribute proper bool ;
+		S : noun<count>=2 case=(nom|gen) anim proper=true> ;
+	`), "noun")
+	require.NoError(t, err)
+	require.Equal(t, map[string]AttributeType{
+		"count":  {Kind: KindInt},
+		"case":   {Kind: KindString, Enum: []Value{StringValue("nom"), StringValue("gen"), StringValue("acc")}},
+		"anim":   {Kind: KindFlag},
+		"proper": {Kind: KindBool},
+	}, g.Schema.Attributes)
+
+	selector := g.Terminals[terminal(g, "noun")]
+	for _, tt := range []struct {
+		props map[string]Value
+		want  bool
+	}{
+		{map[string]Value{"count": IntValue(3), "case": StringValue("gen"), "anim": {}, "proper": BoolValue(true)}, true},
+		{map[string]Value{"count": StringValue("3"), "case": StringValue("gen"), "anim": {}, "proper": StringValue("true")}, true},
+		{map[string]Value{"count": FloatValue(2), "case": StringValue("nom"), "anim": {}, "proper": BoolValue(true)}, true},
+		{map[string]Value{"count": IntValue(1), "case": StringValue("gen"), "anim": {}, "proper": BoolValue(true)}, false},
+		{map[string]Value{"count": IntValue(3), "case": StringValue("gen"), "anim": {}, "proper": BoolValue(false)}, false},
+	} {
+		require.Equal(t, tt.want, selector.Select(ComplexIdent{ID: "noun", Properties: tt.props}), tt.props)
+	}
+}
+
+func TestParse_AttributeErrors(t *testing.T) {
+	for _, tt := range []struct{ src, err string }{
+		{"@attribute count int ;\nS : noun<count=two> ;", `src:2:5: noun<count="two">: attribute count is int, got string "two"`},
+		{"@attribute count int ;\nS : noun<count=(1|2.5)> ;", `src:2:5: noun<count=(1|2.5)>: attribute count is int, got float 2.5`},
+		{"@attribute case (nom | gen) ;\nS : noun<case=(gent|nom)> ;", `src:2:5: noun<case=("gent"|"nom")>: attribute case has no value "gent", expected one of "nom", "gen"`},
+		{"@attribute case string ;\nS : noun<case>2> ;", `src:2:5: noun<case>2>: attribute case is string and can't be compared with >`},
+		{"@attribute count int ;\nS : noun<count^=1> ;", `src:2:5: noun<count^=1>: attribute count is int and can't be matched with ^=`},
+		{"@attribute anim flag ;\nS : noun<anim=true> ;", `src:2:5: noun<anim=true>: attribute anim is a flag and takes no value, got true`},
+		{"@attribute case (nom | 2) ;\nS : noun ;", `src:1:1: values of attribute case must be of one type, got "nom" and 2`},
+		{"@attribute case string ;\n@attribute case int ;\nS : noun ;", `src:2:1: attribute case is already declared at src:1:1`},
+	} {
+		_, err := Parse("src", strings.NewReader(tt.src), "noun")
+		require.EqualError(t, err, tt.err)
+	}
+}
@@ -0,0 +1,126 @@
+package grammar
+
+import (
+	"strconv"
+)
+
+// ValueKind это тип значения атрибута.
+type ValueKind uint8
+
+const (
+	// KindFlag это атрибут без значения, `noun<anim>`. Нулевой Value это
+	// флаг.
+	KindFlag ValueKind = iota
+	KindString
+	KindInt
+	KindFloat
+	KindBool
+)
+
+func (k ValueKind) String() string {
+	switch k {
+	case KindFlag:
+		return "flag"
+	case KindString:
+		return "string"
+	case KindInt:
+		return "int"
+	case KindFloat:
+		return "float"
+	case KindBool:
+		return "bool"
+	default:
+		return "kind(" + strconv.Itoa(int(k)) + ")"
+	}
+}
+
+// Value это типизированное значение атрибута терминала. Значения
+// сравниваются с учетом типа: числа как числа, а строка с числом или
+// логическим значением — по тексту, так что входные терминалы, у которых
+// все атрибуты строки, подходят под типизированные селекторы.
+type Value struct {
+	Kind ValueKind
+
+	str string
+	i   int64
+	f   float64
+	b   bool
+}
+
+func StringValue(s string) Value { return Value{Kind: KindString, str: s} }
+func IntValue(i int64) Value     { return Value{Kind: KindInt, i: i} }
+func FloatValue(f float64) Value { return Value{Kind: KindFloat, f: f} }
+func BoolValue(b bool) Value     { return Value{Kind: KindBool, b: b} }
+
+// Text возвращает значение так, как оно пишется в грамматике, но без
+// кавычек у строк. У флага это пустая строка.
+func (v Value) Text() string {
+	switch v.Kind {
+	case KindString:
+		return v.str
+	case KindInt:
+		return strconv.FormatInt(v.i, 10)
+	case KindFloat:
+		return strconv.FormatFloat(v.f, 'g', -1, 64)
+	case KindBool:
+		return strconv.FormatBool(v.b)
+	default:
+		return ""
+	}
+}
+
+func (v Value) String() string {
+	if v.Kind == KindString {
+		return strconv.Quote(v.str)
+	}
+
+	return v.Text()
+}
+
+// Number возвращает значение как число. Строки разбираются, если похожи на
+// число.
+func (v Value) Number() (float64, bool) {
+	switch v.Kind {
+	case KindInt:
+		return float64(v.i), true
+	case KindFloat:
+		return v.f, true
+	case KindString:
+		f, err := strconv.ParseFloat(v.str, 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// Eq сообщает, что значения равны: одного типа и равны, или оба числа и
+// равны как числа, или одно из них строка, и совпадает текст.
+func (v Value) Eq(o Value) bool {
+	switch {
+	case v.Kind == o.Kind:
+		return v == o
+	case v.Kind == KindFlag || o.Kind == KindFlag:
+		return false
+	case v.Kind == KindString || o.Kind == KindString:
+		return v.Text() == o.Text()
+	}
+
+	a, ok1 := v.Number()
+	b, ok2 := o.Number()
+	return ok1 && ok2 && a == b
+}
+
+// metadataValue записывает значение для хеша селектора. Пишется только
+// текст, так что равные по Eq строка и типизированное значение
+// (`anim=true` и `anim="true"`) дают один и тот же хеш.
+func metadataValue(v Value) string { return normalizeMetadataValue(v.Text()) }
+
+// displayValue записывает значение для ComplexIdent.String: в отличие от
+// хеша тип значения виден.
+func displayValue(v Value) string {
+	if v.Kind == KindString {
+		return normalizeMetadataValue(v.str)
+	}
+
+	return v.Text()
+}
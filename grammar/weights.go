@@ -0,0 +1,136 @@
+package grammar
+
+import (
+	"math"
+
+	"github.com/quenbyako/parser/slices"
+)
+
+// Weights хранит вероятности правил вероятностной грамматики (PCFG), ключ —
+// хеш CanonicalRule. nil означает, что грамматика не взвешена вообще.
+//
+// При приведении к нормальной форме вероятность всего дерева разбора
+// сохраняется, но сумма вероятностей правил одного нетерминала может стать
+// меньше единицы: например после удаления цепочек часть массы правил A
+// переезжает к сгенерированным A_n, которые стоят на тех же местах.
+type Weights map[uint64]float64
+
+// Get возвращает вероятность правила name : rule.
+func (w Weights) Get(name Ident, rule IdentSet) float64 { return w[ruleHash(name, rule)] }
+
+func (w Weights) set(name Ident, rule IdentSet, p float64) {
+	if w != nil {
+		w[ruleHash(name, rule)] = p
+	}
+}
+
+func (w Weights) add(name Ident, rule IdentSet, p float64) {
+	if w != nil {
+		w[ruleHash(name, rule)] += p
+	}
+}
+
+// like возвращает пустые веса, если w не nil, что бы не проверять каждый раз,
+// взвешена ли грамматика.
+func (w Weights) like() Weights {
+	if w == nil {
+		return nil
+	}
+
+	return make(Weights, len(w))
+}
+
+func ruleHash(name Ident, rule IdentSet) uint64 {
+	h, _ := CanonicalRule{Name: name, Rule: rule}.Hash()
+	return h
+}
+
+// weigh раскладывает веса альтернатив EBNF по правилам BNF. Вес
+// альтернативы делится поровну между всеми правилами, на которые она
+// распалась (например `a [ b ]` дает два правила). Альтернативы без веса
+// поровну делят оставшуюся до единицы массу, а у сгенерированных
+// нетерминалов (повторы, группы) все правила равновероятны.
+func (e EBNF) weigh(res *BNF, unwrapped map[Ident][][]IdentSet, weights map[Ident][]float64) {
+	res.Weights = make(Weights)
+
+	for name, alts := range unwrapped {
+		rest, free := 1.0, 0
+		for _, w := range weights[name] {
+			if math.IsNaN(w) {
+				free++
+			} else {
+				rest -= w
+			}
+		}
+
+		for i, rules := range alts {
+			w := weights[name][i]
+			if math.IsNaN(w) {
+				w = math.Max(rest, 0) / float64(free)
+			}
+			for _, rule := range rules {
+				res.Weights.add(name, rule, w/float64(len(rules)))
+			}
+		}
+	}
+
+	for name, rules := range res.Rules {
+		if _, ok := unwrapped[name]; ok {
+			continue
+		}
+		for _, rule := range rules {
+			res.Weights.set(name, rule, 1/float64(len(rules)))
+		}
+	}
+}
+
+// emptyProbabilities считает для каждого nullable нетерминала вероятность
+// того, что он выведет пустую строку. Это неподвижная точка системы
+// e(A) = Σ p(A : X...) · Π e(X), так что считается она итерациями.
+func (g *BNF) emptyProbabilities(nullable Set[Ident]) map[Ident]float64 {
+	res := make(map[Ident]float64, len(nullable))
+
+	const maxIterations = 1000
+	for i := 0; i < maxIterations; i++ {
+		var delta float64
+		for name := range nullable {
+			var e float64
+			for _, rule := range g.Rules[name] {
+				p := g.Weights.Get(name, rule)
+				for _, selector := range rule {
+					p *= res[selector]
+				}
+				e += p
+			}
+
+			delta = math.Max(delta, math.Abs(e-res[name]))
+			res[name] = e
+		}
+
+		if delta < 1e-12 {
+			break
+		}
+	}
+
+	return res
+}
+
+// Weight возвращает вероятность правила name : rule. Для невзвешенной
+// грамматики все правила имеют вероятность 1.
+func (g *CNF) Weight(name Ident, rule ...Ident) float64 {
+	if g.Weights == nil {
+		return 1
+	}
+
+	return g.Weights.Get(name, rule)
+}
+
+func isWeighted(e EBNF) bool {
+	for _, exprs := range e.Rules {
+		if slices.ContainsFunc(exprs, func(e Expr) bool { _, ok := e.(Weighted); return ok }) {
+			return true
+		}
+	}
+
+	return false
+}
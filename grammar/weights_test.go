@@ -0,0 +1,85 @@
+package grammar_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	. "github.com/quenbyako/parser/grammar"
+)
+
+func TestParse_Weights(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		src     string
+		wantErr bool
+	}{
+		{"weighted", `np : adj noun [0.7] | noun [0.3] ;`, false},
+		{"option is not a weight", `np : noun [ adj ] [1] ;`, false},
+		{"too heavy", `np : noun [2] ;`, true},
+		{"zero", `np : noun [0] ;`, true},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse("", strings.NewReader(tt.src), "adj", "noun")
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestBNF_AsCNF_Weights(t *testing.T) {
+	g, err := Parse("", strings.NewReader(`
+		S : A b [0.8] | C [0.2] ;
+		A : [ a ] ;
+		C : b ;
+	`), "a", "b")
+	require.NoError(t, err)
+
+	a, b := terminal(g, "a"), terminal(g, "b")
+
+	bnf := g.AsBNF()
+	// [ a ] распадается на два равновероятных правила
+	require.InDelta(t, 0.5, bnf.Weights.Get(Ident{ID: "A"}, IdentSet{a}), 1e-9)
+	require.InDelta(t, 0.5, bnf.Weights.Get(Ident{ID: "A"}, IdentSet{}), 1e-9)
+
+	cnf := bnf.AsCNF("S")
+	s := Ident{ID: "S"}
+	// A пуст с вероятностью 0.5: масса S : A b делится пополам, а сам A
+	// теперь выводит a с вероятностью 1
+	require.InDelta(t, 0.4, cnf.Weight(s, Ident{ID: "A"}, b), 1e-9)
+	require.InDelta(t, 0.4, cnf.Weight(s, b), 1e-9)
+	require.InDelta(t, 1, cnf.Weight(Ident{ID: "A"}, a), 1e-9)
+
+	// цепочка S -> C -> b переезжает в сгенерированный корень
+	var chained float64
+	for _, root := range cnf.Roots() {
+		if root != s {
+			chained += cnf.Weight(root, b)
+		}
+	}
+	require.InDelta(t, 0.2, chained, 1e-9)
+}
+
+func TestBNF_AsCNF_Unweighted(t *testing.T) {
+	g, err := Parse("", strings.NewReader(`S : a [ S ] ;`), "a")
+	require.NoError(t, err)
+
+	cnf := g.AsCNF("S")
+	require.Nil(t, cnf.Weights)
+	require.Equal(t, 1.0, cnf.Weight(Ident{ID: "S"}, terminal(g, "a")))
+}
+
+func terminal(g *EBNF, id string) Ident {
+	for term := range g.Terminals {
+		if term.ID == id {
+			return term
+		}
+	}
+
+	panic("unknown terminal " + id)
+}
@@ -0,0 +1,94 @@
+package pcfg
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/scanner"
+
+	"github.com/quenbyako/parser/cyk"
+	"github.com/quenbyako/parser/grammar"
+	"golang.org/x/exp/maps"
+)
+
+// ReadCorpus читает все файлы каталога dir (включая вложенные) в порядке
+// имен. Каждая непустая строка — предложение, слова разделены пробелами.
+// Слово это либо значение константы грамматики, либо имя терминала без
+// атрибутов: `det noun ( num )`.
+func ReadCorpus(dir string, g *grammar.CNF) ([][]cyk.Terminal, error) {
+	var res [][]cyk.Terminal
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		sentences, err := ReadSentences(path, f, g)
+		res = append(res, sentences...)
+		return err
+	})
+
+	return res, err
+}
+
+// ReadSentences читает предложения из r в формате ReadCorpus. file нужен
+// только для позиций терминалов и ошибок.
+func ReadSentences(file string, r io.Reader, g *grammar.CNF) ([][]cyk.Terminal, error) {
+	lookup := newLookup(g)
+
+	var res [][]cyk.Terminal
+	s := bufio.NewScanner(r)
+	for line := 1; s.Scan(); line++ {
+		var sentence []cyk.Terminal
+		text := s.Text()
+		for column := 0; column < len(text); {
+			if text[column] == ' ' || text[column] == '\t' {
+				column++
+				continue
+			}
+
+			end := strings.IndexAny(text[column:], " \t")
+			if end < 0 {
+				end = len(text) - column
+			}
+			word := text[column : column+end]
+			pos := scanner.Position{Filename: file, Line: line, Column: column + 1}
+
+			i, ok := lookup[word]
+			if !ok {
+				return nil, fmt.Errorf("%v: unknown word %q", pos, word)
+			}
+			sentence = append(sentence, cyk.Terminal{Position: pos, Type: i, Value: word})
+			column += end
+		}
+
+		if len(sentence) > 0 {
+			res = append(res, sentence)
+		}
+	}
+
+	return res, s.Err()
+}
+
+func newLookup(g *grammar.CNF) map[string]grammar.Ident {
+	res := make(map[string]grammar.Ident, len(g.Terminals)+len(g.Constants))
+	for _, i := range maps.Keys(g.Terminals) {
+		if term := g.Terminals[i]; len(term.Properties) == 0 && len(term.Conditions) == 0 {
+			res[i.ID] = i
+		}
+	}
+	for hash, value := range g.Constants {
+		res[value] = grammar.Ident{ID: "CONST", AttrHash: hash}
+	}
+
+	return res
+}
@@ -0,0 +1,3 @@
+// pcfg это все, что нужно для вероятностных грамматик поверх CYK: чтение
+// корпуса и обучение весов правил.
+package pcfg
@@ -0,0 +1,170 @@
+package pcfg
+
+import (
+	"math"
+
+	"github.com/quenbyako/parser/cyk"
+	"github.com/quenbyako/parser/grammar"
+)
+
+// Options настраивает Train.
+type Options struct {
+	// MaxIterations ограничивает количество итераций EM, по умолчанию 50.
+	MaxIterations int
+	// Tolerance это порог сходимости: обучение останавливается, когда
+	// логарифм правдоподобия корпуса вырос меньше чем на Tolerance. По
+	// умолчанию 1e-6.
+	Tolerance float64
+	// Progress, если задан, вызывается после каждой итерации.
+	Progress func(Iteration)
+}
+
+// Iteration это отчет об одной итерации EM.
+type Iteration struct {
+	N int
+	// LogLikelihood это логарифм вероятности всех разобранных предложений
+	// корпуса при весах, с которыми итерация начиналась.
+	LogLikelihood float64
+	// Delta это прирост LogLikelihood относительно прошлой итерации.
+	Delta float64
+	// Skipped это количество предложений, которые грамматика не выводит:
+	// в обучении они не участвуют.
+	Skipped int
+	// Converged сообщает, что это последняя итерация.
+	Converged bool
+}
+
+// Train подбирает вероятности правил g алгоритмом inside-outside (EM) по
+// неразмеченному корпусу и записывает их в g.Weights. Если грамматика не
+// взвешена, обучение начинается с равновероятных правил.
+//
+// Каждая итерация ожидаемые количества применений правил, посчитанные по
+// всем деревьям разбора каждого предложения, превращает в новые
+// вероятности: count(A : β) / count(A). Нетерминалы, которые ни разу не
+// встретились, сохраняют старые веса. Корни отдельного распределения не
+// получают: у каждого из Roots свои правила.
+//
+// Таблицы предложений от весов не зависят, так что строятся один раз.
+func Train(g *grammar.CNF, corpus [][]cyk.Terminal, opts Options) []Iteration {
+	if opts.MaxIterations <= 0 {
+		opts.MaxIterations = 50
+	}
+	if opts.Tolerance <= 0 {
+		opts.Tolerance = 1e-6
+	}
+	if g.Weights == nil {
+		g.Weights = uniform(g)
+	}
+
+	forests := make([]cyk.Forest, 0, len(corpus))
+	skipped := 0
+	for _, sentence := range corpus {
+		t := cyk.NewTable(len(sentence))
+		t.Closure = g.Closure
+		for _, term := range sentence {
+			t.AddTerminals(term, []grammar.Ident{term.Type}, g.Select)
+		}
+
+		forest := t.Forest(g.Roots()...)
+		if len(forest.Roots()) == 0 {
+			skipped++
+			continue
+		}
+		forests = append(forests, forest)
+	}
+
+	var res []Iteration
+	prev := math.Inf(-1)
+	for n := 1; n <= opts.MaxIterations; n++ {
+		counts := make(map[uint64]*ruleCount)
+		ll := 0.0
+		notParsed := skipped
+		for _, forest := range forests {
+			logZ := forest.InsideOutside(g.Weight, func(parent grammar.Ident, children []grammar.Ident, logCount float64) {
+				rule := grammar.CanonicalRule{Name: parent, Rule: children}
+				h, _ := rule.Hash()
+				if c, ok := counts[h]; ok {
+					c.count += math.Exp(logCount)
+					return
+				}
+				counts[h] = &ruleCount{rule: rule, count: math.Exp(logCount)}
+			})
+			if math.IsInf(logZ, -1) {
+				// у всех деревьев нулевая вероятность
+				notParsed++
+				continue
+			}
+			ll += logZ
+		}
+
+		g.Weights = maximize(g, counts)
+
+		it := Iteration{N: n, LogLikelihood: ll, Delta: ll - prev, Skipped: notParsed}
+		it.Converged = n == opts.MaxIterations || it.Delta < opts.Tolerance
+		prev = ll
+
+		res = append(res, it)
+		if opts.Progress != nil {
+			opts.Progress(it)
+		}
+		if it.Converged {
+			break
+		}
+	}
+
+	return res
+}
+
+type ruleCount struct {
+	rule  grammar.CanonicalRule
+	count float64
+}
+
+// maximize это M-шаг: нормирует ожидаемые количества правил по левой части.
+func maximize(g *grammar.CNF, counts map[uint64]*ruleCount) grammar.Weights {
+	total := make(map[grammar.Ident]float64)
+	for _, c := range counts {
+		total[c.rule.Name] += c.count
+	}
+
+	res := make(grammar.Weights, len(g.Weights))
+	eachRule(g, func(name grammar.Ident, rule grammar.IdentSet) {
+		h, _ := grammar.CanonicalRule{Name: name, Rule: rule}.Hash()
+		switch {
+		case total[name] == 0:
+			res[h] = g.Weights[h]
+		case counts[h] != nil:
+			res[h] = counts[h].count / total[name]
+		default:
+			res[h] = 0
+		}
+	})
+
+	return res
+}
+
+func uniform(g *grammar.CNF) grammar.Weights {
+	rules := make(map[grammar.Ident]int)
+	eachRule(g, func(name grammar.Ident, _ grammar.IdentSet) { rules[name]++ })
+
+	res := make(grammar.Weights)
+	eachRule(g, func(name grammar.Ident, rule grammar.IdentSet) {
+		h, _ := grammar.CanonicalRule{Name: name, Rule: rule}.Hash()
+		res[h] = 1 / float64(rules[name])
+	})
+
+	return res
+}
+
+func eachRule(g *grammar.CNF, fn func(name grammar.Ident, rule grammar.IdentSet)) {
+	for name, pairs := range g.Rules {
+		for _, pair := range pairs {
+			fn(name, grammar.IdentSet{pair[0], pair[1]})
+		}
+	}
+	for child, parents := range g.StopRules {
+		for parent := range parents {
+			fn(parent, grammar.IdentSet{child})
+		}
+	}
+}
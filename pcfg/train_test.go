@@ -0,0 +1,79 @@
+package pcfg_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/quenbyako/parser/grammar"
+	. "github.com/quenbyako/parser/pcfg"
+)
+
+func TestTrain(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		src    string
+		corpus string
+		check  func(t *testing.T, g *grammar.CNF)
+	}{{
+		// деревья однозначны, так что EM сразу дает относительные частоты:
+		// S : a S три раза, S : a тоже три
+		name:   "relative frequencies",
+		src:    `S : a S | a ;`,
+		corpus: "a\na a\na a a\n",
+		check: func(t *testing.T, g *grammar.CNF) {
+			a := grammar.Ident{ID: "a", AttrHash: 0x2d06800538d394c2}
+			require.InDelta(t, 0.5, g.Weight(grammar.Ident{ID: "S"}, a), 1e-9)
+			require.InDelta(t, 0.5, g.Weight(grammar.Ident{ID: "S"}, a, grammar.Ident{ID: "S"}), 1e-9)
+		},
+	}, {
+		name:   "ambiguous",
+		src:    `S : S S [0.3] | a [0.7] ;`,
+		corpus: "a a\na a a a\na\na a a\n",
+	}} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "corpus.txt"), []byte(tt.corpus), 0o600))
+
+			g, err := grammar.Parse("", strings.NewReader(tt.src), "a")
+			require.NoError(t, err)
+			cnf := g.AsCNF("S")
+
+			corpus, err := ReadCorpus(dir, cnf)
+			require.NoError(t, err)
+			require.Len(t, corpus, strings.Count(tt.corpus, "\n"))
+
+			var reported []Iteration
+			res := Train(cnf, corpus, Options{Progress: func(it Iteration) { reported = append(reported, it) }})
+			require.Equal(t, res, reported)
+			require.True(t, res[len(res)-1].Converged)
+
+			// EM никогда не уменьшает правдоподобие
+			for i := 1; i < len(res); i++ {
+				require.GreaterOrEqual(t, res[i].LogLikelihood, res[i-1].LogLikelihood-1e-9)
+			}
+
+			if tt.check != nil {
+				tt.check(t, cnf)
+			}
+		})
+	}
+}
+
+func TestReadSentences(t *testing.T) {
+	g, err := grammar.Parse("", strings.NewReader(`S : num "+" num ;`), "num")
+	require.NoError(t, err)
+	cnf := g.AsCNF("S")
+
+	sentences, err := ReadSentences("x", strings.NewReader("num + num\n\n  num\t+ num"), cnf)
+	require.NoError(t, err)
+	require.Len(t, sentences, 2)
+	require.Equal(t, 3, sentences[1][0].Column)
+
+	_, err = ReadSentences("x", strings.NewReader("num - num"), cnf)
+	require.EqualError(t, err, `x:1:5: unknown word "-"`)
+}
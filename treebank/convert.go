@@ -0,0 +1,70 @@
+package treebank
+
+import (
+	"strings"
+
+	"github.com/quenbyako/parser/cyk"
+	"github.com/quenbyako/parser/grammar"
+)
+
+// FromCYK превращает дерево разбора грамматики, полученной из Induce, обратно
+// в дерево трибанка, что бы его можно было сравнить с эталоном через
+// Evaluate. chains это CNF.Chains той же грамматики.
+//
+// Все, что появилось при приведении к CNF и при индукции, убирается:
+// цепочки разворачиваются обратно в унарные составляющие, сгенерированные
+// нетерминалы и промежуточные нетерминалы марковизации (@NP|...) заменяются
+// своими потомками, а аннотация родителя (NP^S) отрезается. Слова берутся
+// из Terminal.Value.
+func FromCYK(t *cyk.Tree, chains grammar.ChainList) *Tree {
+	expand := make(map[grammar.Ident]grammar.Chain, len(chains))
+	for _, obj := range chains {
+		expand[obj.From] = obj.Chain
+	}
+
+	res := fromCYK(t, expand)
+	if len(res) == 1 {
+		return res[0]
+	}
+
+	return &Tree{Children: res}
+}
+
+// fromCYK возвращает несколько нод, если сама t в дереве трибанка не нужна.
+func fromCYK(t *cyk.Tree, expand map[grammar.Ident]grammar.Chain) []*Tree {
+	if len(t.Children) == 0 {
+		res := &Tree{Label: t.I.ID}
+		if t.Terminal != nil {
+			res.Word = t.Terminal.Value
+		}
+		return []*Tree{res}
+	}
+
+	var children []*Tree
+	for _, child := range t.Children {
+		children = append(children, fromCYK(child, expand)...)
+	}
+
+	if chain, ok := expand[t.I]; ok {
+		// последнее правило цепочки дало потомков, остальные — унарные
+		res := &Tree{Label: unannotated(chain[len(chain)-1].ID), Children: children}
+		for i := len(chain) - 2; i >= 0; i-- {
+			res = &Tree{Label: unannotated(chain[i].ID), Children: []*Tree{res}}
+		}
+		return []*Tree{res}
+	}
+	if t.I.Generated || strings.HasPrefix(t.I.ID, "@") {
+		return children
+	}
+
+	return []*Tree{{Label: unannotated(t.I.ID), Children: children}}
+}
+
+// unannotated отрезает аннотацию родителя: NP^S → NP.
+func unannotated(label string) string {
+	if i := strings.IndexByte(label, '^'); i > 0 {
+		return label[:i]
+	}
+
+	return label
+}
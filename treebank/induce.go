@@ -0,0 +1,233 @@
+package treebank
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/quenbyako/parser/grammar"
+	"github.com/quenbyako/parser/slices"
+	"golang.org/x/exp/maps"
+)
+
+// Options настраивает Induce.
+type Options struct {
+	// Start это имя стартового правила, по умолчанию "TOP". Корень каждого
+	// дерева выводится из него одним правилом.
+	Start string
+
+	// ParentAnnotation добавляет к метке каждой составляющей метку ее
+	// родителя: NP под S становится NP^S (Johnson, 1998). Части речи не
+	// аннотируются.
+	ParentAnnotation bool
+
+	// Markov включает горизонтальную марковизацию: правило с длинной правой
+	// частью разбивается на цепочку бинарных, а промежуточные нетерминалы
+	// помнят только MarkovOrder последних уже разобранных соседей, так что
+	// редкие длинные правила обобщаются (Klein, Manning — Accurate
+	// Unlexicalized Parsing, 2003).
+	Markov      bool
+	MarkovOrder int
+}
+
+// Induce строит по деревьям грамматику, в которой у каждого правила
+// относительная частота: count(A : β) / count(A). Терминалы грамматики — это
+// части речи, слова в грамматику не попадают, так что разбирать ей нужно
+// последовательности Tree.Tags. Полученную грамматику можно сразу привести
+// к CNF через AsCNF(opts.Start).
+//
+// Перед подсчетом деревья чистятся, как это принято для PTB: пустые
+// элементы (-NONE-) и оставшиеся без потомков составляющие удаляются, а от
+// меток отрезаются функциональные теги и индексы (NP-SBJ-1 → NP).
+func Induce(trees []*Tree, opts Options) *grammar.EBNF {
+	if opts.Start == "" {
+		opts.Start = "TOP"
+	}
+
+	in := &inducer{
+		opts:      opts,
+		counts:    make(map[string]map[string]int),
+		rules:     make(map[string]grammar.Expr),
+		terminals: make(map[string]struct{}),
+	}
+	for _, t := range trees {
+		t = clean(t)
+		if t == nil {
+			continue
+		}
+		if t.Label == "" {
+			// внешняя скобка PTB
+			t = &Tree{Label: opts.Start, Children: t.Children}
+		} else {
+			t = &Tree{Label: opts.Start, Children: []*Tree{t}}
+		}
+		in.count(t, "")
+	}
+
+	return in.grammar()
+}
+
+type inducer struct {
+	opts Options
+
+	// левая часть -> ключ правой части -> сколько раз встретилось
+	counts map[string]map[string]int
+	// ключ правой части -> сама правая часть
+	rules     map[string]grammar.Expr
+	terminals map[string]struct{}
+}
+
+// symbol это нетерминал или часть речи в правой части правила.
+type symbol struct {
+	name     string
+	terminal bool
+}
+
+func (in *inducer) count(t *Tree, parent string) string {
+	label := t.Label
+	if in.opts.ParentAnnotation && parent != "" && t.Label != in.opts.Start {
+		label += "^" + parent
+	}
+
+	children := make([]symbol, len(t.Children))
+	for i, child := range t.Children {
+		if child.IsPreterminal() {
+			in.terminals[child.Label] = struct{}{}
+			children[i] = symbol{name: child.Label, terminal: true}
+			continue
+		}
+		children[i] = symbol{name: in.count(child, t.Label)}
+	}
+
+	if !in.opts.Markov || len(children) <= 2 {
+		in.add(label, children)
+		return label
+	}
+
+	// A : X1 X2 ... Xn превращается в A : X1 @A|X1, @A|X1 : X2 @A|X1_X2 и
+	// так далее, а в имени промежуточного нетерминала остаются только
+	// последние MarkovOrder символов
+	lhs := label
+	for i := 0; i < len(children)-2; i++ {
+		from := i + 1 - in.opts.MarkovOrder
+		if from < 0 {
+			from = 0
+		}
+		history := slices.Remap(children[from:i+1], func(_ int, s symbol) string { return s.name })
+		next := "@" + label + "|" + strings.Join(history, "_")
+
+		in.add(lhs, []symbol{children[i], {name: next}})
+		lhs = next
+	}
+	in.add(lhs, children[len(children)-2:])
+
+	return label
+}
+
+func (in *inducer) add(lhs string, rhs []symbol) {
+	key := strings.Join(slices.Remap(rhs, func(_ int, s symbol) string {
+		if s.terminal {
+			return "'" + s.name
+		}
+		return s.name
+	}), " ")
+
+	if in.counts[lhs] == nil {
+		in.counts[lhs] = make(map[string]int)
+	}
+	in.counts[lhs][key]++
+
+	if _, ok := in.rules[key]; !ok {
+		in.rules[key] = in.expr(rhs)
+	}
+}
+
+func (in *inducer) expr(rhs []symbol) grammar.Expr {
+	seq := make(grammar.Seq, len(rhs))
+	for i, s := range rhs {
+		if s.terminal {
+			seq[i] = terminal(s.name)
+		} else {
+			seq[i] = grammar.Ident{ID: s.name}
+		}
+	}
+	if len(seq) == 1 {
+		return seq[0]
+	}
+
+	return seq
+}
+
+func (in *inducer) grammar() *grammar.EBNF {
+	res := &grammar.EBNF{
+		Rules:     make(map[grammar.Ident][]grammar.Expr, len(in.counts)),
+		Terminals: make(map[grammar.Ident]grammar.ComplexIdent, len(in.terminals)),
+		Constants: make(map[uint64]string),
+	}
+
+	for name := range in.terminals {
+		res.Terminals[terminal(name)] = grammar.ComplexIdent{ID: name, Properties: map[string]grammar.Value{}}
+	}
+
+	for lhs, rules := range in.counts {
+		total := 0
+		for _, n := range rules {
+			total += n
+		}
+
+		// порядок альтернатив не важен, но пусть будет стабильным
+		keys := maps.Keys(rules)
+		sort.Strings(keys)
+		for _, key := range keys {
+			res.Rules[grammar.Ident{ID: lhs}] = append(res.Rules[grammar.Ident{ID: lhs}], grammar.Weighted{
+				E: in.rules[key],
+				P: float64(rules[key]) / float64(total),
+			})
+		}
+	}
+
+	return res
+}
+
+// terminal возвращает идентификатор части речи таким же, каким его сделал
+// бы grammar.Parse для терминала без атрибутов.
+func terminal(name string) grammar.Ident {
+	hash, _ := grammar.ComplexIdent{ID: name}.Hash()
+	return grammar.Ident{ID: name, AttrHash: hash}
+}
+
+// clean возвращает копию дерева без пустых элементов и функциональных
+// тегов, или nil, если от дерева ничего не осталось.
+func clean(t *Tree) *Tree {
+	if t.Label == "-NONE-" {
+		return nil
+	}
+
+	res := &Tree{Label: stripLabel(t.Label), Word: t.Word}
+	if t.IsPreterminal() {
+		return res
+	}
+
+	for _, child := range t.Children {
+		if child = clean(child); child != nil {
+			res.Children = append(res.Children, child)
+		}
+	}
+	if len(res.Children) == 0 {
+		return nil
+	}
+
+	return res
+}
+
+// stripLabel отрезает функциональные теги и индексы: NP-SBJ-1 → NP,
+// NP=2 → NP. Метки вроде -LRB- и -NONE- не трогает.
+func stripLabel(label string) string {
+	if strings.HasPrefix(label, "-") {
+		return label
+	}
+	if i := strings.IndexAny(label, "-="); i > 0 {
+		return label[:i]
+	}
+
+	return label
+}
@@ -0,0 +1,237 @@
+package treebank
+
+import (
+	"fmt"
+	"sort"
+
+	"golang.org/x/exp/maps"
+)
+
+// EvalOptions настраивает Evaluate. Нулевое значение означает настройки
+// evalb для Penn Treebank (COLLINS.prm).
+type EvalOptions struct {
+	// Punctuation это части речи, которые удаляются из обоих деревьев вместе
+	// со словами до подсчета отрезков. По умолчанию DefaultPunctuation.
+	Punctuation []string
+	// DeleteLabels это метки составляющих, которые не считаются (их потомки
+	// при этом остаются). По умолчанию DefaultDeleteLabels, то есть корень.
+	DeleteLabels []string
+	// Unlabelled сравнивает только отрезки, без меток.
+	Unlabelled bool
+}
+
+var (
+	DefaultPunctuation  = []string{",", ":", "``", "''", ".", "-NONE-"}
+	DefaultDeleteLabels = []string{"", "TOP", "ROOT"}
+)
+
+// Scores это счетчики PARSEVAL. Precision, Recall и F1 считаются по ним,
+// так что Scores можно складывать.
+type Scores struct {
+	Gold, Test, Matched int
+}
+
+func (s Scores) Precision() float64 { return ratio(s.Matched, s.Test) }
+func (s Scores) Recall() float64    { return ratio(s.Matched, s.Gold) }
+
+func (s Scores) F1() float64 {
+	p, r := s.Precision(), s.Recall()
+	if p+r == 0 {
+		return 0
+	}
+
+	return 2 * p * r / (p + r)
+}
+
+func (s Scores) add(o Scores) Scores {
+	return Scores{Gold: s.Gold + o.Gold, Test: s.Test + o.Test, Matched: s.Matched + o.Matched}
+}
+
+func ratio(a, b int) float64 {
+	if b == 0 {
+		return 0
+	}
+
+	return float64(a) / float64(b)
+}
+
+// SentenceResult это оценка одного предложения.
+type SentenceResult struct {
+	Scores
+	Length int
+	// Crossing это количество составляющих разбора, которые пересекают
+	// какую-нибудь составляющую эталона, не вкладываясь в нее и не
+	// содержа ее.
+	Crossing int
+	// Err заполнен, если предложения нельзя сравнить (например у них разные
+	// слова). Такое предложение в Report не учитывается.
+	Err error
+}
+
+// Report это итог PARSEVAL по всему корпусу. Scores усредняются по всем
+// составляющим корпуса (micro average), как в evalb.
+type Report struct {
+	Scores
+	Sentences []SentenceResult
+	// Skipped это количество предложений с ошибкой.
+	Skipped int
+	// Crossing это сумма Crossing по всем предложениям, NoCrossing —
+	// количество предложений без пересечений вообще.
+	Crossing, NoCrossing int
+	// Labels это разбивка по меткам составляющих.
+	Labels map[string]Scores
+}
+
+// AverageCrossing возвращает среднее количество пересечений на предложение.
+func (r *Report) AverageCrossing() float64 { return ratio(r.Crossing, len(r.Sentences)-r.Skipped) }
+
+// NoCrossingRate возвращает долю предложений без пересечений.
+func (r *Report) NoCrossingRate() float64 { return ratio(r.NoCrossing, len(r.Sentences)-r.Skipped) }
+
+// SortedLabels возвращает метки разбивки в алфавитном порядке.
+func (r *Report) SortedLabels() []string {
+	res := maps.Keys(r.Labels)
+	sort.Strings(res)
+	return res
+}
+
+// Evaluate сравнивает разборы test с эталонными деревьями gold попарно.
+// Метки в обоих деревьях нормализуются так же, как в Induce.
+func Evaluate(gold, test []*Tree, opts EvalOptions) (*Report, error) {
+	if len(gold) != len(test) {
+		return nil, fmt.Errorf("got %d gold and %d test trees", len(gold), len(test))
+	}
+	if opts.Punctuation == nil {
+		opts.Punctuation = DefaultPunctuation
+	}
+	if opts.DeleteLabels == nil {
+		opts.DeleteLabels = DefaultDeleteLabels
+	}
+
+	e := &evaluator{
+		opts:        opts,
+		punctuation: toSet(opts.Punctuation),
+		deleted:     toSet(opts.DeleteLabels),
+	}
+
+	res := &Report{Labels: make(map[string]Scores)}
+	for i := range gold {
+		sentence := e.sentence(gold[i], test[i], res.Labels)
+		if sentence.Err != nil {
+			sentence.Err = fmt.Errorf("sentence %d: %w", i+1, sentence.Err)
+			res.Skipped++
+		} else {
+			res.Scores = res.Scores.add(sentence.Scores)
+			res.Crossing += sentence.Crossing
+			if sentence.Crossing == 0 {
+				res.NoCrossing++
+			}
+		}
+		res.Sentences = append(res.Sentences, sentence)
+	}
+
+	return res, nil
+}
+
+type evaluator struct {
+	opts        EvalOptions
+	punctuation map[string]struct{}
+	deleted     map[string]struct{}
+}
+
+// bracket это составляющая: метка и отрезок слов [From, To).
+type bracket struct {
+	Label    string
+	From, To int
+}
+
+func (b bracket) crosses(o bracket) bool {
+	return b.From < o.From && o.From < b.To && b.To < o.To ||
+		o.From < b.From && b.From < o.To && o.To < b.To
+}
+
+func (e *evaluator) sentence(gold, test *Tree, labels map[string]Scores) SentenceResult {
+	goldWords, goldBrackets := e.brackets(gold)
+	testWords, testBrackets := e.brackets(test)
+
+	if len(goldWords) != len(testWords) {
+		return SentenceResult{Err: fmt.Errorf("length mismatch: %d gold words, %d test words", len(goldWords), len(testWords))}
+	}
+	for i := range goldWords {
+		if goldWords[i] != testWords[i] {
+			return SentenceResult{Err: fmt.Errorf("word %d mismatch: %q in gold, %q in test", i+1, goldWords[i], testWords[i])}
+		}
+	}
+
+	res := SentenceResult{Length: len(goldWords)}
+	res.Gold, res.Test = len(goldBrackets), len(testBrackets)
+
+	// составляющие сравниваются как мультимножества: одинаковые унарные
+	// цепочки считаются столько раз, сколько встретились
+	unmatched := make(map[bracket]int, len(goldBrackets))
+	for _, b := range goldBrackets {
+		unmatched[b]++
+		s := labels[b.Label]
+		s.Gold++
+		labels[b.Label] = s
+	}
+	for _, b := range testBrackets {
+		s := labels[b.Label]
+		s.Test++
+		if unmatched[b] > 0 {
+			unmatched[b]--
+			res.Matched++
+			s.Matched++
+		}
+		labels[b.Label] = s
+
+		for _, g := range goldBrackets {
+			if b.crosses(g) {
+				res.Crossing++
+				break
+			}
+		}
+	}
+
+	return res
+}
+
+// brackets возвращает слова предложения без пунктуации и все составляющие,
+// которые идут в зачет.
+func (e *evaluator) brackets(t *Tree) (words []string, res []bracket) {
+	var walk func(t *Tree)
+	walk = func(t *Tree) {
+		if t.IsPreterminal() {
+			if _, ok := e.punctuation[t.Label]; !ok {
+				words = append(words, t.Word)
+			}
+			return
+		}
+
+		from := len(words)
+		for _, child := range t.Children {
+			walk(child)
+		}
+
+		label := stripLabel(t.Label)
+		if _, ok := e.deleted[label]; ok || len(words) == from {
+			return
+		}
+		if e.opts.Unlabelled {
+			label = ""
+		}
+		res = append(res, bracket{Label: label, From: from, To: len(words)})
+	}
+	walk(t)
+
+	return words, res
+}
+
+func toSet(s []string) map[string]struct{} {
+	res := make(map[string]struct{}, len(s))
+	for _, item := range s {
+		res[item] = struct{}{}
+	}
+
+	return res
+}
@@ -0,0 +1,191 @@
+// treebank читает размеченные деревья в формате Penn Treebank, строит по
+// ним грамматику и оценивает по ним разборы (PARSEVAL).
+package treebank
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"text/scanner"
+)
+
+// Tree это дерево трибанка. У предтерминала (части речи) есть слово и нет
+// потомков, у всех остальных нод — наоборот.
+type Tree struct {
+	Label    string
+	Word     string
+	Children []*Tree
+}
+
+// IsPreterminal сообщает, что нода это часть речи над словом.
+func (t *Tree) IsPreterminal() bool { return len(t.Children) == 0 }
+
+// Tags возвращает части речи всех слов дерева слева направо: это
+// предложение, которое разбирает индуцированная грамматика.
+func (t *Tree) Tags() []string {
+	var res []string
+	t.each(func(n *Tree) { res = append(res, n.Label) })
+	return res
+}
+
+// Words возвращает все слова дерева слева направо.
+func (t *Tree) Words() []string {
+	var res []string
+	t.each(func(n *Tree) { res = append(res, n.Word) })
+	return res
+}
+
+func (t *Tree) each(fn func(preterminal *Tree)) {
+	if t.IsPreterminal() {
+		fn(t)
+		return
+	}
+	for _, child := range t.Children {
+		child.each(fn)
+	}
+}
+
+func (t *Tree) String() string {
+	if t.IsPreterminal() {
+		return "(" + t.Label + " " + t.Word + ")"
+	}
+
+	children := make([]string, len(t.Children))
+	for i, child := range t.Children {
+		children[i] = child.String()
+	}
+
+	return "(" + t.Label + " " + strings.Join(children, " ") + ")"
+}
+
+// Read читает все деревья из r. Деревья записываются S-выражениями, как в
+// Penn Treebank: `(S (NP (DT the) (NN dog)) (VP (VBD barked)))`. Внешняя
+// скобка без метки, которая есть в файлах PTB, остается нодой с пустой
+// меткой.
+func Read(file string, r io.Reader) ([]*Tree, error) {
+	l := &lexer{r: bufio.NewReader(r), pos: scanner.Position{Filename: file, Line: 1, Column: 1}}
+
+	var res []*Tree
+	for {
+		tok, pos, err := l.next()
+		switch {
+		case err == io.EOF:
+			return res, nil
+		case err != nil:
+			return nil, err
+		case tok != "(":
+			return nil, fmt.Errorf("%v: expected '(', got %q", pos, tok)
+		}
+
+		tree, err := l.tree(pos)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, tree)
+	}
+}
+
+type lexer struct {
+	r   *bufio.Reader
+	pos scanner.Position
+}
+
+// tree читает ноду, открывающая скобка которой уже прочитана.
+func (l *lexer) tree(open scanner.Position) (*Tree, error) {
+	res := &Tree{}
+
+	tok, pos, err := l.next()
+	if err != nil {
+		return nil, l.unexpected(err, open)
+	}
+	if tok != "(" && tok != ")" {
+		res.Label = tok
+		if tok, pos, err = l.next(); err != nil {
+			return nil, l.unexpected(err, open)
+		}
+	}
+
+	for ; tok != ")"; tok, pos, err = l.next() {
+		if err != nil {
+			return nil, l.unexpected(err, open)
+		}
+
+		if tok != "(" {
+			if res.Word != "" || len(res.Children) > 0 {
+				return nil, fmt.Errorf("%v: word %q must be the only child of %q", pos, tok, res.Label)
+			}
+			res.Word = tok
+			continue
+		}
+		if res.Word != "" {
+			return nil, fmt.Errorf("%v: preterminal %q can't have children", pos, res.Label)
+		}
+
+		child, err := l.tree(pos)
+		if err != nil {
+			return nil, err
+		}
+		res.Children = append(res.Children, child)
+	}
+
+	if res.Word == "" && len(res.Children) == 0 {
+		return nil, fmt.Errorf("%v: empty node %q", open, res.Label)
+	}
+
+	return res, nil
+}
+
+func (l *lexer) unexpected(err error, open scanner.Position) error {
+	if err == io.EOF {
+		return fmt.Errorf("%v: unclosed '('", open)
+	}
+
+	return err
+}
+
+// next возвращает скобку или атом вместе с его позицией.
+func (l *lexer) next() (string, scanner.Position, error) {
+	var tok strings.Builder
+	var start scanner.Position
+	for {
+		r, _, err := l.r.ReadRune()
+		if err != nil {
+			if err == io.EOF && tok.Len() > 0 {
+				return tok.String(), start, nil
+			}
+			return "", l.pos, err
+		}
+
+		switch {
+		case r == '(' || r == ')':
+			if tok.Len() > 0 {
+				_ = l.r.UnreadRune()
+				return tok.String(), start, nil
+			}
+			pos := l.pos
+			l.advance(r)
+			return string(r), pos, nil
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			if tok.Len() > 0 {
+				l.advance(r)
+				return tok.String(), start, nil
+			}
+		default:
+			if tok.Len() == 0 {
+				start = l.pos
+			}
+			tok.WriteRune(r)
+		}
+		l.advance(r)
+	}
+}
+
+func (l *lexer) advance(r rune) {
+	if r == '\n' {
+		l.pos.Line++
+		l.pos.Column = 1
+		return
+	}
+	l.pos.Column++
+}
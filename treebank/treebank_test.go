@@ -0,0 +1,175 @@
+package treebank_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/quenbyako/parser/cyk"
+	"github.com/quenbyako/parser/grammar"
+	. "github.com/quenbyako/parser/treebank"
+)
+
+const ptb = `
+( (S (NP-SBJ (DT the) (NN dog))
+     (VP (VBD saw)
+         (NP (DT a) (JJ big) (JJ red) (NN cat)))
+     (. .)) )
+( (S (NP-SBJ-1 (PRP it))
+     (VP (VBD ran)
+         (S (NP (-NONE- *-1)) (VP (TO to) (VP (VB eat)))))
+     (. .)) )
+`
+
+func TestRead(t *testing.T) {
+	trees, err := Read("ptb", strings.NewReader(ptb))
+	require.NoError(t, err)
+	require.Len(t, trees, 2)
+	require.Equal(t, "", trees[0].Label)
+	require.Equal(t, []string{"DT", "NN", "VBD", "DT", "JJ", "JJ", "NN", "."}, trees[0].Children[0].Tags())
+	require.Equal(t, "the dog saw a big red cat .", strings.Join(trees[0].Words(), " "))
+
+	for _, tt := range []struct{ src, err string }{
+		{"(S (NP (DT the)", "x:1:4: unclosed '('"},
+		{"(S (DT the dog))", `x:1:12: word "dog" must be the only child of "DT"`},
+		{"(S)", `x:1:1: empty node "S"`},
+		{"S", `x:1:1: expected '(', got "S"`},
+	} {
+		_, err := Read("x", strings.NewReader(tt.src))
+		require.EqualError(t, err, tt.err, tt.src)
+	}
+}
+
+func TestInduce(t *testing.T) {
+	trees, err := Read("ptb", strings.NewReader(ptb))
+	require.NoError(t, err)
+
+	for _, tt := range []struct {
+		name     string
+		opts     Options
+		lhs      string
+		expected map[string]float64
+	}{{
+		name: "relative frequencies",
+		lhs:  "NP",
+		expected: map[string]float64{
+			"DT NN [0.3333333333333333]":       1.0 / 3,
+			"DT JJ JJ NN [0.3333333333333333]": 1.0 / 3,
+			"PRP [0.3333333333333333]":         1.0 / 3,
+		},
+	}, {
+		name: "parent annotation",
+		opts: Options{ParentAnnotation: true},
+		lhs:  "VP^S",
+		expected: map[string]float64{
+			"VBD NP^VP [0.3333333333333333]": 1.0 / 3,
+			"VBD S^VP [0.3333333333333333]":  1.0 / 3,
+			"TO VP^VP [0.3333333333333333]":  1.0 / 3,
+		},
+	}, {
+		name: "markovisation",
+		// без истории все промежуточные нетерминалы NP сливаются в один,
+		// так что прилагательных может быть сколько угодно
+		opts: Options{Markov: true},
+		lhs:  "@NP|",
+		expected: map[string]float64{
+			"JJ @NP| [0.5]": 0.5,
+			"JJ NN [0.5]":   0.5,
+		},
+	}} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			g := Induce(trees, tt.opts)
+
+			got := make(map[string]float64)
+			for _, expr := range g.Rules[grammar.Ident{ID: tt.lhs}] {
+				w := expr.(grammar.Weighted)
+				got[expr.String()] = w.P
+			}
+			require.Equal(t, tt.expected, got)
+
+			// грамматика выводит все предложения, из которых она собрана
+			cnf := g.AsCNF("TOP")
+			p := cyk.NewParser(cnf, cyk.BackendTable)
+			for _, tree := range trees {
+				var sentence []cyk.Terminal
+				for _, tag := range tree.Tags() {
+					if tag == "-NONE-" {
+						continue
+					}
+					hash, _ := grammar.ComplexIdent{ID: tag}.Hash()
+					sentence = append(sentence, cyk.Terminal{Type: grammar.Ident{ID: tag, AttrHash: hash}})
+				}
+				require.True(t, p.Accepts(p.Parse(sentence)), tree.String())
+			}
+		})
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	gold, err := Read("gold", strings.NewReader(`
+		( (S (NP (DT the) (NN dog)) (VP (VBD saw) (NP (DT a) (NN cat))) (. .)) )
+		( (S (NP (PRP it)) (VP (VBD ran))) )
+	`))
+	require.NoError(t, err)
+	test, err := Read("test", strings.NewReader(`
+		( (S (NP (DT the) (NN dog) (VBD saw)) (VP (NP (DT a) (NN cat))) (. .)) )
+		( (S (NP (PRP it)) (VP (VBD run))) )
+	`))
+	require.NoError(t, err)
+
+	report, err := Evaluate(gold, test, EvalOptions{})
+	require.NoError(t, err)
+	require.Equal(t, Scores{Gold: 4, Test: 4, Matched: 2}, report.Scores)
+	require.Equal(t, 0.5, report.F1())
+	require.Equal(t, 1, report.Skipped)
+	require.EqualError(t, report.Sentences[1].Err, `sentence 2: word 2 mismatch: "ran" in gold, "run" in test`)
+	// NP[0,3) пересекает VP[2,5)
+	require.Equal(t, 1, report.Crossing)
+	require.Equal(t, 0, report.NoCrossing)
+	require.Equal(t, []string{"NP", "S", "VP"}, report.SortedLabels())
+	require.Equal(t, map[string]Scores{
+		"NP": {Gold: 2, Test: 2, Matched: 1},
+		"S":  {Gold: 1, Test: 1, Matched: 1},
+		"VP": {Gold: 1, Test: 1},
+	}, report.Labels)
+
+	_, err = Evaluate(gold, test[:1], EvalOptions{})
+	require.EqualError(t, err, "got 2 gold and 1 test trees")
+}
+
+func TestFromCYK(t *testing.T) {
+	gold, err := Read("ptb", strings.NewReader(ptb+"( (S (VP (VB go))) )"))
+	require.NoError(t, err)
+
+	g := Induce(gold, Options{ParentAnnotation: true, Markov: true, MarkovOrder: 1})
+	cnf := g.AsCNF("TOP")
+
+	var test []*Tree
+	for _, tree := range gold {
+		table := &cyk.Table{Closure: cnf.Closure, Weight: cnf.Weight}
+		words := tree.Words()
+		for i, tag := range tree.Tags() {
+			if tag == "-NONE-" {
+				continue
+			}
+			hash, _ := grammar.ComplexIdent{ID: tag}.Hash()
+			term := grammar.Ident{ID: tag, AttrHash: hash}
+			table.AddTerminals(cyk.Terminal{Type: term, Value: words[i]}, []grammar.Ident{term}, cnf.Select)
+		}
+
+		best, ok := table.Forest(cnf.Roots()...).Best()
+		require.True(t, ok, tree.String())
+		parsed, ok := best.Trees(1).Next()
+		require.True(t, ok)
+		test = append(test, FromCYK(parsed, cnf.Chains))
+	}
+
+	require.Equal(t, "(TOP (S (VP (VB go))))", test[2].String())
+
+	report, err := Evaluate(gold, test, EvalOptions{})
+	require.NoError(t, err)
+	require.Zero(t, report.Skipped)
+	require.Equal(t, 1.0, report.F1())
+}